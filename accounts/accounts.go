@@ -0,0 +1,141 @@
+// Package accounts deletes user accounts. Deleting an account removes the
+// user's notes, images and everything else they stored right away, and
+// disables the account. The user record itself is kept for GracePeriod, so
+// abuse can still be traced to an address, and is then anonymized.
+package accounts
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"notes-api/database"
+	"notes-api/jobs"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const purgeInterval = time.Hour
+
+// GracePeriod is how long the record of a deleted account is kept before it
+// is anonymized.
+const GracePeriod = 30 * 24 * time.Hour
+
+// Start anonymizes deleted accounts in the background once their grace
+// period is over, and forgets old failed logins and expired sessions.
+func Start() {
+	go func() {
+		for {
+			if err := anonymize(time.Now()); err != nil {
+				log.Println("Failed to anonymize deleted accounts:", err)
+			}
+			if err := pruneThrottles(time.Now()); err != nil {
+				log.Println("Failed to prune login throttles:", err)
+			}
+			if err := pruneSessions(time.Now()); err != nil {
+				log.Println("Failed to prune sessions:", err)
+			}
+			time.Sleep(purgeInterval)
+		}
+	}()
+}
+
+// userTables hold rows owned directly by a user. Checklist items, webhook
+// deliveries and the notes import jobs recorded belong to them and are
+// deleted first.
+var userTables = []interface{}{
+	&models.Note{},
+	&models.NoteTombstone{},
+	&models.NoteRevision{},
+	&models.NoteLink{},
+	&models.Reminder{},
+	&models.Template{},
+	&models.PropertySchema{},
+	&models.EventLogEntry{},
+	&models.Webhook{},
+	&models.Job{},
+	&models.Session{},
+}
+
+// Delete disables a user's account in tx and removes everything it stores
+// in the database, unless it is the last active administrator. It returns the files the account stored, to remove with
+// RemoveFiles once tx has committed.
+func Delete(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := KeepAdmin(tx, userID); err != nil {
+		return nil, err
+	}
+	var files []string
+	now := time.Now()
+	res := tx.Model(&models.User{}).Where("id = ? AND deleted_at IS NULL", userID).Update("deleted_at", now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if err := tx.Model(&models.Note{}).Where("user_id = ? AND image_path <> ''", userID).
+		Pluck("image_path", &files).Error; err != nil {
+		return nil, err
+	}
+	var userJobs []models.Job
+	if err := tx.Where("user_id = ?", userID).Find(&userJobs).Error; err != nil {
+		return nil, err
+	}
+	for i := range userJobs {
+		files = append(files, jobs.Path(&userJobs[i]), jobs.InputPath(&userJobs[i]))
+	}
+
+	notes := tx.Model(&models.Note{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("note_id IN (?)", notes).Delete(&models.ChecklistItem{}).Error; err != nil {
+		return nil, err
+	}
+	webhooks := tx.Model(&models.Webhook{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("webhook_id IN (?)", webhooks).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return nil, err
+	}
+	userJobIDs := tx.Model(&models.Job{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("job_id IN (?)", userJobIDs).Delete(&models.ImportedNote{}).Error; err != nil {
+		return nil, err
+	}
+	for _, table := range userTables {
+		if err := tx.Where("user_id = ?", userID).Delete(table).Error; err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// RemoveFiles removes the files of the deleted account userID. A file that
+// cannot be removed is logged and left behind.
+func RemoveFiles(userID uuid.UUID, files []string) {
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove %s of deleted account %s: %v", file, userID, err)
+		}
+	}
+}
+
+// anonymize scrubs the name, email and password of accounts deleted more
+// than GracePeriod before now. The email is replaced with a unique address
+// that cannot receive mail, which also frees the original for a new account.
+// Audit log entries keep referring to the account by ID only.
+func anonymize(now time.Time) error {
+	cutoff := now.Add(-GracePeriod)
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// Audit entries of administrators' actions outlive their accounts,
+		// but not where they acted from
+		due := tx.Model(&models.User{}).Select("id").Where("deleted_at < ? AND anonymized_at IS NULL", cutoff)
+		if err := tx.Model(&models.AuditLogEntry{}).Where("actor_id IN (?)", due).Update("ip", "").Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("deleted_at < ? AND anonymized_at IS NULL", cutoff).Updates(map[string]interface{}{
+			"email":         gorm.Expr("'deleted-' || id || '@deleted.invalid'"),
+			"name":          "Deleted user",
+			"password":      "",
+			"anonymized_at": now,
+		}).Error
+	})
+}
@@ -0,0 +1,77 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"notes-api/mailer"
+	"notes-api/models"
+)
+
+// EmailTokenLifetime is how long the link confirming a new email address
+// stays valid.
+const EmailTokenLifetime = 24 * time.Hour
+
+// NormalizeEmail returns email as accounts store and look it up: trimmed and
+// lowercased.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NewToken returns a random token to send to the user, and its hash to store
+// in its place.
+func NewToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = hex.EncodeToString(b)
+	return token, HashToken(token)
+}
+
+// HashToken returns the hash under which a token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// link returns the address of path in the web app, set in APP_URL, with
+// token as a query parameter. Without APP_URL it returns "".
+func link(path, token string) string {
+	base := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if base == "" {
+		return ""
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// SendEmailConfirmation mails the token confirming user.PendingEmail to that
+// address. When it is the account's current address, the email asks to
+// verify it rather than to switch to it.
+func SendEmailConfirmation(user *models.User, token string) error {
+	action := "enter this code in the app:\n\n" + token
+	if href := link("/confirm-email", token); href != "" {
+		action = "open this link:\n\n" + href
+	}
+	purpose, subject := "To use this address for your Notes account", "Confirm your new email address"
+	if user.PendingEmail == user.Email {
+		purpose, subject = "To verify the email address of your Notes account", "Verify your email address"
+	}
+	body := fmt.Sprintf("Hi %s,\n\n%s, %s\n\n"+
+		"This expires in %d hours. If you did not ask for this, ignore this email and nothing will change.\n",
+		user.Name, purpose, action, int(EmailTokenLifetime.Hours()))
+	return mailer.Send(user.PendingEmail, subject, body)
+}
+
+// SendEmailChanged tells the previous address of user that the account's
+// email address was changed.
+func SendEmailChanged(previous string, user *models.User) error {
+	body := fmt.Sprintf("Hi %s,\n\nThe email address of your Notes account was changed to %s.\n\n"+
+		"If you did not do this, change your password and contact support right away.\n",
+		user.Name, user.Email)
+	return mailer.Send(previous, "Your email address was changed", body)
+}
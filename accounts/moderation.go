@@ -0,0 +1,205 @@
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"notes-api/database"
+	"notes-api/mailer"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PasswordResetLifetime is how long the link to set a new password after a
+// forced reset stays valid. An administrator can send a new one.
+const PasswordResetLifetime = 72 * time.Hour
+
+// adminLock serializes changes that could leave no administrator across
+// replicas.
+const adminLock = 4829170356
+
+// ErrLastAdmin is returned for changes that would leave no active
+// administrator.
+var ErrLastAdmin = errors.New("the last active administrator cannot be removed")
+
+// activeAdmin selects administrators that can log in.
+const activeAdmin = "role = 'admin' AND deleted_at IS NULL AND disabled_at IS NULL AND password <> ''"
+
+// KeepAdmin fails with ErrLastAdmin if userID is the only active
+// administrator, before tx disables, demotes, resets or deletes it. It holds
+// a lock until tx ends, so two administrators removing each other at the
+// same time cannot both succeed.
+func KeepAdmin(tx *gorm.DB, userID uuid.UUID) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", adminLock).Error; err != nil {
+		return err
+	}
+	var counts struct{ Target, Others int64 }
+	if err := tx.Model(&models.User{}).Where(activeAdmin).
+		Select("COUNT(*) FILTER (WHERE id = ?) AS target, COUNT(*) FILTER (WHERE id <> ?) AS others", userID, userID).
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	if counts.Target > 0 && counts.Others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// Disable blocks the account userID for reason in tx and logs it out
+// everywhere.
+func Disable(tx *gorm.DB, userID uuid.UUID, reason string) error {
+	if err := KeepAdmin(tx, userID); err != nil {
+		return err
+	}
+	res := tx.Model(&models.User{}).Where("id = ? AND deleted_at IS NULL", userID).
+		Updates(map[string]interface{}{"disabled_at": time.Now(), "disabled_reason": reason})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	_, err := EndSessions(tx, userID, uuid.Nil)
+	return err
+}
+
+// Enable lifts the block on the account userID in tx.
+func Enable(tx *gorm.DB, userID uuid.UUID) error {
+	res := tx.Model(&models.User{}).Where("id = ? AND deleted_at IS NULL", userID).
+		Updates(map[string]interface{}{"disabled_at": nil, "disabled_reason": ""})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetRole gives the account userID role in tx.
+func SetRole(tx *gorm.DB, userID uuid.UUID, role string) error {
+	if role != models.RoleAdmin {
+		if err := KeepAdmin(tx, userID); err != nil {
+			return err
+		}
+	}
+	res := tx.Model(&models.User{}).Where("id = ? AND deleted_at IS NULL", userID).Update("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ForcePasswordReset clears user's password in tx and logs them out
+// everywhere. It returns the token that sets a new password, to send with
+// SendPasswordReset once tx has committed.
+func ForcePasswordReset(tx *gorm.DB, user *models.User) (string, error) {
+	if err := KeepAdmin(tx, user.ID); err != nil {
+		return "", err
+	}
+	token, hash := NewToken()
+	expires := time.Now().Add(PasswordResetLifetime)
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":                  "",
+		"token_version":             gorm.Expr("token_version + 1"),
+		"password_reset_token_hash": hash,
+		"password_reset_expires_at": expires,
+	}).Error; err != nil {
+		return "", err
+	}
+	if _, err := EndSessions(tx, user.ID, uuid.Nil); err != nil {
+		return "", err
+	}
+	user.PasswordResetTokenHash = hash
+	return token, nil
+}
+
+// SendPasswordReset emails user the link to choose a new password after a
+// forced reset.
+func SendPasswordReset(user *models.User, token string) error {
+	action := "enter this code in the app:\n\n" + token
+	if href := link("/reset-password", token); href != "" {
+		action = "open this link:\n\n" + href
+	}
+	body := fmt.Sprintf("Hi %s,\n\nThe password of your Notes account has been reset by an administrator, "+
+		"and you have been logged out on all devices. To choose a new password, %s\n\n"+
+		"This expires in %d hours.\n", user.Name, action, int(PasswordResetLifetime.Hours()))
+	return mailer.Send(user.Email, "Choose a new password", body)
+}
+
+// ResetPassword sets password as the password of the account the reset
+// token was sent for.
+func ResetPassword(token, password string) error {
+	var user models.User
+	err := database.DB.Where("password_reset_token_hash = ? AND password_reset_expires_at > ? AND deleted_at IS NULL",
+		HashToken(token), time.Now()).First(&user).Error
+	if err != nil {
+		return err
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashed)
+	user.PasswordResetTokenHash = ""
+	// The token was emailed, so following it also proves the address
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"password":                  user.Password,
+		"password_reset_token_hash": "",
+		"password_reset_expires_at": nil,
+		"email_verified_at":         gorm.Expr("COALESCE(email_verified_at, now())"),
+	}).Error; err != nil {
+		return err
+	}
+	if err := LoginSucceeded(user.Email, ""); err != nil {
+		log.Printf("Failed to reset failed logins of user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// BootstrapAdmins makes the accounts with the given email addresses
+// administrators, for setting up the first ones. It does nothing once any
+// administrator exists, so demoting one sticks and an address that changes
+// hands later is not promoted, and it only promotes accounts that have
+// verified their address. It returns how many accounts it promoted.
+func BootstrapAdmins(emails []string) (int64, error) {
+	var addresses []string
+	for _, email := range emails {
+		if email = NormalizeEmail(email); email != "" {
+			addresses = append(addresses, email)
+		}
+	}
+	if len(addresses) == 0 {
+		return 0, nil
+	}
+
+	var promoted int64
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", adminLock).Error; err != nil {
+			return err
+		}
+		var admins int64
+		if err := tx.Model(&models.User{}).Where("role = ? AND deleted_at IS NULL", models.RoleAdmin).
+			Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins > 0 {
+			return nil
+		}
+		res := tx.Model(&models.User{}).
+			Where("LOWER(email) IN ? AND email_verified_at IS NOT NULL AND deleted_at IS NULL", addresses).
+			Update("role", models.RoleAdmin)
+		promoted = res.RowsAffected
+		return res.Error
+	})
+	return promoted, err
+}
@@ -0,0 +1,108 @@
+package accounts
+
+import (
+	"strings"
+	"time"
+
+	"notes-api/database"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TokenLifetime is how long a token, and the session it belongs to, lasts.
+const TokenLifetime = 7 * 24 * time.Hour
+
+// maxDeviceName is the longest device name kept, in runes.
+const maxDeviceName = 100
+
+// StartSession records a new session for user on the device that sent
+// userAgent from ip. deviceName is the name the client gave; without one it
+// is made up from userAgent.
+func StartSession(db *gorm.DB, userID uuid.UUID, deviceName, userAgent, ip string) (*models.Session, error) {
+	deviceName = strings.TrimSpace(deviceName)
+	if deviceName == "" {
+		deviceName = DeviceName(userAgent)
+	}
+	if runes := []rune(deviceName); len(runes) > maxDeviceName {
+		deviceName = string(runes[:maxDeviceName])
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:     userID,
+		DeviceName: deviceName,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(TokenLifetime),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// EndSessions revokes every session of user except the one with ID except,
+// which may be uuid.Nil, and returns how many were revoked.
+func EndSessions(db *gorm.DB, userID, except uuid.UUID) (int64, error) {
+	res := db.Where("user_id = ? AND id <> ?", userID, except).Delete(&models.Session{})
+	return res.RowsAffected, res.Error
+}
+
+// DeviceName describes the device that sent userAgent, such as "Firefox on
+// Windows", for clients that do not name themselves.
+func DeviceName(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		// Order matters: Edge and Opera also claim to be Chrome, and Chrome
+		// claims to be Safari
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"firefox/", "Firefox"},
+		{"chrome/", "Chrome"},
+		{"crios/", "Chrome"},
+		{"safari/", "Safari"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, o := range []struct{ token, name string }{
+		{"android", "Android"},
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"windows", "Windows"},
+		{"mac os x", "macOS"},
+		{"cros", "ChromeOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			system = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	// Other clients usually start with their name, as in curl/8.0
+	product, _, _ := strings.Cut(userAgent, "/")
+	if product = strings.TrimSpace(product); product != "" && product != "Mozilla" {
+		return product
+	}
+	return "Unknown device"
+}
+
+// pruneSessions deletes sessions whose token has expired.
+func pruneSessions(now time.Time) error {
+	return database.DB.Where("expires_at < ?", now).Delete(&models.Session{}).Error
+}
@@ -0,0 +1,112 @@
+package accounts
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"notes-api/database"
+	"notes-api/jobs"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// uploadsDir is where uploaded images are stored.
+const uploadsDir = "uploads"
+
+// textBytes sums the size of the titles and content of notes or revisions.
+const textBytes = "COUNT(*) AS count, COALESCE(SUM(octet_length(title) + octet_length(content)), 0) AS bytes"
+
+// Storage returns what the account userID stores.
+func Storage(userID uuid.UUID) (models.StorageUsage, error) {
+	var usage models.StorageUsage
+	if err := countText(database.DB.Model(&models.Note{}).Where("user_id = ?", userID), &usage.Notes, &usage.NoteBytes); err != nil {
+		return usage, err
+	}
+	if err := countText(database.DB.Model(&models.NoteRevision{}).Where("user_id = ?", userID), &usage.Revisions, &usage.RevisionBytes); err != nil {
+		return usage, err
+	}
+
+	var images []string
+	if err := database.DB.Model(&models.Note{}).Where("user_id = ? AND image_path <> ''", userID).
+		Pluck("image_path", &images).Error; err != nil {
+		return usage, err
+	}
+	usage.Uploads, usage.UploadBytes = fileSizes(images)
+
+	var userJobs []models.Job
+	if err := database.DB.Where("user_id = ?", userID).Find(&userJobs).Error; err != nil {
+		return usage, err
+	}
+	var files []string
+	for i := range userJobs {
+		files = append(files, jobs.Path(&userJobs[i]), jobs.InputPath(&userJobs[i]))
+	}
+	usage.JobFiles, usage.JobFileBytes = fileSizes(files)
+
+	usage.TotalBytes = usage.NoteBytes + usage.RevisionBytes + usage.UploadBytes + usage.JobFileBytes
+	return usage, nil
+}
+
+// TotalStorage returns what all accounts store together, counting every
+// file on disk, and the limit accounts storing the most in the database.
+func TotalStorage(limit int) (models.StorageUsage, []models.UserStorage, error) {
+	var usage models.StorageUsage
+	if err := countText(database.DB.Model(&models.Note{}), &usage.Notes, &usage.NoteBytes); err != nil {
+		return usage, nil, err
+	}
+	if err := countText(database.DB.Model(&models.NoteRevision{}), &usage.Revisions, &usage.RevisionBytes); err != nil {
+		return usage, nil, err
+	}
+	usage.Uploads, usage.UploadBytes = dirSize(uploadsDir)
+	usage.JobFiles, usage.JobFileBytes = dirSize(jobs.Dir)
+	usage.TotalBytes = usage.NoteBytes + usage.RevisionBytes + usage.UploadBytes + usage.JobFileBytes
+
+	top := []models.UserStorage{}
+	err := database.DB.Raw(`
+SELECT u.id AS user_id, u.email, n.notes, n.note_bytes,
+	COALESCE(r.revisions, 0) AS revisions, COALESCE(r.revision_bytes, 0) AS revision_bytes
+FROM users u
+JOIN (SELECT user_id, `+textBytes+` FROM notes GROUP BY user_id) AS n (user_id, notes, note_bytes) ON n.user_id = u.id
+LEFT JOIN (SELECT user_id, `+textBytes+` FROM note_revisions GROUP BY user_id) AS r (user_id, revisions, revision_bytes) ON r.user_id = u.id
+ORDER BY n.note_bytes + COALESCE(r.revision_bytes, 0) DESC
+LIMIT ?`, limit).Scan(&top).Error
+	return usage, top, err
+}
+
+func countText(query *gorm.DB, count, bytes *int64) error {
+	var total struct{ Count, Bytes int64 }
+	if err := query.Select(textBytes).Scan(&total).Error; err != nil {
+		return err
+	}
+	*count, *bytes = total.Count, total.Bytes
+	return nil
+}
+
+// fileSizes returns how many of paths exist and their total size.
+func fileSizes(paths []string) (count, size int64) {
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			count++
+			size += info.Size()
+		}
+	}
+	return count, size
+}
+
+// dirSize returns the number and total size of the files under dir.
+func dirSize(dir string) (count, size int64) {
+	filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			count++
+			size += info.Size()
+		}
+		return nil
+	})
+	return count, size
+}
@@ -0,0 +1,257 @@
+package accounts
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"notes-api/database"
+	"notes-api/mailer"
+	"notes-api/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// failureWindow is how long a failed login counts against its key.
+	failureWindow = time.Hour
+	// pendingTimeout is how long a reserved attempt counts if it is never
+	// released, as when the server stops while checking it.
+	pendingTimeout = time.Minute
+)
+
+// throttlePolicy sets how failed logins slow down further attempts.
+type throttlePolicy struct {
+	free      int           // failures before attempts are delayed
+	lockAfter int           // failures that lock the key out
+	delay     time.Duration // first delay, doubling with each failure
+	lockout   time.Duration
+}
+
+// An email address is locked out after a handful of failures, since nobody
+// mistypes their password ten times in an hour. Many people can share an IP,
+// so it gets more room; it stops password spraying across accounts.
+var (
+	emailPolicy = throttlePolicy{free: 3, lockAfter: 10, delay: time.Second, lockout: time.Hour}
+	ipPolicy    = throttlePolicy{free: 20, lockAfter: 100, delay: time.Second, lockout: 15 * time.Minute}
+)
+
+// wait returns how long attempts must wait after failures failures, and
+// whether the key is locked out.
+func (p throttlePolicy) wait(failures int) (time.Duration, bool) {
+	if failures >= p.lockAfter {
+		return p.lockout, true
+	}
+	if failures <= p.free {
+		return 0, false
+	}
+	// Doubling stops at the lockout, before the shift could overflow
+	wait := p.delay
+	for i := p.free + 1; i < failures && wait < p.lockout; i++ {
+		wait *= 2
+	}
+	if wait > p.lockout {
+		wait = p.lockout
+	}
+	return wait, false
+}
+
+// dummyHash is compared against when a login names no account, so that
+// unknown email addresses take as long to reject as wrong passwords.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// CheckPassword reports whether password is user's password. user may be nil
+// for an unknown account; the check then fails in the same time.
+func CheckPassword(user *models.User, password string) bool {
+	hash := dummyHash
+	if user != nil {
+		hash = []byte(user.Password)
+	}
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	return err == nil && user != nil
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// ReserveLogin reserves an attempt to log in to email from ip, or returns
+// how long it must wait because of earlier failures. Until the attempt is
+// released with LoginFailed or LoginSucceeded it counts as a failure, so
+// attempts made at the same time cannot get past the limits together.
+func ReserveLogin(email, ip string) (time.Duration, error) {
+	keys := map[string]throttlePolicy{emailKey(email): emailPolicy, ipKey(ip): ipPolicy}
+	var wait time.Duration
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var rows []models.LoginThrottle
+		for key := range keys {
+			rows = append(rows, models.LoginThrottle{Key: key})
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+			return err
+		}
+		var throttles []models.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key IN ?", keysOf(keys)).
+			Order("key").Find(&throttles).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for i := range throttles {
+			t := &throttles[i]
+			expire(t, now)
+			if until := t.BlockedUntil.Sub(now); until > wait {
+				wait = until
+			}
+			// Were the attempts in progress to fail, this one would have
+			// to wait
+			policy := keys[t.Key]
+			if t.Pending > 0 {
+				if pendingWait, _ := policy.wait(t.Failures + t.Pending); pendingWait > 0 && policy.delay > wait {
+					wait = policy.delay
+				}
+			}
+		}
+		if wait > 0 {
+			return nil
+		}
+		for i := range throttles {
+			throttles[i].Pending++
+			throttles[i].PendingAt = now
+			if err := tx.Save(&throttles[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return wait, err
+}
+
+func keysOf(keys map[string]throttlePolicy) []string {
+	list := make([]string, 0, len(keys))
+	for key := range keys {
+		list = append(list, key)
+	}
+	return list
+}
+
+// expire forgets failures after a while, and once a lockout is over, and
+// reserved attempts that were never released.
+func expire(t *models.LoginThrottle, now time.Time) {
+	if now.Sub(t.LastFailureAt) > failureWindow || (t.Locked && now.After(t.BlockedUntil)) {
+		t.Failures, t.Locked, t.UnlockTokenHash = 0, false, ""
+	}
+	if now.Sub(t.PendingAt) > pendingTimeout {
+		t.Pending = 0
+	}
+}
+
+// LoginFailed records the failure of an attempt reserved with ReserveLogin.
+// user is the account the email belongs to, if any; when the failure locks
+// it out, its owner is emailed a link to unlock it.
+func LoginFailed(email, ip string, user *models.User) error {
+	if _, err := fail(ipKey(ip), ipPolicy); err != nil {
+		return err
+	}
+	locked, err := fail(emailKey(email), emailPolicy)
+	if err != nil || locked == nil || user == nil {
+		return err
+	}
+	if err := sendUnlock(user, locked); err != nil {
+		log.Printf("Failed to send unlock email to user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// fail counts a failure against key in place of the attempt reserved for it.
+// When the key is locked out by it, the returned throttle carries the token
+// that unlocks it.
+func fail(key string, policy throttlePolicy) (*lockedThrottle, error) {
+	var locked *lockedThrottle
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Key: key}).Error; err != nil {
+			return err
+		}
+		var t models.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&t).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		expire(&t, now)
+		if t.Pending > 0 {
+			t.Pending--
+		}
+		t.Failures++
+		t.LastFailureAt = now
+		wait, lock := policy.wait(t.Failures)
+		t.BlockedUntil = now.Add(wait)
+		if lock && !t.Locked {
+			t.Locked = true
+			token, hash := NewToken()
+			t.UnlockTokenHash = hash
+			locked = &lockedThrottle{token: token, until: t.BlockedUntil}
+		}
+		return tx.Save(&t).Error
+	})
+	return locked, err
+}
+
+// lockedThrottle is a key that was just locked out.
+type lockedThrottle struct {
+	token string
+	until time.Time
+}
+
+// LoginSucceeded forgets the failed logins to email and releases the attempt
+// reserved from ip. ip is empty when no attempt was reserved.
+func LoginSucceeded(email, ip string) error {
+	if err := database.DB.Where("key = ?", emailKey(email)).Delete(&models.LoginThrottle{}).Error; err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return database.DB.Model(&models.LoginThrottle{}).Where("key = ? AND pending > 0", ipKey(ip)).
+		UpdateColumn("pending", gorm.Expr("pending - 1")).Error
+}
+
+// Unlock lifts the lockout of the email address token was sent for.
+func Unlock(token string) error {
+	res := database.DB.Where("unlock_token_hash = ? AND locked AND blocked_until > ?", HashToken(token), time.Now()).
+		Delete(&models.LoginThrottle{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func sendUnlock(user *models.User, locked *lockedThrottle) error {
+	action := "enter this code in the app to log in again right away:\n\n" + locked.token
+	if href := link("/unlock", locked.token); href != "" {
+		action = "open this link to log in again right away:\n\n" + href
+	}
+	minutes := int(time.Until(locked.until).Round(time.Minute).Minutes())
+	body := fmt.Sprintf("Hi %s,\n\nThere were too many failed attempts to log in to your Notes account, "+
+		"so logging in is blocked for %d minutes. If that was you, %s\n\n"+
+		"If it was not you, someone may be guessing your password. It is still safe, "+
+		"but consider changing it to a longer one.\n", user.Name, minutes, action)
+	return mailer.Send(user.Email, "Your account has been locked", body)
+}
+
+// pruneThrottles deletes throttles that no longer block or count.
+func pruneThrottles(now time.Time) error {
+	return database.DB.Where("blocked_until < ? AND last_failure_at < ? AND (pending = 0 OR pending_at < ?)",
+		now, now.Add(-failureWindow), now.Add(-pendingTimeout)).
+		Delete(&models.LoginThrottle{}).Error
+}
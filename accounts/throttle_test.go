@@ -0,0 +1,102 @@
+package accounts
+
+import (
+	"testing"
+	"time"
+
+	"notes-api/models"
+)
+
+func TestThrottleWait(t *testing.T) {
+	policy := throttlePolicy{free: 3, lockAfter: 10, delay: time.Second, lockout: time.Minute}
+	tests := []struct {
+		failures int
+		wait     time.Duration
+		locked   bool
+	}{
+		{failures: 0},
+		{failures: 3},
+		{failures: 4, wait: time.Second},
+		{failures: 5, wait: 2 * time.Second},
+		{failures: 7, wait: 8 * time.Second},
+		{failures: 9, wait: 32 * time.Second},
+		{failures: 10, wait: time.Minute, locked: true},
+		{failures: 50, wait: time.Minute, locked: true},
+	}
+	for _, tt := range tests {
+		wait, locked := policy.wait(tt.failures)
+		if wait != tt.wait || locked != tt.locked {
+			t.Errorf("%d failures: got %s, %v; want %s, %v", tt.failures, wait, locked, tt.wait, tt.locked)
+		}
+	}
+}
+
+func TestThrottleWaitCapped(t *testing.T) {
+	// Delays doubled this often would overflow without the cap
+	for failures := ipPolicy.free + 1; failures < ipPolicy.lockAfter; failures++ {
+		wait, locked := ipPolicy.wait(failures)
+		if locked || wait <= 0 || wait > ipPolicy.lockout {
+			t.Fatalf("%d failures: got %s, %v", failures, wait, locked)
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		throttle models.LoginThrottle
+		failures int
+		locked   bool
+		pending  int
+	}{
+		{
+			name:     "recent failures",
+			throttle: models.LoginThrottle{Failures: 5, LastFailureAt: now.Add(-time.Minute)},
+			failures: 5,
+		},
+		{
+			name:     "old failures",
+			throttle: models.LoginThrottle{Failures: 5, LastFailureAt: now.Add(-2 * failureWindow)},
+		},
+		{
+			name: "lockout in progress",
+			throttle: models.LoginThrottle{Failures: 10, Locked: true,
+				LastFailureAt: now.Add(-time.Minute), BlockedUntil: now.Add(time.Minute)},
+			failures: 10,
+			locked:   true,
+		},
+		{
+			name: "lockout over",
+			throttle: models.LoginThrottle{Failures: 10, Locked: true,
+				LastFailureAt: now.Add(-time.Minute), BlockedUntil: now.Add(-time.Second)},
+		},
+		{
+			name:     "pending attempt",
+			throttle: models.LoginThrottle{Pending: 2, PendingAt: now.Add(-time.Second), LastFailureAt: now},
+			pending:  2,
+		},
+		{
+			name:     "abandoned attempt",
+			throttle: models.LoginThrottle{Pending: 2, PendingAt: now.Add(-2 * pendingTimeout), LastFailureAt: now},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := tt.throttle
+			expire(&throttle, now)
+			if throttle.Failures != tt.failures || throttle.Locked != tt.locked || throttle.Pending != tt.pending {
+				t.Errorf("got %d failures, locked %v, %d pending", throttle.Failures, throttle.Locked, throttle.Pending)
+			}
+		})
+	}
+}
+
+func TestEmailKey(t *testing.T) {
+	if a, b := emailKey(" Someone@Example.com"), emailKey("someone@example.com"); a != b {
+		t.Errorf("%q and %q differ", a, b)
+	}
+	if emailKey("1.2.3.4") == ipKey("1.2.3.4") {
+		t.Error("email and IP keys collide")
+	}
+}
@@ -6,26 +6,31 @@ import (
 	"os"
 
 	"notes-api/models"
+	"notes-api/templates"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
-func Connect() {
+// DSN builds the Postgres connection string from the environment.
+func DSN() string {
 	host := os.Getenv("DB_HOST")
 	user := os.Getenv("DB_USER")
 	password := os.Getenv("DB_PASSWORD")
 	dbname := os.Getenv("DB_NAME")
 	port := os.Getenv("DB_PORT")
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC",
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=UTC",
 		host, user, password, dbname, port)
+}
 
+func Connect() {
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+	DB, err = gorm.Open(postgres.Open(DSN()), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 
@@ -37,9 +42,32 @@ func Connect() {
 }
 
 func Migrate() {
-	err := DB.AutoMigrate(&models.User{}, &models.Note{})
+	if err := DB.Exec("CREATE SEQUENCE IF NOT EXISTS " + models.ChangeSeqName).Error; err != nil {
+		log.Fatal("Failed to create change sequence:", err)
+	}
+
+	err := DB.AutoMigrate(&models.User{}, &models.Note{}, &models.NoteTombstone{}, &models.EventLogEntry{},
+		&models.NoteRevision{}, &models.Webhook{}, &models.WebhookDelivery{},
+		&models.ChecklistItem{}, &models.Reminder{}, &models.NoteLink{}, &models.Template{},
+		&models.PropertySchema{}, &models.Job{}, &models.LoginThrottle{}, &models.RateLimitBucket{},
+		&models.Session{}, &models.SigningKey{}, &models.AuditLogEntry{}, &models.ImportedNote{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+
+	// Email addresses are looked up regardless of case
+	if err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))").Error; err != nil {
+		log.Fatal("Failed to index email addresses:", err)
+	}
+
+	// Notes created before delta sync existed have no change sequence yet
+	if err := DB.Exec("UPDATE notes SET change_seq = nextval('" + models.ChangeSeqName + "') WHERE change_seq = 0").Error; err != nil {
+		log.Fatal("Failed to backfill change sequence:", err)
+	}
+
+	// System templates are kept in sync with the code
+	if err := DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&templates.System).Error; err != nil {
+		log.Fatal("Failed to seed system templates:", err)
+	}
 	log.Println("Database migration completed")
 }
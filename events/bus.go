@@ -0,0 +1,161 @@
+// Package events fans out note change events to connected clients. Events
+// are recorded in an event log, delivered in-process and, through Postgres
+// LISTEN/NOTIFY, to every other replica sharing the database.
+package events
+
+import (
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"notes-api/models"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	NoteCreated = "note.created"
+	NoteUpdated = "note.updated"
+	NoteDeleted = "note.deleted"
+	ReminderDue = "reminder.due"
+)
+
+// Types lists every event type clients can subscribe to.
+var Types = []string{NoteCreated, NoteUpdated, NoteDeleted, ReminderDue}
+
+// Event describes a change to a note, or a reminder on it coming due. Note is
+// omitted for deletions. ID identifies the event; together with XID, the
+// transaction that recorded it, it orders the event log and is used to
+// resume after a disconnect.
+type Event struct {
+	ID        int64            `json:"id"`
+	XID       int64            `json:"-"`
+	Type      string           `json:"type"`
+	UserID    uuid.UUID        `json:"-"`
+	NoteID    uuid.UUID        `json:"note_id"`
+	Note      *models.Note     `json:"note,omitempty"`
+	Reminder  *models.Reminder `json:"reminder,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// Position returns the position of the event in the event log.
+func (e Event) Position() models.Change {
+	return models.Change{XID: e.XID, Seq: e.ID}
+}
+
+// Realtime reports whether the event goes to WebSocket and SSE clients.
+// Reminders only do when they were set up for the realtime channel.
+func (e Event) Realtime() bool {
+	return e.Reminder == nil || e.Reminder.Notifies(models.ChannelRealtime)
+}
+
+// Snapshot copies a note for an event payload. The image URL is made
+// host-relative since events are not tied to a request; consumers resolve it
+// against the host they serve.
+func Snapshot(note *models.Note) *models.Note {
+	copied := *note
+	copied.ImageURL = ""
+	if copied.ImagePath != "" {
+		copied.ImageURL = "/uploads/" + filepath.Base(copied.ImagePath)
+	}
+	return &copied
+}
+
+// subscriptionBuffer is how many events a slow subscriber may fall behind
+// before it is dropped.
+const subscriptionBuffer = 64
+
+// Subscription receives the events of one user until it is closed. C is
+// closed when the subscription ends, including when the subscriber falls too
+// far behind.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	userID uuid.UUID
+	once   sync.Once
+}
+
+var (
+	mu    sync.RWMutex
+	subs  = map[uuid.UUID]map[*Subscription]struct{}{}
+	hooks []func(Event)
+)
+
+// OnPublish registers fn to be called with every event published by this
+// replica, after it has been recorded. Register hooks during startup only.
+func OnPublish(fn func(Event)) {
+	hooks = append(hooks, fn)
+}
+
+// Subscribe starts receiving events for userID.
+func Subscribe(userID uuid.UUID) *Subscription {
+	ch := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: ch, ch: ch, userID: userID}
+
+	mu.Lock()
+	if subs[userID] == nil {
+		subs[userID] = map[*Subscription]struct{}{}
+	}
+	subs[userID][sub] = struct{}{}
+	mu.Unlock()
+
+	return sub
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		mu.Lock()
+		delete(subs[s.userID], s)
+		if len(subs[s.userID]) == 0 {
+			delete(subs, s.userID)
+		}
+		mu.Unlock()
+		close(s.ch)
+	})
+}
+
+// Publish records an event, delivers it to local subscribers and notifies
+// other replicas.
+func Publish(event Event) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if err := record(&event); err != nil {
+		log.Println("Failed to record event:", err)
+	}
+	deliver(event)
+	if event.ID != 0 {
+		notify(event)
+	}
+	for _, hook := range hooks {
+		hook(event)
+	}
+}
+
+// hasSubscribers reports whether anyone on this replica listens to userID.
+func hasSubscribers(userID uuid.UUID) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(subs[userID]) > 0
+}
+
+func deliver(event Event) {
+	var lagging []*Subscription
+
+	mu.RLock()
+	for sub := range subs[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			lagging = append(lagging, sub)
+		}
+	}
+	mu.RUnlock()
+
+	for _, sub := range lagging {
+		sub.Close()
+	}
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"notes-api/database"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+)
+
+// defaultRetention is how long events are kept when EVENT_RETENTION is unset.
+const defaultRetention = 7 * 24 * time.Hour
+
+func record(event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	entry := models.EventLogEntry{
+		UserID:    event.UserID,
+		Type:      event.Type,
+		Payload:   payload,
+		CreatedAt: event.CreatedAt,
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		return err
+	}
+	// The stored payload has no ID; decode takes it from the row
+	event.ID, event.XID = entry.ID, entry.ChangeXID
+	return nil
+}
+
+func decode(entry models.EventLogEntry) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(entry.Payload, &event); err != nil {
+		return event, err
+	}
+	event.ID, event.XID = entry.ID, entry.ChangeXID
+	event.UserID = entry.UserID
+	return event, nil
+}
+
+// Since returns up to limit events of userID recorded after position after,
+// in log order. Events whose transaction could still be followed by an
+// earlier one committing are held back, so resuming from the last event
+// returned never skips one.
+func Since(userID uuid.UUID, after models.Change, limit int) ([]Event, error) {
+	horizon, err := models.SafeXID(database.DB)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.EventLogEntry
+	if err := database.DB.Where("user_id = ? AND (change_xid, id) > (?, ?) AND change_xid < ?",
+		userID, after.XID, after.Seq, horizon).
+		Order("change_xid, id").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Event, 0, len(entries))
+	for _, entry := range entries {
+		event, err := decode(entry)
+		if err != nil {
+			log.Printf("Skipping undecodable event %d: %v", entry.ID, err)
+			continue
+		}
+		result = append(result, event)
+	}
+	return result, nil
+}
+
+// Expired reports whether events after afterID may already have been pruned,
+// in which case a client resuming from afterID has to resynchronize.
+func Expired(afterID int64) (bool, error) {
+	var oldest *int64
+	if err := database.DB.Model(&models.EventLogEntry{}).Select("MIN(id)").Scan(&oldest).Error; err != nil {
+		return false, err
+	}
+	return oldest != nil && afterID+1 < *oldest, nil
+}
+
+// Retention returns how long events are kept, from EVENT_RETENTION.
+func Retention() time.Duration {
+	if value := os.Getenv("EVENT_RETENTION"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Invalid EVENT_RETENTION %q, using %s", value, defaultRetention)
+	}
+	return defaultRetention
+}
+
+// Prune periodically deletes events older than the retention period. It
+// never returns.
+func Prune() {
+	retention := Retention()
+	for {
+		cutoff := time.Now().Add(-retention)
+		if err := database.DB.Where("created_at < ?", cutoff).Delete(&models.EventLogEntry{}).Error; err != nil {
+			log.Println("Failed to prune event log:", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"notes-api/database"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// channel is the Postgres notification channel shared by all replicas.
+const channel = "note_events"
+
+// origin identifies this process so it can ignore its own notifications.
+var origin = uuid.New()
+
+// notification is the NOTIFY payload. Payloads are limited to 8000 bytes, so
+// it only identifies the event; receivers load it from the event log.
+type notification struct {
+	Origin  uuid.UUID `json:"origin"`
+	EventID int64     `json:"event_id"`
+	UserID  uuid.UUID `json:"user_id"`
+}
+
+func notify(event Event) {
+	payload, err := json.Marshal(notification{
+		Origin:  origin,
+		EventID: event.ID,
+		UserID:  event.UserID,
+	})
+	if err != nil {
+		log.Println("Failed to encode event notification:", err)
+		return
+	}
+	if err := database.DB.Exec("SELECT pg_notify(?, ?)", channel, string(payload)).Error; err != nil {
+		log.Println("Failed to send event notification:", err)
+	}
+}
+
+// Listen receives notifications from other replicas and delivers them to
+// local subscribers. It reconnects on failure and never returns.
+func Listen(dsn string) {
+	backoff := time.Second
+	for {
+		err := listen(dsn)
+		log.Printf("Event listener disconnected: %v; retrying in %s", err, backoff)
+		time.Sleep(backoff)
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+func listen(dsn string) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	log.Println("Listening for note events from other replicas")
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var msg notification
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			log.Println("Ignoring malformed event notification:", err)
+			continue
+		}
+		if msg.Origin == origin || !hasSubscribers(msg.UserID) {
+			continue
+		}
+
+		var entry models.EventLogEntry
+		if err := database.DB.Where("id = ?", msg.EventID).First(&entry).Error; err != nil {
+			log.Printf("Failed to load event %d: %v", msg.EventID, err)
+			continue
+		}
+		event, err := decode(entry)
+		if err != nil {
+			log.Printf("Skipping undecodable event %d: %v", entry.ID, err)
+			continue
+		}
+		deliver(event)
+	}
+}
@@ -0,0 +1,243 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"notes-api/database"
+	"notes-api/jobs"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UploadsDir is the folder of an account archive that holds uploaded files.
+const UploadsDir = "uploads"
+
+// AccountSummary counts what an account archive contains.
+type AccountSummary struct {
+	Notes     int `json:"notes"`
+	Revisions int `json:"revisions"`
+	Uploads   int `json:"uploads"`
+}
+
+// accountRecord is the user record as written to an account archive.
+type accountRecord struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// exportedNote is a note as written to an account archive, with the path of
+// its image within the archive.
+type exportedNote struct {
+	models.Note
+	Image string `json:"image,omitempty"`
+}
+
+// AccountArchiveName is the file name of an account archive made at t.
+func AccountArchiveName(t time.Time) string {
+	return "account-" + t.UTC().Format("2006-01-02") + ".zip"
+}
+
+// AccountArchive writes everything stored for userID to w as a ZIP archive
+// of JSON files: account.json with the user record, notes.json with every
+// note and its checklist items, revisions.json, and the user's reminders,
+// templates, property schemas and webhooks. Uploaded images are stored in
+// UploadsDir and referenced from their note's "image" field.
+func AccountArchive(w io.Writer, db *gorm.DB, userID uuid.UUID) (AccountSummary, error) {
+	var summary AccountSummary
+	zw := zip.NewWriter(w)
+
+	var user models.User
+	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return summary, err
+	}
+	err := writeJSON(zw, "account.json", accountRecord{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	notes, err := newJSONArray(zw, "notes.json")
+	if err != nil {
+		return summary, err
+	}
+	var batch []models.Note
+	err = db.Where("user_id = ?", userID).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		if err := loadChecklists(db, batch); err != nil {
+			return err
+		}
+		for i := range batch {
+			note := exportedNote{Note: batch[i]}
+			if note.ImagePath != "" {
+				name, err := writeUpload(zw, &note.Note)
+				if err != nil {
+					return err
+				}
+				if name != "" {
+					note.Image = name
+					summary.Uploads++
+				}
+			}
+			if err := notes.add(note); err != nil {
+				return err
+			}
+			summary.Notes++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return summary, err
+	}
+	if err := notes.close(); err != nil {
+		return summary, err
+	}
+
+	revisions, err := newJSONArray(zw, "revisions.json")
+	if err != nil {
+		return summary, err
+	}
+	var revisionBatch []models.NoteRevision
+	err = db.Where("user_id = ?", userID).FindInBatches(&revisionBatch, batchSize, func(tx *gorm.DB, _ int) error {
+		for i := range revisionBatch {
+			if err := revisions.add(revisionBatch[i]); err != nil {
+				return err
+			}
+			summary.Revisions++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return summary, err
+	}
+	if err := revisions.close(); err != nil {
+		return summary, err
+	}
+
+	tables := []struct {
+		name string
+		dest interface{}
+	}{
+		{"reminders.json", &[]models.Reminder{}},
+		{"templates.json", &[]models.Template{}},
+		{"properties.json", &[]models.PropertySchema{}},
+		{"webhooks.json", &[]models.Webhook{}},
+	}
+	for _, table := range tables {
+		if err := db.Where("user_id = ?", userID).Order("created_at").Find(table.dest).Error; err != nil {
+			return summary, err
+		}
+		if err := writeJSON(zw, table.name, table.dest); err != nil {
+			return summary, err
+		}
+	}
+	return summary, zw.Close()
+}
+
+// AccountExport runs a models.JobAccountExport job, writing everything
+// stored for the user to an account archive.
+func AccountExport(job *models.Job) error {
+	f, err := jobs.Create(job, AccountArchiveName(time.Now()))
+	if err != nil {
+		return err
+	}
+	summary, err := AccountArchive(f, database.DB, job.UserID)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return jobs.SetResult(job, summary)
+}
+
+// writeUpload copies a note's image into UploadsDir of the archive and
+// returns its path there, or "" if the image file is missing.
+func writeUpload(zw *zip.Writer, note *models.Note) (string, error) {
+	src, err := os.Open(note.ImagePath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	name := UploadsDir + "/" + filepath.Base(note.ImagePath)
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: note.UpdatedAt})
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// writeJSON writes v to the archive as an indented JSON file.
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// jsonArray writes a JSON array to the archive one element at a time, so
+// large tables need not be held in memory.
+type jsonArray struct {
+	w io.Writer
+	n int
+}
+
+func newJSONArray(zw *zip.Writer, name string) (*jsonArray, error) {
+	f, err := zw.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(f, "["); err != nil {
+		return nil, err
+	}
+	return &jsonArray{w: f}, nil
+}
+
+func (a *jsonArray) add(v interface{}) error {
+	raw, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := "\n  "
+	if a.n > 0 {
+		sep = ",\n  "
+	}
+	if _, err := io.WriteString(a.w, sep); err != nil {
+		return err
+	}
+	a.n++
+	_, err = a.w.Write(raw)
+	return err
+}
+
+func (a *jsonArray) close() error {
+	end := "]\n"
+	if a.n > 0 {
+		end = "\n]\n"
+	}
+	_, err := io.WriteString(a.w, end)
+	return err
+}
@@ -0,0 +1,202 @@
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"notes-api/models"
+	"notes-api/render"
+)
+
+// Document formats of a single exported note
+const (
+	FormatPDF      = "pdf"
+	FormatHTML     = "html"
+	FormatMarkdown = "md"
+	FormatText     = "txt"
+)
+
+// contentTypes maps each document format to its media type.
+var contentTypes = map[string]string{
+	FormatPDF:      "application/pdf",
+	FormatHTML:     "text/html; charset=utf-8",
+	FormatMarkdown: "text/markdown; charset=utf-8",
+	FormatText:     "text/plain; charset=utf-8",
+}
+
+// imageTypes are the image types that can be embedded in a document.
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// ValidFormat reports whether format is a document format.
+func ValidFormat(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// ContentType returns the media type of a document format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// noteImage is a note's image, read to be embedded in a document.
+type noteImage struct {
+	Data []byte
+	Type string
+}
+
+func (img *noteImage) dataURI() string {
+	return "data:" + img.Type + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// WriteDocument writes a note as a self-contained document in format: its
+// title, content, checklist items and image, which is embedded rather than
+// linked. Plain text cannot carry the image and leaves it out. The note's
+// checklist items must be loaded.
+func WriteDocument(w io.Writer, format string, note *models.Note) error {
+	img, err := readImage(note)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatPDF:
+		return writePDF(w, note, img)
+	case FormatHTML:
+		return writeHTML(w, note, img)
+	case FormatMarkdown:
+		asset := ""
+		if img != nil {
+			asset = img.dataURI()
+		}
+		return WriteMarkdown(w, note, asset)
+	case FormatText:
+		return writeText(w, note)
+	}
+	return fmt.Errorf("unknown document format %q", format)
+}
+
+// readImage reads a note's image, or returns nil if the note has none or it
+// cannot be embedded.
+func readImage(note *models.Note) (*noteImage, error) {
+	if note.ImagePath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(note.ImagePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	img := &noteImage{Data: data, Type: http.DetectContentType(data)}
+	if !imageTypes[img.Type] {
+		return nil, nil
+	}
+	return img, nil
+}
+
+// dateLayout is how documents show when a note was last changed.
+const dateLayout = "2 January 2006 15:04 MST"
+
+var htmlDocument = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 46rem; margin: 2rem auto; padding: 0 1rem; font: 16px/1.6 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2328; }
+h1.title { margin-bottom: .25rem; }
+.meta { color: #59636e; font-size: .875rem; margin-bottom: 2rem; }
+.tag { display: inline-block; padding: 0 .5rem; margin-right: .25rem; border-radius: 1rem; background: #eff2f5; }
+pre { padding: 1rem; overflow: auto; background: #f6f8fa; border-radius: 6px; }
+code { font-family: ui-monospace, Menlo, Consolas, monospace; font-size: .875em; }
+blockquote { margin-left: 0; padding-left: 1rem; border-left: .25rem solid #d1d9e0; color: #59636e; }
+table { border-collapse: collapse; }
+th, td { padding: .25rem .75rem; border: 1px solid #d1d9e0; }
+ul.checklist { list-style: none; padding-left: 0; }
+figure { margin: 2rem 0; }
+figure img { max-width: 100%; }
+@media print { body { margin: 0; max-width: none; } }
+</style>
+</head>
+<body>
+<h1 class="title">{{.Title}}</h1>
+<div class="meta">Updated {{.Updated}}{{range .Tags}} <span class="tag">{{.}}</span>{{end}}</div>
+{{.Content}}
+{{- with .Items}}
+<ul class="checklist">
+{{- range .}}
+<li><input type="checkbox" disabled{{if .Checked}} checked{{end}}> {{.Text}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- with .Image}}
+<figure><img src="{{.}}" alt="{{$.Title}}"></figure>
+{{- end}}
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, note *models.Note, img *noteImage) error {
+	content, err := render.HTML(note.Format, note.Content)
+	if err != nil {
+		return err
+	}
+	data := struct {
+		Title   string
+		Updated string
+		Tags    []string
+		Content template.HTML
+		Items   []models.ChecklistItem
+		Image   template.URL
+	}{
+		Title:   note.Title,
+		Updated: note.UpdatedAt.UTC().Format(dateLayout),
+		Tags:    note.Tags,
+		// render.HTML sanitizes the content
+		Content: template.HTML(content),
+		Items:   note.Items,
+	}
+	if img != nil {
+		data.Image = template.URL(img.dataURI())
+	}
+	return htmlDocument.Execute(w, data)
+}
+
+func writeText(w io.Writer, note *models.Note) error {
+	var buf bytes.Buffer
+	buf.WriteString(note.Title + "\n")
+	buf.WriteString(strings.Repeat("=", len([]rune(note.Title))) + "\n\n")
+	buf.WriteString("Updated: " + note.UpdatedAt.UTC().Format(dateLayout) + "\n")
+	if len(note.Tags) > 0 {
+		buf.WriteString("Tags: " + strings.Join(note.Tags, ", ") + "\n")
+	}
+	if content := strings.TrimSpace(strings.ReplaceAll(note.Content, "\r\n", "\n")); content != "" {
+		buf.WriteString("\n" + content + "\n")
+	}
+	if len(note.Items) > 0 {
+		buf.WriteString("\n")
+		for _, item := range note.Items {
+			buf.WriteString(checkbox(item.Checked) + " " + item.Text + "\n")
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func checkbox(checked bool) string {
+	if checked {
+		return "[x]"
+	}
+	return "[ ]"
+}
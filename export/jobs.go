@@ -0,0 +1,31 @@
+package export
+
+import (
+	"time"
+
+	"notes-api/database"
+	"notes-api/jobs"
+	"notes-api/models"
+)
+
+// ArchiveName is the file name of a notes archive made at t.
+func ArchiveName(t time.Time) string {
+	return "notes-" + t.UTC().Format("2006-01-02") + ".zip"
+}
+
+// NotesExport runs a models.JobNotesExport job, writing the user's notes as
+// a Markdown archive.
+func NotesExport(job *models.Job) error {
+	f, err := jobs.Create(job, ArchiveName(time.Now()))
+	if err != nil {
+		return err
+	}
+	summary, err := MarkdownArchive(f, database.DB, job.UserID)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return jobs.SetResult(job, summary)
+}
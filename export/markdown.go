@@ -0,0 +1,238 @@
+// Package export writes notes out in formats other applications can read.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	batchSize      = 100
+	maxFileNameLen = 80
+
+	// AssetsDir is the folder of the archive that holds note images.
+	AssetsDir = "assets"
+)
+
+// frontMatter is the YAML header of an exported note. Only id, title, tags
+// and the timestamps are always present.
+type frontMatter struct {
+	ID         uuid.UUID              `yaml:"id"`
+	Title      string                 `yaml:"title"`
+	Tags       []string               `yaml:"tags"`
+	Created    time.Time              `yaml:"created"`
+	Updated    time.Time              `yaml:"updated"`
+	Format     string                 `yaml:"format,omitempty"`
+	Type       string                 `yaml:"type,omitempty"`
+	Pinned     bool                   `yaml:"pinned,omitempty"`
+	Starred    bool                   `yaml:"starred,omitempty"`
+	Archived   bool                   `yaml:"archived,omitempty"`
+	Color      string                 `yaml:"color,omitempty"`
+	Properties map[string]interface{} `yaml:"properties,omitempty"`
+}
+
+// Summary counts what an archive contains.
+type Summary struct {
+	Notes  int `json:"notes"`
+	Assets int `json:"assets"`
+}
+
+// MarkdownArchive writes all notes of userID to w as a ZIP archive with one
+// Markdown file per note and the note images in AssetsDir.
+func MarkdownArchive(w io.Writer, db *gorm.DB, userID uuid.UUID) (Summary, error) {
+	var summary Summary
+	zw := zip.NewWriter(w)
+	names := map[string]bool{}
+
+	var batch []models.Note
+	err := db.Where("user_id = ?", userID).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		if err := loadChecklists(db, batch); err != nil {
+			return err
+		}
+		for i := range batch {
+			note := &batch[i]
+			asset := ""
+			if note.ImagePath != "" {
+				name, err := writeAsset(zw, note)
+				if err != nil {
+					return err
+				}
+				if name != "" {
+					asset = name
+					summary.Assets++
+				}
+			}
+
+			name := uniqueName(names, FileName(note.Title), ".md")
+			f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: note.UpdatedAt})
+			if err != nil {
+				return err
+			}
+			if err := WriteMarkdown(f, note, asset); err != nil {
+				return err
+			}
+			summary.Notes++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return summary, err
+	}
+	return summary, zw.Close()
+}
+
+// WriteMarkdown writes a note as Markdown with YAML front matter. Checklist
+// items are written as a task list, and asset, if set, is linked as the
+// note's image.
+func WriteMarkdown(w io.Writer, note *models.Note, asset string) error {
+	meta := frontMatter{
+		ID:         note.ID,
+		Title:      note.Title,
+		Tags:       note.Tags,
+		Created:    note.CreatedAt.UTC(),
+		Updated:    note.UpdatedAt.UTC(),
+		Format:     note.Format,
+		Pinned:     note.Pinned,
+		Starred:    note.Starred,
+		Archived:   note.Archived,
+		Color:      note.Color,
+		Properties: note.Properties,
+	}
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	if note.Type != models.NoteTypeNote {
+		meta.Type = note.Type
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(meta); err != nil {
+		return err
+	}
+	buf.WriteString("---\n\n")
+
+	var parts []string
+	if content := strings.TrimRight(note.Content, "\r\n"); strings.TrimSpace(content) != "" {
+		parts = append(parts, content)
+	}
+	if len(note.Items) > 0 {
+		lines := make([]string, len(note.Items))
+		for i, item := range note.Items {
+			mark := " "
+			if item.Checked {
+				mark = "x"
+			}
+			lines[i] = fmt.Sprintf("- [%s] %s", mark, item.Text)
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+	if asset != "" {
+		parts = append(parts, fmt.Sprintf("![%s](%s)", escapeLinkText(note.Title), asset))
+	}
+	buf.WriteString(strings.Join(parts, "\n\n"))
+	buf.WriteString("\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// FileName turns a note title into a safe file name without extension.
+func FileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_', r == '.', r == ' ':
+			return r
+		case unicode.IsSpace(r):
+			return ' '
+		default:
+			return '-'
+		}
+	}, title)
+	name = strings.Trim(strings.Join(strings.Fields(name), " "), " .-")
+	if runes := []rune(name); len(runes) > maxFileNameLen {
+		name = strings.TrimRight(string(runes[:maxFileNameLen]), " .-")
+	}
+	if name == "" {
+		name = "Untitled"
+	}
+	return name
+}
+
+// uniqueName returns base+ext, numbered if an earlier file took that name.
+// Names are compared without regard to case, as on most desktop systems.
+func uniqueName(taken map[string]bool, base, ext string) string {
+	name := base + ext
+	for n := 2; taken[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	taken[strings.ToLower(name)] = true
+	return name
+}
+
+// writeAsset copies a note's image into the archive and returns its path
+// there, or "" if the image file is missing.
+func writeAsset(zw *zip.Writer, note *models.Note) (string, error) {
+	src, err := os.Open(note.ImagePath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	name := AssetsDir + "/" + note.ID.String() + strings.ToLower(filepath.Ext(note.ImagePath))
+	// Images are already compressed
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: note.UpdatedAt})
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// loadChecklists loads the items of the checklist notes among notes.
+func loadChecklists(db *gorm.DB, notes []models.Note) error {
+	var ids []uuid.UUID
+	index := map[uuid.UUID]int{}
+	for i := range notes {
+		if notes[i].Type == models.NoteTypeChecklist {
+			ids = append(ids, notes[i].ID)
+			index[notes[i].ID] = i
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var items []models.ChecklistItem
+	if err := db.Where("note_id IN ?", ids).Order("note_id, position").Find(&items).Error; err != nil {
+		return err
+	}
+	for _, item := range items {
+		note := &notes[index[item.NoteID]]
+		note.Items = append(note.Items, item)
+	}
+	return nil
+}
+
+func escapeLinkText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(text)
+}
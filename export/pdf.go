@@ -0,0 +1,338 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"notes-api/models"
+	"notes-api/render"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// PDF layout, in millimetres and points
+const (
+	pdfMargin   = 20.0
+	pdfIndent   = 6.0
+	pdfFontSize = 11.0
+	pdfLine     = 5.5
+	sansFont    = "go"
+	monoFont    = "gomono"
+)
+
+var headingSizes = []float64{20, 16, 14, 12, 11, 11}
+
+// pdfImageTypes maps image media types to fpdf's image types.
+var pdfImageTypes = map[string]string{
+	"image/jpeg": "JPG",
+	"image/png":  "PNG",
+	"image/gif":  "GIF",
+}
+
+// pdfWriter lays out a note on A4 pages. The Go fonts are embedded, so any
+// text they cover prints without depending on fonts installed anywhere.
+type pdfWriter struct {
+	*fpdf.Fpdf
+	source []byte
+	indent float64
+	style  string
+	size   float64
+}
+
+func writePDF(w io.Writer, note *models.Note, img *noteImage) error {
+	pdf := &pdfWriter{Fpdf: fpdf.New("P", "mm", "A4", ""), size: pdfFontSize}
+	pdf.AddUTF8FontFromBytes(sansFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(sansFont, "B", gobold.TTF)
+	pdf.AddUTF8FontFromBytes(sansFont, "I", goitalic.TTF)
+	pdf.AddUTF8FontFromBytes(sansFont, "BI", gobolditalic.TTF)
+	pdf.AddUTF8FontFromBytes(monoFont, "", gomono.TTF)
+	pdf.SetTitle(note.Title, true)
+	pdf.SetCreator("Notes API", true)
+	pdf.SetCreationDate(note.CreatedAt)
+	pdf.SetModificationDate(note.UpdatedAt)
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin + 5)
+		pdf.SetFont(sansFont, "", 8)
+		pdf.SetTextColor(120, 120, 120)
+		pdf.CellFormat(0, 5, strconv.Itoa(pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont(sansFont, "B", headingSizes[0])
+	pdf.MultiCell(0, 9, note.Title, "", "L", false)
+	meta := "Updated " + note.UpdatedAt.UTC().Format(dateLayout)
+	if len(note.Tags) > 0 {
+		meta += "  ·  " + strings.Join(note.Tags, ", ")
+	}
+	pdf.SetFont(sansFont, "", 9)
+	pdf.SetTextColor(100, 100, 100)
+	pdf.MultiCell(0, 5, meta, "", "L", false)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(4)
+
+	if note.Format == render.FormatMarkdown {
+		doc, source := render.Parse(note.Content)
+		pdf.source = source
+		pdf.blocks(doc)
+	} else {
+		pdf.plain(note.Content)
+	}
+
+	if len(note.Items) > 0 {
+		pdf.SetFont(sansFont, "", pdfFontSize)
+		for _, item := range note.Items {
+			pdf.MultiCell(0, pdfLine+1, checkbox(item.Checked)+" "+item.Text, "", "L", false)
+		}
+		pdf.Ln(pdfLine / 2)
+	}
+
+	if img != nil {
+		pdf.image(img)
+	}
+	return pdf.Output(w)
+}
+
+// plain writes plain text content, keeping its line breaks.
+func (p *pdfWriter) plain(content string) {
+	content = strings.TrimSpace(strings.ReplaceAll(content, "\r\n", "\n"))
+	if content == "" {
+		return
+	}
+	p.SetFont(sansFont, "", pdfFontSize)
+	p.MultiCell(0, pdfLine, content, "", "L", false)
+	p.Ln(pdfLine)
+}
+
+// image places the note's image below the text, scaled to the page width.
+// An image fpdf cannot read is left out rather than failing the document.
+func (p *pdfWriter) image(img *noteImage) {
+	options := fpdf.ImageOptions{ImageType: pdfImageTypes[img.Type], ReadDpi: true}
+	info := p.RegisterImageOptionsReader("image", options, bytes.NewReader(img.Data))
+	if !p.Ok() {
+		p.ClearError()
+		return
+	}
+	pageWidth, pageHeight := p.GetPageSize()
+	maxWidth := pageWidth - 2*pdfMargin
+	maxHeight := pageHeight - 2*pdfMargin - 10
+	width, height := info.Extent()
+	if width > maxWidth {
+		width, height = maxWidth, height*maxWidth/width
+	}
+	if height > maxHeight {
+		width, height = width*maxHeight/height, maxHeight
+	}
+	p.Ln(pdfLine / 2)
+	p.ImageOptions("image", pdfMargin, -1, width, height, true, options, 0, "")
+}
+
+// blocks writes the block nodes below n.
+func (p *pdfWriter) blocks(n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		p.block(c)
+	}
+}
+
+func (p *pdfWriter) block(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		p.Ln(pdfLine / 2)
+		p.size = headingSizes[n.Level-1]
+		p.style = "B"
+		p.inlines(n, p.size*0.5)
+		p.style, p.size = "", pdfFontSize
+		p.Ln(pdfLine / 2)
+	case *ast.Paragraph:
+		p.inlines(n, pdfLine)
+		p.Ln(pdfLine)
+	case *ast.TextBlock:
+		p.inlines(n, pdfLine)
+	case *ast.List:
+		p.list(n)
+		p.Ln(pdfLine / 2)
+	case *ast.Blockquote:
+		p.SetTextColor(90, 90, 90)
+		p.indented(func() { p.blocks(n) })
+		p.SetTextColor(0, 0, 0)
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		p.code(n)
+	case *ast.ThematicBreak:
+		pageWidth, _ := p.GetPageSize()
+		y := p.GetY() + pdfLine/2
+		p.SetDrawColor(200, 200, 200)
+		p.Line(pdfMargin+p.indent, y, pageWidth-pdfMargin, y)
+		p.Ln(pdfLine * 1.5)
+	case *east.Table:
+		p.table(n)
+	case *ast.HTMLBlock:
+		// Raw HTML is dropped, as when rendering notes
+	default:
+		p.blocks(n)
+	}
+}
+
+func (p *pdfWriter) list(list *ast.List) {
+	number := list.Start
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "•"
+		if list.IsOrdered() {
+			marker = strconv.Itoa(number) + "."
+			number++
+		}
+		if box, ok := taskCheckBox(item); ok {
+			marker = checkbox(box.IsChecked)
+		}
+		p.SetFont(sansFont, "", pdfFontSize)
+		p.SetX(pdfMargin + p.indent)
+		p.CellFormat(pdfIndent, pdfLine, marker, "", 0, "L", false, 0, "")
+		p.indented(func() { p.blocks(item) })
+	}
+}
+
+// taskCheckBox returns the checkbox a GFM task list item starts with.
+func taskCheckBox(item ast.Node) (*east.TaskCheckBox, bool) {
+	if block := item.FirstChild(); block != nil {
+		box, ok := block.FirstChild().(*east.TaskCheckBox)
+		return box, ok
+	}
+	return nil, false
+}
+
+func (p *pdfWriter) code(n ast.Node) {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		b.Write(segment.Value(p.source))
+	}
+	p.SetFont(monoFont, "", pdfFontSize-1.5)
+	p.SetFillColor(245, 246, 248)
+	p.SetX(pdfMargin + p.indent)
+	p.MultiCell(0, pdfLine-0.5, strings.TrimRight(b.String(), "\n"), "", "L", true)
+	p.Ln(pdfLine)
+}
+
+// table writes each row of a table as its cells separated by bars.
+func (p *pdfWriter) table(table *east.Table) {
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		style := ""
+		if _, ok := row.(*east.TableHeader); ok {
+			style = "B"
+		}
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, p.plainText(cell))
+		}
+		p.SetFont(sansFont, style, pdfFontSize)
+		p.SetX(pdfMargin + p.indent)
+		p.MultiCell(0, pdfLine, strings.Join(cells, "  |  "), "", "L", false)
+	}
+	p.Ln(pdfLine)
+}
+
+func (p *pdfWriter) indented(write func()) {
+	p.indent += pdfIndent
+	p.SetLeftMargin(pdfMargin + p.indent)
+	write()
+	p.indent -= pdfIndent
+	p.SetLeftMargin(pdfMargin + p.indent)
+}
+
+// inlines writes the inline content of a block as flowing text, switching
+// fonts for emphasis and code.
+func (p *pdfWriter) inlines(block ast.Node, height float64) {
+	p.SetX(pdfMargin + p.indent)
+	p.inline(block, p.style, height)
+	p.Ln(height)
+}
+
+func (p *pdfWriter) inline(n ast.Node, style string, height float64) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			p.SetFont(sansFont, style, p.size)
+			p.Write(height, string(c.Segment.Value(p.source)))
+			if c.HardLineBreak() {
+				p.Ln(height)
+			} else if c.SoftLineBreak() {
+				p.Write(height, " ")
+			}
+		case *ast.String:
+			p.SetFont(sansFont, style, p.size)
+			p.Write(height, string(c.Value))
+		case *ast.CodeSpan:
+			p.SetFont(monoFont, "", p.size-1)
+			p.Write(height, p.plainText(c))
+		case *ast.Emphasis:
+			add := "I"
+			if c.Level == 2 {
+				add = "B"
+			}
+			p.inline(c, addStyle(style, add), height)
+		case *ast.Link:
+			p.SetTextColor(9, 105, 218)
+			p.inline(c, style, height)
+			p.SetTextColor(0, 0, 0)
+		case *ast.AutoLink:
+			p.SetFont(sansFont, style, p.size)
+			p.SetTextColor(9, 105, 218)
+			p.Write(height, string(c.URL(p.source)))
+			p.SetTextColor(0, 0, 0)
+		case *ast.Image:
+			p.inline(c, addStyle(style, "I"), height)
+		case *east.TaskCheckBox, *ast.RawHTML:
+		default:
+			p.inline(c, style, height)
+		}
+	}
+}
+
+// addStyle adds bold or italic to an fpdf font style, in the "BI" order
+// fpdf expects.
+func addStyle(style, add string) string {
+	style += add
+	bold, italic := strings.Contains(style, "B"), strings.Contains(style, "I")
+	switch {
+	case bold && italic:
+		return "BI"
+	case bold:
+		return "B"
+	case italic:
+		return "I"
+	}
+	return ""
+}
+
+// plainText returns the text of the inline nodes below n without styling.
+func (p *pdfWriter) plainText(n ast.Node) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(p.source))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteString(" ")
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		case *ast.AutoLink:
+			b.Write(c.URL(p.source))
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/mail"
+	"notes-api/accounts"
+	"notes-api/database"
+	"notes-api/jobs"
+	"notes-api/middleware"
+	"notes-api/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// GetAccount godoc
+// @Summary Get my account
+// @Description Retrieve the authenticated user's profile. pending_email is set while a change of email address waits for confirmation.
+// @Tags Account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.AccountSuccessResponse "Account details"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/me [get]
+func GetAccount(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	return c.JSON(models.AccountSuccessResponse{
+		Status:  "success",
+		Message: "Account retrieved successfully",
+		Data: models.AccountData{
+			Account: models.NewAccount(user),
+		},
+	})
+}
+
+// UpdateAccount godoc
+// @Summary Update my account
+// @Description Change the authenticated user's name. The email address and password have their own endpoints, since they need confirmation.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UpdateAccountRequest true "Fields to change"
+// @Success 200 {object} models.AccountSuccessResponse "Account updated"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/me [patch]
+func UpdateAccount(c *fiber.Ctx) error {
+	var req models.UpdateAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if utf8.RuneCountInString(name) < 2 || utf8.RuneCountInString(name) > 100 {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Name must be between 2 and 100 characters",
+			})
+		}
+		user.Name = name
+		if err := database.DB.Model(user).Update("name", user.Name).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Failed to update account",
+			})
+		}
+	}
+
+	return c.JSON(models.AccountSuccessResponse{
+		Status:  "success",
+		Message: "Account updated successfully",
+		Data: models.AccountData{
+			Account: models.NewAccount(user),
+		},
+	})
+}
+
+// ChangePassword godoc
+// @Summary Change my password
+// @Description Change the password after confirming the current one. Every session ends and every token issued before, on any device, stops working; the response carries a new token for this client.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} models.AuthSuccessResponse "Password changed"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Incorrect password"
+// @Failure 429 {object} models.ErrorResponse "Too many failed attempts"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/password [post]
+func ChangePassword(c *fiber.Ctx) error {
+	var req models.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	if len(req.NewPassword) < models.MinPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "New password must be at least 6 characters",
+		})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if ok, err := confirmPassword(c, user, req.CurrentPassword); !ok {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to hash password",
+		})
+	}
+	user.Password = string(hashedPassword)
+	user.TokenVersion++
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"password":      user.Password,
+		"token_version": user.TokenVersion,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to change password",
+		})
+	}
+
+	// Sessions on other devices end; this one gets a new token
+	deviceName := ""
+	if current, err := currentSession(c); err == nil {
+		deviceName = current.DeviceName
+	}
+	if _, err := accounts.EndSessions(database.DB, user.ID, uuid.Nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to end sessions",
+		})
+	}
+	token, err := issueToken(c, user, deviceName)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to generate token",
+		})
+	}
+
+	return c.JSON(models.AuthSuccessResponse{
+		Status:  "success",
+		Message: "Password changed",
+		Data: models.AuthData{
+			Token: "Bearer " + token,
+			User: models.AuthUser{
+				ID:        user.ID,
+				Email:     user.Email,
+				Name:      user.Name,
+				CreatedAt: user.CreatedAt,
+				UpdatedAt: user.UpdatedAt,
+			},
+		},
+	})
+}
+
+// ChangeEmail godoc
+// @Summary Change my email address
+// @Description Start changing the email address after confirming the password. A confirmation link (or code, when no web app URL is configured) is sent to the new address; the account keeps its current address until it is confirmed with POST /api/auth/confirm-email within 24 hours. Asking again replaces the pending address.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ChangeEmailRequest true "New address and current password"
+// @Success 202 {object} models.AccountSuccessResponse "Confirmation sent"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Incorrect password"
+// @Failure 429 {object} models.ErrorResponse "Too many failed attempts"
+// @Failure 409 {object} models.ErrorResponse "Email already in use"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/email [post]
+func ChangeEmail(c *fiber.Ctx) error {
+	var req models.ChangeEmailRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	email := accounts.NormalizeEmail(req.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "A valid email address is required",
+		})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if ok, err := confirmPassword(c, user, req.Password); !ok {
+		return err
+	}
+	if email == accounts.NormalizeEmail(user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "This is already your email address",
+		})
+	}
+	if emailTaken(email) {
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "User with this email already exists",
+		})
+	}
+
+	token, hash := accounts.NewToken()
+	expires := time.Now().Add(accounts.EmailTokenLifetime)
+	user.PendingEmail = email
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"pending_email":          email,
+		"email_token_hash":       hash,
+		"email_token_expires_at": expires,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to change email",
+		})
+	}
+	if err := accounts.SendEmailConfirmation(user, token); err != nil {
+		log.Printf("Failed to send email confirmation to user %s: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to send confirmation email",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(models.AccountSuccessResponse{
+		Status:  "success",
+		Message: "Confirmation sent to " + email,
+		Data: models.AccountData{
+			Account: models.NewAccount(user),
+		},
+	})
+}
+
+// VerifyEmail godoc
+// @Summary Verify my email address
+// @Description Send a confirmation link (or code, when no web app URL is configured) to the account's current address. Confirming it with POST /api/auth/confirm-email within 24 hours marks the address verified. It replaces a pending change of address.
+// @Tags Account
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} models.AccountSuccessResponse "Confirmation sent"
+// @Failure 400 {object} models.ErrorResponse "Already verified"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/email/verify [post]
+func VerifyEmail(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Your email address is already verified",
+		})
+	}
+
+	token, hash := accounts.NewToken()
+	expires := time.Now().Add(accounts.EmailTokenLifetime)
+	user.PendingEmail = user.Email
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"pending_email":          user.Email,
+		"email_token_hash":       hash,
+		"email_token_expires_at": expires,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to verify email",
+		})
+	}
+	if err := accounts.SendEmailConfirmation(user, token); err != nil {
+		log.Printf("Failed to send email verification to user %s: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to send confirmation email",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(models.AccountSuccessResponse{
+		Status:  "success",
+		Message: "Confirmation sent to " + user.Email,
+		Data: models.AccountData{
+			Account: models.NewAccount(user),
+		},
+	})
+}
+
+// ConfirmEmail godoc
+// @Summary Confirm an email address
+// @Description Complete a change of email address, or the verification of the current one, with the token sent to the address. No login is needed: the token proves access to the mailbox, and the address is marked verified. After a change, the previous address is told about it.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.ConfirmEmailRequest true "Token from the confirmation email"
+// @Success 200 {object} models.AccountSuccessResponse "Email address changed"
+// @Failure 400 {object} models.ErrorResponse "Invalid or expired token"
+// @Failure 409 {object} models.ErrorResponse "Email already in use"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/auth/confirm-email [post]
+func ConfirmEmail(c *fiber.Ctx) error {
+	var req models.ConfirmEmailRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Token is required",
+		})
+	}
+
+	var user models.User
+	err := database.DB.Where("email_token_hash = ? AND email_token_expires_at > ? AND deleted_at IS NULL",
+		accounts.HashToken(req.Token), time.Now()).First(&user).Error
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid or expired token",
+		})
+	}
+	changed := user.PendingEmail != user.Email
+	if changed && emailTaken(user.PendingEmail) {
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "User with this email already exists",
+		})
+	}
+
+	previous := user.Email
+	now := time.Now()
+	user.Email = user.PendingEmail
+	user.PendingEmail = ""
+	user.EmailVerifiedAt = &now
+	if err := database.DB.Model(&user).Updates(map[string]interface{}{
+		"email":                  user.Email,
+		"pending_email":          "",
+		"email_token_hash":       "",
+		"email_token_expires_at": nil,
+		"email_verified_at":      now,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to change email",
+		})
+	}
+	message := "Email address verified"
+	if changed {
+		message = "Email address changed"
+		if err := accounts.SendEmailChanged(previous, &user); err != nil {
+			log.Printf("Failed to notify user %s of their email change: %v", user.ID, err)
+		}
+	}
+
+	return c.JSON(models.AccountSuccessResponse{
+		Status:  "success",
+		Message: message,
+		Data: models.AccountData{
+			Account: models.NewAccount(&user),
+		},
+	})
+}
+
+// ExportAccount godoc
+// @Summary Download all my data
+// @Description Queue an export of everything stored for the account, as a ZIP of machine-readable JSON files: account.json (the user record), notes.json (every note with its checklist items), revisions.json, reminders.json, templates.json, properties.json and webhooks.json, with uploaded images in an uploads folder. Poll GET /api/jobs/{id} until the job has succeeded and download the archive from its download_url. While an export is still running, requesting another returns it instead of queueing a new one.
+// @Tags Account
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} models.JobSuccessResponse "Export job queued"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/export [post]
+func ExportAccount(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(middleware.GetUserID(c))
+
+	var job models.Job
+	err := database.DB.Where("user_id = ? AND type = ? AND status IN ?", userID, models.JobAccountExport,
+		[]string{models.JobPending, models.JobRunning}).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var queued *models.Job
+		if queued, err = jobs.Enqueue(database.DB, userID, models.JobAccountExport, nil); err == nil {
+			job = *queued
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to queue export",
+		})
+	}
+
+	c.Location("/api/jobs/" + job.ID.String())
+	return c.Status(fiber.StatusAccepted).JSON(models.JobSuccessResponse{
+		Status:  "success",
+		Message: "Export queued",
+		Data: models.JobData{
+			Job: job,
+		},
+	})
+}
+
+// DeleteAccount godoc
+// @Summary Delete my account
+// @Description Permanently delete the account after confirming the password. Notes, images, revisions, reminders, templates, properties, webhooks and jobs are removed immediately and the account can no longer be used. The account record is kept for 30 days so abuse can be traced, and is then anonymized. Export your data first with POST /api/account/export if you want to keep it.
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.DeleteAccountRequest true "Current password"
+// @Success 200 {object} models.MessageSuccessResponse "Account deleted"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Incorrect password"
+// @Failure 429 {object} models.ErrorResponse "Too many failed attempts"
+// @Failure 409 {object} models.ErrorResponse "Last administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account [delete]
+func DeleteAccount(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(middleware.GetUserID(c))
+
+	var req models.DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Password is required to delete the account",
+		})
+	}
+
+	user, err := currentUser(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if ok, err := confirmPassword(c, user, req.Password); !ok {
+		return err
+	}
+
+	var files []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		files, err = accounts.Delete(tx, userID)
+		return err
+	})
+	if errors.Is(err, accounts.ErrLastAdmin) {
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "You are the last administrator; make another account an administrator first",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to delete account",
+		})
+	}
+	accounts.RemoveFiles(userID, files)
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Account deleted",
+		Data: models.MessageData{
+			Message: "Your account and its content have been deleted.",
+		},
+	})
+}
+
+// currentUser loads the authenticated user.
+func currentUser(c *fiber.Ctx) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("id = ?", middleware.GetUserID(c)).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// emailTaken reports whether an account, including a deleted one that has
+// not been anonymized yet, uses email, in any case.
+func emailTaken(email string) bool {
+	var count int64
+	database.DB.Model(&models.User{}).Where("LOWER(email) = ?", accounts.NormalizeEmail(email)).Count(&count)
+	return count > 0
+}
+
+// confirmPassword checks the password of the authenticated user before a
+// change to the account. The checks are throttled like logins to the
+// account, so a stolen token cannot be used to guess the password. If the
+// password is wrong or the check must wait, it writes the response and
+// returns false.
+func confirmPassword(c *fiber.Ctx, user *models.User, password string) (bool, error) {
+	ip := middleware.ClientIP(c)
+	wait, err := accounts.ReserveLogin(user.Email, ip)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to check login attempts",
+		})
+	}
+	if wait > 0 {
+		return false, tooManyAttempts(c, wait)
+	}
+
+	if !accounts.CheckPassword(user, password) {
+		if err := accounts.LoginFailed(user.Email, ip, user); err != nil {
+			log.Printf("Failed to record failed password check: %v", err)
+		}
+		return false, c.Status(fiber.StatusForbidden).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Incorrect password",
+		})
+	}
+	if err := accounts.LoginSucceeded(user.Email, ip); err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+	return true, nil
+}
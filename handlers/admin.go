@@ -0,0 +1,674 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"notes-api/accounts"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAdminLimit = 50
+	maxAdminLimit     = 200
+	// topStorageUsers is how many of the accounts storing the most are listed
+	topStorageUsers = 20
+)
+
+// ListUsers godoc
+// @Summary List and search users
+// @Description List accounts, newest first, for administrators. q searches email addresses and names.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Text to search email addresses and names for"
+// @Param role query string false "Only accounts with this role" Enums(user, admin)
+// @Param status query string false "Only accounts in this state" Enums(active, disabled, deleted)
+// @Param limit query int false "Maximum number of accounts to return (default 50, max 200)"
+// @Param offset query int false "Number of accounts to skip"
+// @Success 200 {object} models.AdminUsersSuccessResponse "Accounts"
+// @Failure 400 {object} models.ErrorResponse "Invalid filter"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users [get]
+func ListUsers(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		query = query.Where("(email ILIKE ? OR name ILIKE ?)", pattern, pattern)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("status") {
+	case "":
+	case models.UserActive:
+		query = query.Where("deleted_at IS NULL AND disabled_at IS NULL")
+	case models.UserDisabled:
+		query = query.Where("deleted_at IS NULL AND disabled_at IS NOT NULL")
+	case models.UserDeleted:
+		query = query.Where("deleted_at IS NOT NULL")
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "status must be active, disabled or deleted",
+		})
+	}
+
+	// The query is run twice, for the total and the page
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch users",
+		})
+	}
+	var users []models.User
+	limit, offset := adminPage(c)
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch users",
+		})
+	}
+
+	list := make([]models.AdminUser, len(users))
+	for i := range users {
+		list[i] = models.NewAdminUser(&users[i])
+	}
+	return c.JSON(models.AdminUsersSuccessResponse{
+		Status:  "success",
+		Message: "Users retrieved successfully",
+		Data: models.AdminUsersData{
+			Users: list,
+			Count: len(list),
+			Total: total,
+		},
+	})
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description Retrieve an account with its storage usage: notes and revisions with the bytes of their text, uploaded images and job files.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.AdminUserSuccessResponse "Account"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "User not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users/{id} [get]
+func GetUser(c *fiber.Ctx) error {
+	user, err := targetUser(c)
+	if err != nil {
+		return userNotFound(c, err)
+	}
+	storage, err := accounts.Storage(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to measure storage",
+		})
+	}
+
+	return c.JSON(models.AdminUserSuccessResponse{
+		Status:  "success",
+		Message: "User retrieved successfully",
+		Data: models.AdminUserData{
+			User:    models.NewAdminUser(user),
+			Storage: &storage,
+		},
+	})
+}
+
+// DisableUser godoc
+// @Summary Disable a user
+// @Description Block an account: it is logged out everywhere and cannot log in or use its tokens until enabled again. Its content is kept.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.DisableUserRequest true "Reason"
+// @Success 200 {object} models.AdminUserSuccessResponse "Account disabled"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "User not found"
+// @Failure 409 {object} models.ErrorResponse "Last active administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users/{id}/disable [post]
+func DisableUser(c *fiber.Ctx) error {
+	var req models.DisableUserRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "A reason is required",
+		})
+	}
+	user, err := targetUser(c)
+	if err != nil {
+		return userNotFound(c, err)
+	}
+	if isSelf(c, user) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "You cannot disable your own account",
+		})
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := accounts.Disable(tx, user.ID, reason); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserDisable, &user.ID, "", map[string]interface{}{"reason": reason})
+	})
+	if err != nil {
+		return moderationError(c, err, "Failed to disable user")
+	}
+	return adminUserResponse(c, user.ID, "User disabled")
+}
+
+// EnableUser godoc
+// @Summary Enable a user
+// @Description Lift the block on a disabled account.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.AdminUserSuccessResponse "Account enabled"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "User not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users/{id}/enable [post]
+func EnableUser(c *fiber.Ctx) error {
+	user, err := targetUser(c)
+	if err != nil {
+		return userNotFound(c, err)
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := accounts.Enable(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserEnable, &user.ID, "", nil)
+	})
+	if err != nil {
+		return moderationError(c, err, "Failed to enable user")
+	}
+	return adminUserResponse(c, user.ID, "User enabled")
+}
+
+// SetUserRole godoc
+// @Summary Change a user's role
+// @Description Make an account an administrator, or a regular user again. Administrators cannot change their own role.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.SetRoleRequest true "New role"
+// @Success 200 {object} models.AdminUserSuccessResponse "Role changed"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "User not found"
+// @Failure 409 {object} models.ErrorResponse "Last active administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users/{id}/role [patch]
+func SetUserRole(c *fiber.Ctx) error {
+	var req models.SetRoleRequest
+	if err := c.BodyParser(&req); err != nil || (req.Role != models.RoleUser && req.Role != models.RoleAdmin) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "role must be user or admin",
+		})
+	}
+	user, err := targetUser(c)
+	if err != nil || user.DeletedAt != nil {
+		return userNotFound(c, gorm.ErrRecordNotFound)
+	}
+	if isSelf(c, user) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "You cannot change your own role",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := accounts.SetRole(tx, user.ID, req.Role); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserRole, &user.ID, "", map[string]interface{}{"role": req.Role})
+	})
+	if err != nil {
+		return moderationError(c, err, "Failed to change role")
+	}
+	return adminUserResponse(c, user.ID, "Role changed")
+}
+
+// ForcePasswordReset godoc
+// @Summary Force a password reset
+// @Description Clear an account's password and log it out everywhere, for example when it may be compromised. The owner is emailed a link to choose a new password with POST /api/auth/reset-password; calling this again sends a new link.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.AdminUserSuccessResponse "Password reset"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "User not found"
+// @Failure 409 {object} models.ErrorResponse "Last active administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users/{id}/password-reset [post]
+func ForcePasswordReset(c *fiber.Ctx) error {
+	user, err := targetUser(c)
+	if err != nil || user.DeletedAt != nil {
+		return userNotFound(c, gorm.ErrRecordNotFound)
+	}
+
+	var token string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if token, err = accounts.ForcePasswordReset(tx, user); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserPasswordReset, &user.ID, "", nil)
+	})
+	if err != nil {
+		return moderationError(c, err, "Failed to reset password")
+	}
+	if err := accounts.SendPasswordReset(user, token); err != nil {
+		log.Printf("Failed to send password reset to user %s: %v", user.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "The password was reset, but the email could not be sent; try again",
+		})
+	}
+	return adminUserResponse(c, user.ID, "Password reset; the user has been emailed a link to choose a new one")
+}
+
+// ListUserNotes godoc
+// @Summary Review a user's notes
+// @Description List every note of an account, archived ones included, to review reported content. Each review is recorded in the audit log.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.NotesSuccessResponse "Notes"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "User not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users/{id}/notes [get]
+func ListUserNotes(c *fiber.Ctx) error {
+	user, err := targetUser(c)
+	if err != nil {
+		return userNotFound(c, err)
+	}
+	// Nothing is shown unless the review is on record
+	if err := recordAudit(database.DB, c, models.AuditUserNotesView, &user.ID, "", nil); err != nil {
+		return moderationError(c, err, "Failed to fetch notes")
+	}
+
+	var notes []models.Note
+	if err := database.DB.Where("user_id = ?", user.ID).Order("updated_at DESC").Find(&notes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch notes",
+		})
+	}
+	for i := range notes {
+		setImageURL(c, &notes[i])
+	}
+
+	return c.JSON(models.NotesSuccessResponse{
+		Status:  "success",
+		Message: "Notes retrieved successfully",
+		Data: models.NotesData{
+			Notes: notes,
+			Count: len(notes),
+		},
+	})
+}
+
+// AdminDeleteUser godoc
+// @Summary Delete a user
+// @Description Delete an abusive account as if its owner had: its content is removed at once and the account record is anonymized after 30 days.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.ModerationRequest true "Reason"
+// @Success 200 {object} models.MessageSuccessResponse "Account deleted"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "User not found"
+// @Failure 409 {object} models.ErrorResponse "Last active administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/users/{id} [delete]
+func AdminDeleteUser(c *fiber.Ctx) error {
+	var req models.ModerationRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "A reason is required",
+		})
+	}
+	user, err := targetUser(c)
+	if err != nil {
+		return userNotFound(c, err)
+	}
+	if isSelf(c, user) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Delete your own account with DELETE /api/account",
+		})
+	}
+
+	var files []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if files, err = accounts.Delete(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserDelete, &user.ID, "", map[string]interface{}{"reason": strings.TrimSpace(req.Reason)})
+	})
+	if err != nil {
+		return moderationError(c, err, "Failed to delete account")
+	}
+	accounts.RemoveFiles(user.ID, files)
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Account deleted",
+		Data: models.MessageData{
+			Message: "The account and its content have been deleted.",
+		},
+	})
+}
+
+// AdminDeleteNote godoc
+// @Summary Delete a note
+// @Description Remove an abusive note of any account, with its image, revisions, checklist items and reminders. The owner's devices are told it was deleted.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param request body models.ModerationRequest true "Reason"
+// @Success 200 {object} models.MessageSuccessResponse "Note deleted"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/notes/{id} [delete]
+func AdminDeleteNote(c *fiber.Ctx) error {
+	var req models.ModerationRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "A reason is required",
+		})
+	}
+	noteID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+
+	var note models.Note
+	if err := database.DB.Where("id = ?", noteID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteNote(tx, &note); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditNoteDelete, &note.UserID, note.ID.String(), map[string]interface{}{"reason": strings.TrimSpace(req.Reason)})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to delete note",
+		})
+	}
+	if note.ImagePath != "" {
+		os.Remove(note.ImagePath)
+	}
+	publishNoteEvent(events.NoteDeleted, &note)
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Note deleted successfully",
+		Data: models.MessageData{
+			Message: "Note deleted successfully",
+		},
+	})
+}
+
+// GetStorage godoc
+// @Summary Storage usage
+// @Description Show how much is stored: notes and revisions with the bytes of their text, and the files in the uploads and jobs folders. top_users lists the 20 accounts storing the most text in the database.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.StorageSuccessResponse "Storage usage"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/storage [get]
+func GetStorage(c *fiber.Ctx) error {
+	var users int64
+	err := database.DB.Model(&models.User{}).Where("deleted_at IS NULL").Count(&users).Error
+	var total models.StorageUsage
+	var top []models.UserStorage
+	if err == nil {
+		total, top, err = accounts.TotalStorage(topStorageUsers)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to measure storage",
+		})
+	}
+
+	return c.JSON(models.StorageSuccessResponse{
+		Status:  "success",
+		Message: "Storage usage retrieved successfully",
+		Data: models.StorageData{
+			Users:    users,
+			Total:    total,
+			TopUsers: top,
+		},
+	})
+}
+
+// ListAuditLog godoc
+// @Summary List the audit log
+// @Description List actions taken by administrators, newest first.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param actor_id query string false "Only actions by this administrator"
+// @Param target_user_id query string false "Only actions on this account"
+// @Param action query string false "Only this kind of action" Enums(user.disable, user.enable, user.role, user.password_reset, user.notes_view, user.delete, note.delete)
+// @Param limit query int false "Maximum number of entries to return (default 50, max 200)"
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {object} models.AuditLogSuccessResponse "Audit log"
+// @Failure 400 {object} models.ErrorResponse "Invalid filter"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "Not an administrator"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/admin/audit [get]
+func ListAuditLog(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.AuditLogEntry{})
+	for _, param := range []string{"actor_id", "target_user_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+					Status: "error",
+					Error:  "Invalid " + param,
+				})
+			}
+			query = query.Where(param+" = ?", id)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	// The query is run twice, for the total and the page
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch audit log",
+		})
+	}
+	entries := []models.AuditLogEntry{}
+	limit, offset := adminPage(c)
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch audit log",
+		})
+	}
+
+	return c.JSON(models.AuditLogSuccessResponse{
+		Status:  "success",
+		Message: "Audit log retrieved successfully",
+		Data: models.AuditLogData{
+			Entries: entries,
+			Count:   len(entries),
+			Total:   total,
+		},
+	})
+}
+
+// targetUser loads the account named by the :id parameter, deleted or not.
+func targetUser(c *fiber.Ctx) (*models.User, error) {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func userNotFound(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "User not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+		Status: "error",
+		Error:  "Failed to process user",
+	})
+}
+
+// isSelf reports whether user is the administrator making the request.
+func isSelf(c *fiber.Ctx, user *models.User) bool {
+	return user.ID.String() == middleware.GetUserID(c)
+}
+
+// adminUserResponse reloads the account userID and responds with it.
+func adminUserResponse(c *fiber.Ctx, userID uuid.UUID, message string) error {
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return userNotFound(c, err)
+	}
+	return c.JSON(models.AdminUserSuccessResponse{
+		Status:  "success",
+		Message: message,
+		Data: models.AdminUserData{
+			User: models.NewAdminUser(&user),
+		},
+	})
+}
+
+// moderationError responds to a moderation action that failed with err.
+func moderationError(c *fiber.Ctx, err error, failure string) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return userNotFound(c, err)
+	case errors.Is(err, accounts.ErrLastAdmin):
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "This is the last active administrator; make another account an administrator first",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+		Status: "error",
+		Error:  failure,
+	})
+}
+
+// recordAudit records in tx an action the administrator making the request
+// takes. It runs in the same transaction as the action, so an action that
+// cannot be recorded does not happen.
+func recordAudit(tx *gorm.DB, c *fiber.Ctx, action string, targetUserID *uuid.UUID, targetID string, details map[string]interface{}) error {
+	actorID, _ := uuid.Parse(middleware.GetUserID(c))
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	entry := models.AuditLogEntry{
+		ActorID:      actorID,
+		Action:       action,
+		TargetUserID: targetUserID,
+		TargetID:     targetID,
+		Details:      details,
+		IP:           middleware.ClientIP(c),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit log entry %s by %s: %v", action, actorID, err)
+		return err
+	}
+	return nil
+}
+
+// adminPage returns the limit and offset of a page of an admin list.
+func adminPage(c *fiber.Ctx) (int, int) {
+	limit := c.QueryInt("limit", defaultAdminLimit)
+	if limit <= 0 || limit > maxAdminLimit {
+		limit = defaultAdminLimit
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
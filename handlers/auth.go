@@ -1,14 +1,22 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"notes-api/accounts"
 	"notes-api/database"
+	"notes-api/middleware"
 	"notes-api/models"
-	"os"
+	"notes-api/tokens"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 // Register godoc
@@ -33,8 +41,9 @@ func Register(c *fiber.Ctx) error {
 	}
 
 	// Check if user already exists
+	req.Email = accounts.NormalizeEmail(req.Email)
 	var existingUser models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if err := database.DB.Where("LOWER(email) = ?", req.Email).First(&existingUser).Error; err == nil {
 		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
 			Status: "error",
 			Error:  "User with this email already exists",
@@ -55,6 +64,7 @@ func Register(c *fiber.Ctx) error {
 		Name:     req.Name,
 		Email:    req.Email,
 		Password: string(hashedPassword),
+		Role:     models.RoleUser,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -75,7 +85,7 @@ func Register(c *fiber.Ctx) error {
 
 // Login godoc
 // @Summary User login
-// @Description Authenticate user with email and password, returns JWT token
+// @Description Authenticate user with email and password, returns JWT token. Each login starts a session, listed under GET /api/account/sessions with the optional device_name or a name made up from the User-Agent. After 3 failed attempts for an email address within an hour, each further attempt must wait twice as long as the last, and 10 failures lock the address out for an hour; its owner is emailed a link to unlock it. Clients sending many failed logins from one IP are slowed down and locked out the same way. Throttled attempts get 429 with Retry-After.
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -83,6 +93,8 @@ func Register(c *fiber.Ctx) error {
 // @Success 200 {object} models.AuthSuccessResponse "Login successful"
 // @Failure 400 {object} models.ErrorResponse "Invalid request body"
 // @Failure 401 {object} models.ErrorResponse "Invalid credentials"
+// @Failure 403 {object} models.ErrorResponse "Account disabled"
+// @Failure 429 {object} models.ErrorResponse "Too many failed attempts"
 // @Failure 500 {object} models.ErrorResponse "Internal server error"
 // @Router /api/auth/login [post]
 func Login(c *fiber.Ctx) error {
@@ -94,25 +106,49 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	// Find user
-	var user models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{
+	// Throttled attempts are turned away before the password is checked
+	ip := middleware.ClientIP(c)
+	wait, err := accounts.ReserveLogin(req.Email, ip)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
 			Status: "error",
-			Error:  "Invalid credentials",
+			Error:  "Failed to check login attempts",
 		})
 	}
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
 
-	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	// Find user; deleted accounts cannot log in. Unknown users take as long
+	// to reject as wrong passwords, so responses do not reveal who has an
+	// account.
+	var user *models.User
+	var found models.User
+	if err := database.DB.Where("LOWER(email) = ? AND deleted_at IS NULL", accounts.NormalizeEmail(req.Email)).
+		First(&found).Error; err == nil {
+		user = &found
+	}
+	if !accounts.CheckPassword(user, req.Password) {
+		if err := accounts.LoginFailed(req.Email, ip, user); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(models.ErrorResponse{
 			Status: "error",
 			Error:  "Invalid credentials",
 		})
 	}
+	if err := accounts.LoginSucceeded(req.Email, ip); err != nil {
+		log.Printf("Failed to reset failed logins: %v", err)
+	}
+	if user.DisabledAt != nil {
+		return c.Status(fiber.StatusForbidden).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Account has been disabled",
+		})
+	}
 
-	// Generate JWT token
-	token, err := generateJWT(user.ID.String())
+	// Generate JWT token for a new session on this device
+	token, err := issueToken(c, user, req.DeviceName)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
 			Status: "error",
@@ -136,12 +172,139 @@ func Login(c *fiber.Ctx) error {
 	})
 }
 
-func generateJWT(userID string) (string, error) {
+// UnlockAccount godoc
+// @Summary Unlock an account after failed logins
+// @Description Lift the lockout of an email address that had too many failed logins, with the token emailed to the account's owner when it was locked.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.UnlockAccountRequest true "Token from the unlock email"
+// @Success 200 {object} models.MessageSuccessResponse "Account unlocked"
+// @Failure 400 {object} models.ErrorResponse "Invalid or expired token"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/auth/unlock [post]
+func UnlockAccount(c *fiber.Ctx) error {
+	var req models.UnlockAccountRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Token is required",
+		})
+	}
+
+	if err := accounts.Unlock(req.Token); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Invalid or expired token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to unlock account",
+		})
+	}
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Account unlocked",
+		Data: models.MessageData{
+			Message: "You can log in again.",
+		},
+	})
+}
+
+// ResetPassword godoc
+// @Summary Set a new password after a forced reset
+// @Description Choose a new password with the token emailed when an administrator reset the account's password. The token is valid for 72 hours; log in with the new password afterwards.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Token from the reset email and the new password"
+// @Success 200 {object} models.MessageSuccessResponse "Password changed"
+// @Failure 400 {object} models.ErrorResponse "Invalid or expired token"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/auth/reset-password [post]
+func ResetPassword(c *fiber.Ctx) error {
+	var req models.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Token is required",
+		})
+	}
+	if len(req.NewPassword) < models.MinPasswordLength {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "New password must be at least 6 characters",
+		})
+	}
+
+	if err := accounts.ResetPassword(req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Invalid or expired token",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to reset password",
+		})
+	}
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Password changed",
+		Data: models.MessageData{
+			Message: "You can log in with your new password.",
+		},
+	})
+}
+
+// tooManyAttempts turns away a login that must wait for wait.
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(models.ErrorResponse{
+		Status: "error",
+		Error:  fmt.Sprintf("Too many failed login attempts; try again in %s", waitText(seconds)),
+	})
+}
+
+// waitText describes a wait of seconds in words.
+func waitText(seconds int) string {
+	switch {
+	case seconds == 1:
+		return "1 second"
+	case seconds < 60:
+		return fmt.Sprintf("%d seconds", seconds)
+	case seconds < 120:
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", (seconds+59)/60)
+}
+
+// issueToken starts a session for user on the device making the request,
+// named deviceName, and returns a token for it.
+func issueToken(c *fiber.Ctx, user *models.User, deviceName string) (string, error) {
+	session, err := accounts.StartSession(database.DB, user.ID, deviceName, c.Get(fiber.HeaderUserAgent), middleware.ClientIP(c))
+	if err != nil {
+		return "", err
+	}
+	return generateJWT(user, session)
+}
+
+// generateJWT issues a token for user's session. It carries the session ID,
+// so revoking the session revokes it, and the user's token version, so
+// bumping the version revokes it.
+func generateJWT(user *models.User, session *models.Session) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
+		"user_id": user.ID.String(),
+		"sid":     session.ID.String(),
+		"ver":     user.TokenVersion,
+		"exp":     session.ExpiresAt.Unix(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return tokens.Sign(claims)
 }
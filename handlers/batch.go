@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BatchNotes godoc
+// @Summary Apply an action to many notes
+// @Description Delete, archive, restore (unarchive), tag, untag or move many notes at once. Deleting is permanent; restore brings archived notes back. move puts the notes, in the order given (or listed, with a filter), right before the note in before in the manual order, or at the end without it. Select the notes either by note_ids or by filter, a query string with the filters of GET /api/notes (e.g. "archived=only&tag=old"). All changes are made in one transaction: either every note is changed or, on an error, none is. Each selected note gets a result: applied, unchanged if it was already in the requested state, or not_found for IDs that do not exist or belong to someone else. At most 1000 notes can be changed at once.
+// @Tags Notes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.BatchNotesRequest true "Action and the notes to apply it to"
+// @Success 200 {object} models.BatchNotesSuccessResponse "Results per note"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/batch [post]
+func BatchNotes(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req models.BatchNotesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+
+	var change func(*models.Note) bool
+	var before *uuid.UUID
+	switch req.Action {
+	case models.BatchDelete:
+	case models.BatchArchive:
+		change = func(n *models.Note) bool { return setFlag(&n.Archived, true) }
+	case models.BatchRestore:
+		change = func(n *models.Note) bool { return setFlag(&n.Archived, false) }
+	case models.BatchMove:
+		if req.Before != "" {
+			id, err := uuid.Parse(req.Before)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+					Status: "error",
+					Error:  "before must be a note ID",
+				})
+			}
+			before = &id
+		}
+	case models.BatchTag, models.BatchUntag:
+		tags, err := models.NormalizeTags(req.Tags)
+		if err == nil && len(tags) == 0 {
+			err = errors.New("tags is required for " + req.Action)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  err.Error(),
+			})
+		}
+		if req.Action == models.BatchTag {
+			change = func(n *models.Note) bool { return addTags(n, tags) }
+		} else {
+			change = func(n *models.Note) bool { return removeTags(n, tags) }
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Action must be delete, archive, restore, tag, untag or move",
+		})
+	}
+
+	if (len(req.NoteIDs) == 0) == (req.Filter == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Either note_ids or filter is required",
+		})
+	}
+	if len(req.NoteIDs) > models.MaxBatchNotes {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "At most " + strconv.Itoa(models.MaxBatchNotes) + " notes can be changed at once",
+		})
+	}
+
+	// Notes are selected within the transaction and locked until it ends.
+	// slots[i] is the index of the result for notes[i].
+	selectNotes := func(tx *gorm.DB) (notes []models.Note, results []models.BatchNoteResult, slots []int, err error) {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID)
+		if req.Filter != "" {
+			var args fasthttp.Args
+			args.Parse(strings.TrimPrefix(req.Filter, "?"))
+			filter, err := parseNoteFilter(&args, userID)
+			if err != nil {
+				return nil, nil, nil, fiber.NewError(fiber.StatusBadRequest, "Invalid filter: "+err.Error())
+			}
+			if err := applyNoteFilter(query, filter).Order(noteOrder).Limit(models.MaxBatchNotes + 1).Find(&notes).Error; err != nil {
+				return nil, nil, nil, err
+			}
+			if len(notes) > models.MaxBatchNotes {
+				return nil, nil, nil, fiber.NewError(fiber.StatusBadRequest,
+					"Filter matches more than "+strconv.Itoa(models.MaxBatchNotes)+" notes; narrow it down")
+			}
+			results = make([]models.BatchNoteResult, len(notes))
+			for i := range notes {
+				results[i].ID = notes[i].ID.String()
+				slots = append(slots, i)
+			}
+			return notes, results, slots, nil
+		}
+
+		var ids []uuid.UUID
+		for _, raw := range req.NoteIDs {
+			if id, err := uuid.Parse(raw); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		var found []models.Note
+		if len(ids) > 0 {
+			if err := query.Where("id IN ?", ids).Find(&found).Error; err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		byID := make(map[uuid.UUID]models.Note, len(found))
+		for _, note := range found {
+			byID[note.ID] = note
+		}
+
+		results = make([]models.BatchNoteResult, len(req.NoteIDs))
+		seen := map[uuid.UUID]bool{}
+		for i, raw := range req.NoteIDs {
+			results[i].ID = raw
+			id, _ := uuid.Parse(raw)
+			note, ok := byID[id]
+			if !ok {
+				results[i].Status = "not_found"
+				results[i].Error = "Note not found"
+				continue
+			}
+			if seen[note.ID] {
+				return nil, nil, nil, fiber.NewError(fiber.StatusBadRequest, "Note listed twice: "+raw)
+			}
+			seen[note.ID] = true
+			notes = append(notes, note)
+			slots = append(slots, i)
+		}
+		return notes, results, slots, nil
+	}
+
+	var results []models.BatchNoteResult
+	var changed []models.Note
+	var moved []uuid.UUID
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		notes, selected, slots, err := selectNotes(tx)
+		if err != nil {
+			return err
+		}
+		results = selected
+
+		if req.Action == models.BatchMove {
+			if moved, err = moveNotes(tx, userID, notes, before); err != nil {
+				return err
+			}
+			for i := range notes {
+				results[slots[i]].Status = "unchanged"
+				if slices.Contains(moved, notes[i].ID) {
+					results[slots[i]].Status = "applied"
+					changed = append(changed, notes[i])
+				}
+			}
+			return nil
+		}
+
+		for i := range notes {
+			note := &notes[i]
+			result := &results[slots[i]]
+
+			if req.Action == models.BatchDelete {
+				if err := deleteNote(tx, note); err != nil {
+					return err
+				}
+			} else {
+				if !change(note) {
+					result.Status = "unchanged"
+					continue
+				}
+				if err := saveNote(tx, note); err != nil {
+					return err
+				}
+			}
+			result.Status = "applied"
+			changed = append(changed, *note)
+		}
+		return nil
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	// Moving may renumber notes that were not selected, too
+	publishNotesUpdated(moved)
+	for i := range changed {
+		note := &changed[i]
+		if req.Action == models.BatchMove {
+			continue
+		}
+		if req.Action == models.BatchDelete {
+			if note.ImagePath != "" {
+				os.Remove(note.ImagePath)
+			}
+			publishNoteEvent(events.NoteDeleted, note)
+			continue
+		}
+		loadItems(database.DB, note)
+		publishNoteEvent(events.NoteUpdated, note)
+	}
+
+	return c.JSON(models.BatchNotesSuccessResponse{
+		Status:  "success",
+		Message: "Batch " + req.Action + " completed",
+		Data: models.BatchNotesData{
+			Action:  req.Action,
+			Results: results,
+			Applied: len(changed),
+		},
+	})
+}
+
+// moveNotes moves notes, keeping their order, right before the note before
+// in userID's manual order, or to the end of it if before is nil. It returns
+// the IDs of the notes whose position changed.
+func moveNotes(tx *gorm.DB, userID string, notes []models.Note, before *uuid.UUID) ([]uuid.UUID, error) {
+	if len(notes) == 0 {
+		return nil, nil
+	}
+	all, current, err := manualOrder(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	moving := make(map[uuid.UUID]bool, len(notes))
+	for i := range notes {
+		moving[notes[i].ID] = true
+	}
+	if before != nil && moving[*before] {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Notes cannot be moved before one of themselves")
+	}
+
+	order := make([]uuid.UUID, 0, len(all))
+	at := -1
+	for _, id := range all {
+		if before != nil && id == *before {
+			at = len(order)
+		}
+		if !moving[id] {
+			order = append(order, id)
+		}
+	}
+	if before == nil {
+		at = len(order)
+	} else if at < 0 {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Note not found: "+before.String())
+	}
+
+	ids := make([]uuid.UUID, len(notes))
+	slots := make([]int, len(notes))
+	for i := range notes {
+		ids[i] = notes[i].ID
+		slots[i] = at + i
+	}
+	order = slices.Insert(order, at, ids...)
+	return positionNotes(tx, order, current, slots)
+}
+
+// setFlag sets *flag to value and reports whether that changed it.
+func setFlag(flag *bool, value bool) bool {
+	if *flag == value {
+		return false
+	}
+	*flag = value
+	return true
+}
+
+// addTags adds the tags a note does not have yet and reports whether there
+// were any.
+func addTags(note *models.Note, tags []string) bool {
+	merged, _ := models.NormalizeTags(append(append([]string{}, note.Tags...), tags...))
+	if len(merged) == len(note.Tags) {
+		return false
+	}
+	note.Tags = merged
+	return true
+}
+
+// removeTags removes tags from a note, ignoring case, and reports whether it
+// had any of them.
+func removeTags(note *models.Note, tags []string) bool {
+	remove := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		remove[strings.ToLower(tag)] = true
+	}
+	kept := []string{}
+	for _, tag := range note.Tags {
+		if !remove[strings.ToLower(tag)] {
+			kept = append(kept, tag)
+		}
+	}
+	if len(kept) == len(note.Tags) {
+		return false
+	}
+	note.Tags = kept
+	return true
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// taskLine matches Markdown task list entries such as "- [ ] buy milk".
+var taskLine = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*)$`)
+
+// AddChecklistItem godoc
+// @Summary Add a checklist item
+// @Description Add an item to a checklist note, at the end or at the given position
+// @Tags Checklists
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Param request body models.ChecklistItemRequest true "Item to add"
+// @Success 201 {object} models.NoteSuccessResponse "Item added; returns the note with all items"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body or not a checklist"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/items [post]
+func AddChecklistItem(c *fiber.Ctx) error {
+	note, err := findChecklistNote(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var req models.ChecklistItemRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Text) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Item text is required",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.ChecklistItem{}).Where("note_id = ?", note.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		position := int(count)
+		if req.Position != nil && *req.Position >= 0 && *req.Position < position {
+			position = *req.Position
+			if err := tx.Model(&models.ChecklistItem{}).
+				Where("note_id = ? AND position >= ?", note.ID, position).
+				Update("position", gorm.Expr("position + 1")).Error; err != nil {
+				return err
+			}
+		}
+
+		item := models.ChecklistItem{
+			NoteID:   note.ID,
+			Text:     req.Text,
+			Checked:  req.Checked,
+			Position: position,
+			DueAt:    req.DueAt,
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		return saveNote(tx, note)
+	})
+	return checklistResponse(c, note, err, fiber.StatusCreated, "Item added successfully")
+}
+
+// UpdateChecklistItem godoc
+// @Summary Update a checklist item
+// @Description Change an item's text, checked state or due date. Omitted fields are unchanged; "due_at": null clears the due date.
+// @Tags Checklists
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param itemId path string true "Item ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Param request body models.UpdateChecklistItemRequest true "Fields to change"
+// @Success 200 {object} models.NoteSuccessResponse "Item updated; returns the note with all items"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body or not a checklist"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note or item not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/items/{itemId} [patch]
+func UpdateChecklistItem(c *fiber.Ctx) error {
+	note, err := findChecklistNote(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var req models.UpdateChecklistItemRequest
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &req); err != nil || json.Unmarshal(c.Body(), &raw) != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	if req.Text != nil && strings.TrimSpace(*req.Text) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Item text cannot be empty",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		item, err := findChecklistItem(tx, note, c.Params("itemId"))
+		if err != nil {
+			return err
+		}
+		if req.Text != nil {
+			item.Text = *req.Text
+		}
+		if req.Checked != nil {
+			item.Checked = *req.Checked
+		}
+		if _, present := raw["due_at"]; present {
+			item.DueAt = req.DueAt
+		}
+		if err := tx.Save(item).Error; err != nil {
+			return err
+		}
+		return saveNote(tx, note)
+	})
+	return checklistResponse(c, note, err, fiber.StatusOK, "Item updated successfully")
+}
+
+// ToggleChecklistItem godoc
+// @Summary Toggle a checklist item
+// @Description Flip an item between checked and unchecked
+// @Tags Checklists
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param itemId path string true "Item ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Item toggled; returns the note with all items"
+// @Failure 400 {object} models.ErrorResponse "Not a checklist"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note or item not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/items/{itemId}/toggle [post]
+func ToggleChecklistItem(c *fiber.Ctx) error {
+	note, err := findChecklistNote(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		item, err := findChecklistItem(tx, note, c.Params("itemId"))
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(item).Update("checked", !item.Checked).Error; err != nil {
+			return err
+		}
+		return saveNote(tx, note)
+	})
+	return checklistResponse(c, note, err, fiber.StatusOK, "Item toggled successfully")
+}
+
+// ReorderChecklistItems godoc
+// @Summary Reorder checklist items
+// @Description Set the order of all items of a checklist note. item_ids must list every item exactly once.
+// @Tags Checklists
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Param request body models.ReorderChecklistRequest true "Item IDs in their new order"
+// @Success 200 {object} models.NoteSuccessResponse "Items reordered; returns the note with all items"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body or not a checklist"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/items/order [put]
+func ReorderChecklistItems(c *fiber.Ctx) error {
+	note, err := findChecklistNote(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var req models.ReorderChecklistRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var items []models.ChecklistItem
+		if err := tx.Where("note_id = ?", note.ID).Find(&items).Error; err != nil {
+			return err
+		}
+
+		existing := make(map[uuid.UUID]bool, len(items))
+		for _, item := range items {
+			existing[item.ID] = true
+		}
+		if len(req.ItemIDs) != len(items) {
+			return fiber.NewError(fiber.StatusBadRequest, "item_ids must list every item exactly once")
+		}
+		for _, id := range req.ItemIDs {
+			if !existing[id] {
+				return fiber.NewError(fiber.StatusBadRequest, "item_ids must list every item exactly once")
+			}
+			delete(existing, id)
+		}
+
+		for position, id := range req.ItemIDs {
+			if err := tx.Model(&models.ChecklistItem{}).Where("id = ?", id).
+				Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return saveNote(tx, note)
+	})
+	return checklistResponse(c, note, err, fiber.StatusOK, "Items reordered successfully")
+}
+
+// DeleteChecklistItem godoc
+// @Summary Delete a checklist item
+// @Description Remove an item from a checklist note
+// @Tags Checklists
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param itemId path string true "Item ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Item deleted; returns the note with the remaining items"
+// @Failure 400 {object} models.ErrorResponse "Not a checklist"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note or item not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/items/{itemId} [delete]
+func DeleteChecklistItem(c *fiber.Ctx) error {
+	note, err := findChecklistNote(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		item, err := findChecklistItem(tx, note, c.Params("itemId"))
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(item).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ChecklistItem{}).
+			Where("note_id = ? AND position > ?", note.ID, item.Position).
+			Update("position", gorm.Expr("position - 1")).Error; err != nil {
+			return err
+		}
+		return saveNote(tx, note)
+	})
+	return checklistResponse(c, note, err, fiber.StatusOK, "Item deleted successfully")
+}
+
+// findChecklistNote loads the checklist note in :id for the authenticated
+// user and checks If-Match.
+func findChecklistNote(c *fiber.Ctx) (*models.Note, error) {
+	userID := middleware.GetUserID(c)
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&note).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Note not found")
+	}
+	if note.Type != models.NoteTypeChecklist {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Note is not a checklist")
+	}
+	if preconditionFailed(c, &note) {
+		return nil, errVersionConflict
+	}
+	return &note, nil
+}
+
+func findChecklistItem(tx *gorm.DB, note *models.Note, itemID string) (*models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	if err := tx.Where("id = ? AND note_id = ?", itemID, note.ID).First(&item).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Item not found")
+	}
+	return &item, nil
+}
+
+// checklistResponse finishes an item operation: it reports err, or publishes
+// the change and returns the note with its items.
+func checklistResponse(c *fiber.Ctx, note *models.Note, err error, status int, message string) error {
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	if err := loadItems(database.DB, note); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to load items",
+		})
+	}
+	publishNoteEvent(events.NoteUpdated, note)
+
+	setImageURL(c, note)
+	c.Set(fiber.HeaderETag, noteETag(note))
+
+	return c.Status(status).JSON(models.NoteSuccessResponse{
+		Status:  "success",
+		Message: message,
+		Data: models.NoteData{
+			Note: *note,
+		},
+	})
+}
+
+// errorResponse writes err as an error response: *fiber.Error keeps its code
+// and message, a version conflict becomes 409 or 412 (see conflictResponse)
+// and anything else 500.
+func errorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errVersionConflict) {
+		return conflictResponse(c)
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return c.Status(fe.Code).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  fe.Message,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+		Status: "error",
+		Error:  "Internal server error",
+	})
+}
+
+// splitTaskLines moves Markdown task list lines out of content into
+// checklist items, starting at position start.
+func splitTaskLines(content string, start int) (string, []models.ChecklistItem) {
+	var rest []string
+	var items []models.ChecklistItem
+	for _, line := range strings.Split(content, "\n") {
+		m := taskLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			rest = append(rest, line)
+			continue
+		}
+		items = append(items, models.ChecklistItem{
+			Text:     m[2],
+			Checked:  m[1] != " ",
+			Position: start + len(items),
+		})
+	}
+	return strings.TrimSpace(strings.Join(rest, "\n")), items
+}
+
+// joinTaskLines appends items to content as a Markdown task list.
+func joinTaskLines(content string, items []models.ChecklistItem) string {
+	var b strings.Builder
+	b.WriteString(content)
+	if content != "" && len(items) > 0 {
+		b.WriteString("\n\n")
+	}
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if item.Checked {
+			b.WriteString("- [x] ")
+		} else {
+			b.WriteString("- [ ] ")
+		}
+		b.WriteString(item.Text)
+	}
+	return b.String()
+}
+
+// convertNoteType moves a note's content between its text and its checklist
+// items after its type changed from oldType: task lines become items, and
+// items are written back as task lines.
+func convertNoteType(tx *gorm.DB, note *models.Note, oldType string) error {
+	if note.Type == oldType {
+		return nil
+	}
+
+	if note.Type == models.NoteTypeChecklist {
+		var count int64
+		if err := tx.Model(&models.ChecklistItem{}).Where("note_id = ?", note.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		content, items := splitTaskLines(note.Content, int(count))
+		note.Content = content
+		for i := range items {
+			items[i].NoteID = note.ID
+		}
+		if len(items) > 0 {
+			return tx.Create(&items).Error
+		}
+		return nil
+	}
+
+	var items []models.ChecklistItem
+	if err := tx.Where("note_id = ?", note.ID).Order("position").Find(&items).Error; err != nil {
+		return err
+	}
+	note.Content = joinTaskLines(note.Content, items)
+	return tx.Where("note_id = ?", note.ID).Delete(&models.ChecklistItem{}).Error
+}
+
+// attachChecklistSummaries sets the completion counts of the checklist notes
+// in a listing.
+func attachChecklistSummaries(tx *gorm.DB, notes []models.Note) error {
+	var ids []uuid.UUID
+	for _, note := range notes {
+		if note.Type == models.NoteTypeChecklist {
+			ids = append(ids, note.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rows []struct {
+		NoteID  uuid.UUID
+		Total   int
+		Checked int
+	}
+	if err := tx.Model(&models.ChecklistItem{}).
+		Select("note_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE checked) AS checked").
+		Where("note_id IN ?", ids).Group("note_id").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	summaries := make(map[uuid.UUID]*models.ChecklistSummary, len(rows))
+	for _, row := range rows {
+		summaries[row.NoteID] = &models.ChecklistSummary{Total: row.Total, Checked: row.Checked}
+	}
+	for i := range notes {
+		if notes[i].Type != models.NoteTypeChecklist {
+			continue
+		}
+		if summary, ok := summaries[notes[i].ID]; ok {
+			notes[i].Checklist = summary
+		} else {
+			notes[i].Checklist = &models.ChecklistSummary{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,615 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/ot"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	collabSyncInterval  = 10 * time.Second
+	collabTypingTimeout = 3 * time.Second
+	collabSendBuffer    = 64
+	collabMaxLength     = models.MaxContentLength
+	// collabMaxHistory is how many operations a session keeps for clients
+	// editing against an old revision. Clients further behind are sent the
+	// document again.
+	collabMaxHistory = 1000
+)
+
+type collabParticipant struct {
+	ClientID string    `json:"client_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Cursor   *int      `json:"cursor,omitempty"`
+}
+
+// collabMessage is exchanged in both directions on a collaboration socket.
+type collabMessage struct {
+	Type         string              `json:"type"`
+	Revision     int                 `json:"revision"`
+	Op           *ot.Operation       `json:"op,omitempty"`
+	Content      *string             `json:"content,omitempty"`
+	ClientID     string              `json:"client_id,omitempty"`
+	State        string              `json:"state,omitempty"`
+	Cursor       *int                `json:"cursor,omitempty"`
+	Participants []collabParticipant `json:"participants,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+type collabClient struct {
+	id       string
+	userID   uuid.UUID
+	name     string
+	state    string
+	cursor   *int
+	typingAt time.Time
+	revision int
+	send     chan collabMessage
+	once     sync.Once
+}
+
+func (c *collabClient) close() {
+	c.once.Do(func() { close(c.send) })
+}
+
+// collabSession holds the live document of a note being edited together.
+// Sessions live in memory, so all participants of a note must be routed to
+// the same replica.
+//
+// base is the note's content at version, as last loaded or saved, and
+// pending the operation that turns it into content. Changes made to the note
+// outside the session are merged in by transforming them against pending.
+// history holds the operations since revision first, the oldest any client
+// can still send an operation against.
+type collabSession struct {
+	mu       sync.Mutex
+	noteID   uuid.UUID
+	ownerID  uuid.UUID
+	content  string
+	revision int
+	first    int
+	history  []*ot.Operation
+	base     string
+	version  int
+	pending  *ot.Operation
+	clients  map[*collabClient]struct{}
+	dirty    bool
+	edited   bool
+	syncedAt time.Time
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// collabHub holds the sessions in progress, and those being ended, which
+// new participants wait for so they load the content saved at the end.
+var collabHub = struct {
+	sync.Mutex
+	sessions map[uuid.UUID]*collabSession
+	ending   map[uuid.UUID]chan struct{}
+}{sessions: map[uuid.UUID]*collabSession{}, ending: map[uuid.UUID]chan struct{}{}}
+
+// CollabSession godoc
+// @Summary Edit a note's content together in real time
+// @Description Upgrade to a WebSocket for collaborative editing of a note's content using operational transformation (ot.js operation format). The server first sends {"type": "init", "revision", "content", "client_id", "participants"}. Clients send {"type": "op", "revision", "op"} with the revision their edit is based on and receive "ack" for their own operations and "op" for everyone else's. {"type": "presence", "state": "viewing|typing", "cursor"} updates presence, broadcast to all as "presence" with the participant list. Changes made to the note elsewhere while it is being edited are merged in and sent as an "op" without a client_id. An operation based on a revision too old to transform is refused with an "error" and the document is sent again as "init". Content is saved to the note every few seconds, and a revision is recorded when the last participant leaves.
+// @Tags Realtime
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param access_token query string false "JWT, for clients that cannot set headers"
+// @Success 101 "Switching protocols"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 426 {object} models.ErrorResponse "WebSocket upgrade required"
+// @Router /api/collab/{id} [get]
+func CollabSession(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+
+	c.Locals("note_id", note.ID)
+	return collabSocket(c)
+}
+
+var collabSocket = websocket.New(collabConnection)
+
+func collabConnection(conn *websocket.Conn) {
+	noteID := conn.Locals("note_id").(uuid.UUID)
+	userID, _ := uuid.Parse(conn.Locals("user_id").(string))
+
+	var user models.User
+	database.DB.Select("name").Where("id = ?", userID).First(&user)
+
+	session, client, err := joinCollab(noteID, userID, user.Name)
+	if err != nil {
+		conn.WriteJSON(collabMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	// The connection must not be used once this handler returns, so it waits
+	// for the writer, which stops once the client has left
+	written := make(chan struct{})
+	defer func() {
+		leaveCollab(session, client)
+		<-written
+	}()
+
+	go func() {
+		defer close(written)
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		defer conn.Close()
+		for {
+			select {
+			case msg, ok := <-client.send:
+				if !ok {
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				if err := conn.WriteJSON(msg); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var msg collabMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "op":
+			if msg.Op == nil {
+				session.reply(client, collabMessage{Type: "error", Error: "op is required"})
+				continue
+			}
+			if err := session.apply(client, msg.Revision, msg.Op); err != nil {
+				session.reply(client, collabMessage{Type: "error", Error: err.Error()})
+			}
+		case "presence":
+			session.updatePresence(client, msg.State, msg.Cursor)
+		default:
+			session.reply(client, collabMessage{Type: "error", Error: "Unknown message type"})
+		}
+	}
+}
+
+func joinCollab(noteID, userID uuid.UUID, name string) (*collabSession, *collabClient, error) {
+	client := &collabClient{
+		id:     uuid.New().String(),
+		userID: userID,
+		name:   name,
+		state:  "viewing",
+		send:   make(chan collabMessage, collabSendBuffer),
+	}
+
+	var note *models.Note
+	for {
+		collabHub.Lock()
+		if done, ok := collabHub.ending[noteID]; ok {
+			collabHub.Unlock()
+			<-done
+			note = nil
+			continue
+		}
+		session := collabHub.sessions[noteID]
+		if session == nil && note != nil {
+			session = newCollabSession(note)
+			collabHub.sessions[noteID] = session
+			go session.run()
+		}
+		if session != nil {
+			session.join(client)
+			collabHub.Unlock()
+			return session, client, nil
+		}
+		collabHub.Unlock()
+
+		// Loaded without holding the hub lock; should the note change before
+		// the session starts, the session merges the change in
+		note = &models.Note{}
+		if err := database.DB.Where("id = ?", noteID).First(note).Error; err != nil {
+			return nil, nil, errors.New("Note not found")
+		}
+	}
+}
+
+func newCollabSession(note *models.Note) *collabSession {
+	return &collabSession{
+		noteID:   note.ID,
+		ownerID:  note.UserID,
+		content:  note.Content,
+		base:     note.Content,
+		version:  note.Version,
+		pending:  ot.Diff(note.Content, note.Content),
+		clients:  map[*collabClient]struct{}{},
+		syncedAt: time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// join adds a client and sends it the document.
+func (s *collabSession) join(client *collabClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client] = struct{}{}
+	client.send <- s.init(client)
+	s.broadcastPresence()
+}
+
+// init is the message giving a client the document at the current revision,
+// which its next operation may be based on. The caller must hold s.mu.
+func (s *collabSession) init(client *collabClient) collabMessage {
+	client.revision = s.revision
+	content := s.content
+	return collabMessage{
+		Type:         "init",
+		Revision:     s.revision,
+		Content:      &content,
+		ClientID:     client.id,
+		Participants: s.participants(),
+	}
+}
+
+// leaveCollab removes a client. The last one to leave ends the session,
+// saving the content and recording a revision if it was edited. That happens
+// without holding the hub lock; anyone joining the note meanwhile waits for
+// it to finish.
+func leaveCollab(session *collabSession, client *collabClient) {
+	collabHub.Lock()
+	session.mu.Lock()
+	delete(session.clients, client)
+	client.close()
+	remaining := len(session.clients)
+	if remaining > 0 {
+		session.broadcastPresence()
+	}
+	session.mu.Unlock()
+	if remaining > 0 {
+		collabHub.Unlock()
+		return
+	}
+
+	delete(collabHub.sessions, session.noteID)
+	done := make(chan struct{})
+	collabHub.ending[session.noteID] = done
+	collabHub.Unlock()
+
+	close(session.stop)
+	<-session.stopped
+	session.end()
+
+	collabHub.Lock()
+	delete(collabHub.ending, session.noteID)
+	collabHub.Unlock()
+	close(done)
+}
+
+func (s *collabSession) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			changed := false
+			for client := range s.clients {
+				if client.state == "typing" && time.Since(client.typingAt) > collabTypingTimeout {
+					client.state = "viewing"
+					changed = true
+				}
+			}
+			if changed {
+				s.broadcastPresence()
+			}
+			due := time.Since(s.syncedAt) >= collabSyncInterval
+			s.mu.Unlock()
+
+			if due {
+				s.sync()
+			}
+		}
+	}
+}
+
+// apply transforms an operation made at revision against everything applied
+// since, applies it and forwards it to the other participants. A client
+// whose revision is no longer in the history is sent the document again.
+func (s *collabSession) apply(client *collabClient, revision int, op *ot.Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if revision < 0 || revision > s.revision {
+		return errors.New("Unknown revision")
+	}
+	if revision < s.first {
+		s.send(client, s.init(client))
+		return errors.New("Revision is too old; the document was sent again")
+	}
+	client.revision = revision
+	for _, concurrent := range s.history[revision-s.first:] {
+		var err error
+		if op, _, err = ot.Transform(op, concurrent); err != nil {
+			return errors.New("Operation does not match the document at that revision")
+		}
+	}
+	if op.TargetLength() > collabMaxLength {
+		return errors.New("Content is too long")
+	}
+	content, err := op.Apply(s.content)
+	if err != nil {
+		return errors.New("Operation does not match the document at that revision")
+	}
+	pending, err := ot.Compose(s.pending, op)
+	if err != nil {
+		return errors.New("Operation does not match the document at that revision")
+	}
+
+	s.content = content
+	s.pending = pending
+	s.record(op)
+	s.dirty = true
+	s.edited = true
+
+	client.typingAt = time.Now()
+	wasTyping := client.state == "typing"
+	client.state = "typing"
+
+	s.send(client, collabMessage{Type: "ack", Revision: s.revision})
+	for c := range s.clients {
+		if c != client {
+			s.send(c, collabMessage{Type: "op", Revision: s.revision, Op: op, ClientID: client.id})
+		}
+	}
+	if !wasTyping {
+		s.broadcastPresence()
+	}
+	return nil
+}
+
+func (s *collabSession) updatePresence(client *collabClient, state string, cursor *int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state == "typing" || state == "viewing" {
+		client.state = state
+		if state == "typing" {
+			client.typingAt = time.Now()
+		}
+	}
+	if cursor != nil {
+		client.cursor = cursor
+	}
+	s.broadcastPresence()
+}
+
+func (s *collabSession) reply(client *collabClient, msg collabMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.send(client, msg)
+}
+
+// send queues a message for a client, dropping the client if it cannot keep
+// up. The caller must hold s.mu.
+func (s *collabSession) send(client *collabClient, msg collabMessage) {
+	if _, ok := s.clients[client]; !ok {
+		return
+	}
+	select {
+	case client.send <- msg:
+	default:
+		delete(s.clients, client)
+		client.close()
+	}
+}
+
+// participants lists who is in the session. The caller must hold s.mu.
+func (s *collabSession) participants() []collabParticipant {
+	list := make([]collabParticipant, 0, len(s.clients))
+	for c := range s.clients {
+		list = append(list, collabParticipant{
+			ClientID: c.id,
+			UserID:   c.userID,
+			Name:     c.name,
+			State:    c.state,
+			Cursor:   c.cursor,
+		})
+	}
+	return list
+}
+
+// broadcastPresence sends the participant list to everyone. The caller must
+// hold s.mu.
+func (s *collabSession) broadcastPresence() {
+	msg := collabMessage{Type: "presence", Revision: s.revision, Participants: s.participants()}
+	for c := range s.clients {
+		s.send(c, msg)
+	}
+}
+
+// record adds an applied operation to the history and moves the cursors.
+// The caller must hold s.mu.
+func (s *collabSession) record(op *ot.Operation) {
+	s.history = append(s.history, op)
+	s.revision++
+	for c := range s.clients {
+		if c.cursor != nil {
+			cursor := op.TransformIndex(*c.cursor)
+			c.cursor = &cursor
+		}
+	}
+	s.trim()
+}
+
+// trim drops the operations before the oldest revision a client last sent
+// an operation against or joined at, keeping at most collabMaxHistory. The
+// caller must hold s.mu.
+func (s *collabSession) trim() {
+	first := s.revision
+	for c := range s.clients {
+		if c.revision < first {
+			first = c.revision
+		}
+	}
+	if first < s.revision-collabMaxHistory {
+		first = s.revision - collabMaxHistory
+	}
+	if first > s.first {
+		s.history = s.history[first-s.first:]
+		s.first = first
+	}
+}
+
+// rebase merges a change made to the note outside the session, which left it
+// with content at version, into the session and sends it to everyone. The
+// caller must hold s.mu.
+func (s *collabSession) rebase(content string, version int) {
+	external := ot.Diff(s.base, content)
+	pending, external, err := ot.Transform(s.pending, external)
+	if err != nil {
+		// Cannot happen while pending applies to base; start over from the
+		// note's content rather than keep a document that cannot be saved
+		log.Printf("Collaboration session of note %s could not merge a change: %v", s.noteID, err)
+		external = ot.Diff(s.content, content)
+		pending = ot.Diff(content, content)
+	}
+	merged, err := external.Apply(s.content)
+	if err != nil {
+		log.Printf("Collaboration session of note %s could not merge a change: %v", s.noteID, err)
+		return
+	}
+
+	s.base, s.version, s.pending = content, version, pending
+	if external.IsNoop() {
+		return
+	}
+	s.content = merged
+	s.record(external)
+	for c := range s.clients {
+		s.send(c, collabMessage{Type: "op", Revision: s.revision, Op: external})
+	}
+}
+
+// saved records that content, the document at revision, was saved as
+// version. The caller must hold s.mu.
+func (s *collabSession) saved(content string, version, revision int) {
+	if revision < s.first {
+		// The edits since are no longer kept; diff against them instead
+		s.base, s.version, s.pending = content, version, ot.Diff(content, s.content)
+		return
+	}
+	pending := ot.Diff(content, content)
+	for _, op := range s.history[revision-s.first:] {
+		composed, err := ot.Compose(pending, op)
+		if err != nil {
+			log.Printf("Collaboration session of note %s lost track of its edits: %v", s.noteID, err)
+			composed = ot.Diff(content, s.content)
+			pending = composed
+			break
+		}
+		pending = composed
+	}
+	s.base, s.version, s.pending = content, version, pending
+}
+
+// sync merges changes made to the note elsewhere, through the REST API or
+// sync, into the session, and writes the session's content back into the
+// note if it was edited. It returns the note if it was saved.
+func (s *collabSession) sync() (*models.Note, bool) {
+	s.mu.Lock()
+	s.syncedAt = time.Now()
+	s.mu.Unlock()
+
+	// Retry if the note changes again while being saved
+	for attempt := 0; attempt < 3; attempt++ {
+		var note models.Note
+		if err := database.DB.Where("id = ?", s.noteID).First(&note).Error; err != nil {
+			log.Printf("Collaboration sync of note %s failed: %v", s.noteID, err)
+			return nil, false
+		}
+
+		s.mu.Lock()
+		if note.Version != s.version {
+			s.rebase(note.Content, note.Version)
+		}
+		if !s.dirty {
+			s.mu.Unlock()
+			return nil, false
+		}
+		content, revision := s.content, s.revision
+		s.dirty = false
+		s.mu.Unlock()
+
+		note.Content = content
+		err := saveNote(database.DB, &note)
+		if err == nil {
+			s.mu.Lock()
+			s.saved(content, note.Version, revision)
+			s.mu.Unlock()
+			publishNoteEvent(events.NoteUpdated, &note)
+			return &note, true
+		}
+
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		if !errors.Is(err, errVersionConflict) {
+			log.Printf("Collaboration sync of note %s failed: %v", s.noteID, err)
+			return nil, false
+		}
+	}
+
+	log.Printf("Collaboration sync of note %s failed: the note keeps changing", s.noteID)
+	return nil, false
+}
+
+// end saves the final content and records a revision of the edited note.
+func (s *collabSession) end() {
+	note, saved := s.sync()
+	if !s.edited {
+		return
+	}
+	if !saved {
+		note = &models.Note{}
+		if err := database.DB.Where("id = ?", s.noteID).First(note).Error; err != nil {
+			return
+		}
+	}
+
+	revision := models.NoteRevision{
+		NoteID:  note.ID,
+		UserID:  s.ownerID,
+		Version: note.Version,
+		Title:   note.Title,
+		Content: note.Content,
+		Reason:  "collaboration",
+	}
+	if err := database.DB.Create(&revision).Error; err != nil {
+		log.Printf("Failed to record revision of note %s: %v", s.noteID, err)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+
+	"notes-api/ot"
+)
+
+func TestCollabTrim(t *testing.T) {
+	tests := []struct {
+		name      string
+		clients   []int
+		revision  int
+		wantFirst int
+	}{
+		{name: "no clients", revision: 10, wantFirst: 10},
+		{name: "oldest client", clients: []int{4, 7}, revision: 10, wantFirst: 4},
+		{name: "clients up to date", clients: []int{10, 10}, revision: 10, wantFirst: 10},
+		{name: "client too far behind", clients: []int{0}, revision: collabMaxHistory + 5, wantFirst: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &collabSession{clients: map[*collabClient]struct{}{}}
+			for _, revision := range tt.clients {
+				s.clients[&collabClient{revision: revision}] = struct{}{}
+			}
+			for s.revision < tt.revision {
+				s.content += "a"
+				s.record(ot.Diff(s.content[1:], s.content))
+			}
+			if s.first != tt.wantFirst || len(s.history) != s.revision-s.first {
+				t.Errorf("got history of %d from %d, want from %d", len(s.history), s.first, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestCollabSavedAfterTrim(t *testing.T) {
+	s := &collabSession{clients: map[*collabClient]struct{}{}}
+	for _, content := range []string{"a", "ab", "abc"} {
+		s.record(ot.Diff(s.content, content))
+		s.content = content
+	}
+	// The saved revision was trimmed away; pending must still reach content
+	s.saved("a", 2, 1)
+	if got, err := s.pending.Apply("a"); err != nil || got != "abc" {
+		t.Errorf("got %q, %v, want %q", got, err, "abc")
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"notes-api/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// noteETag returns the strong entity tag of a single note, derived from its
+// ID and version.
+func noteETag(note *models.Note) string {
+	return fmt.Sprintf(`"%s-%d"`, note.ID, note.Version)
+}
+
+// notesETag returns the entity tag of a list of notes. It changes whenever a
+// note is added, removed, reordered or updated.
+func notesETag(notes []models.Note) string {
+	h := sha256.New()
+	for i := range notes {
+		fmt.Fprintf(h, "%s-%d\n", notes[i].ID, notes[i].Version)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+// etagMatches reports whether header, a comma-separated If-Match or
+// If-None-Match value, matches etag. Weak comparison is used when weak is true.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header and reports whether the client's
+// If-None-Match header already matches it.
+func notModified(c *fiber.Ctx, etag string) bool {
+	c.Set(fiber.HeaderETag, etag)
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	return header != "" && etagMatches(header, etag, true)
+}
+
+// preconditionFailed reports whether the request carries an If-Match header
+// that does not match the current version of note.
+func preconditionFailed(c *fiber.Ctx, note *models.Note) bool {
+	header := c.Get(fiber.HeaderIfMatch)
+	return header != "" && !etagMatches(header, noteETag(note), false)
+}
+
+// conflictResponse answers a write that lost a race with another one
+// changing the note. Requests that sent If-Match get 412, like when the note
+// had already changed; others get 409 and can simply be retried.
+func conflictResponse(c *fiber.Ctx) error {
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		return preconditionFailedResponse(c)
+	}
+	return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+		Status: "error",
+		Error:  "Note was changed by another request at the same time; retry",
+	})
+}
+
+func preconditionFailedResponse(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusPreconditionFailed).JSON(models.ErrorResponse{
+		Status: "error",
+		Error:  "Note has been modified; fetch the latest version and retry",
+	})
+}
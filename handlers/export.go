@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"notes-api/database"
+	"notes-api/export"
+	"notes-api/jobs"
+	"notes-api/middleware"
+	"notes-api/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// exportStreamLimit is the largest account whose export is streamed in the
+// response; larger exports run as a job.
+const exportStreamLimit = 200
+
+// ExportNotes godoc
+// @Summary Export all notes as a Markdown ZIP archive
+// @Description Export every note as a Markdown file with YAML front matter (id, title, tags, created, updated and the note's other attributes), with images in an assets folder linked relatively. Accounts with up to 200 notes get the archive in the response. Larger accounts, or any account when async=true, get 202 with a job to poll at GET /api/jobs/{id}; its download_url points to the archive once the job has succeeded.
+// @Tags Notes
+// @Produce application/zip,json
+// @Security BearerAuth
+// @Param async query boolean false "Always export in the background"
+// @Success 200 {file} file "ZIP archive of the notes"
+// @Success 202 {object} models.JobSuccessResponse "Export job queued"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/export [post]
+func ExportNotes(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(middleware.GetUserID(c))
+
+	var count int64
+	if err := database.DB.Model(&models.Note{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to count notes",
+		})
+	}
+
+	if async, _ := strconv.ParseBool(c.Query("async")); async || count > exportStreamLimit {
+		job, err := jobs.Enqueue(database.DB, userID, models.JobNotesExport, nil)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Failed to queue export",
+			})
+		}
+		c.Location("/api/jobs/" + job.ID.String())
+		return c.Status(fiber.StatusAccepted).JSON(models.JobSuccessResponse{
+			Status:  "success",
+			Message: "Export queued",
+			Data: models.JobData{
+				Job: *job,
+			},
+		})
+	}
+
+	c.Attachment(export.ArchiveName(time.Now()))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if _, err := export.MarkdownArchive(w, database.DB, userID); err != nil {
+			// The status has been sent; the client sees a truncated archive
+			log.Printf("Failed to export notes of %s: %v", userID, err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// ExportNote godoc
+// @Summary Export a note as a document
+// @Description Download a single note as a self-contained document to print or share: its title, last update, tags, content, checklist items and image. pdf and html lay out the content from its format and embed the image; md is Markdown with YAML front matter and the image embedded as a data URI; txt is the plain text of the note without the image. Documents are generated by the server itself.
+// @Tags Notes
+// @Produce application/pdf,text/html,text/markdown,text/plain,json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param format query string false "Document format (default pdf)" Enums(pdf, html, md, txt)
+// @Success 200 {file} file "The note as a document"
+// @Failure 400 {object} models.ErrorResponse "Unsupported format"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/export [get]
+func ExportNote(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	noteID := c.Params("id")
+
+	format := c.Query("format", export.FormatPDF)
+	if !export.ValidFormat(format) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "format must be pdf, html, md or txt",
+		})
+	}
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", noteID, userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+	if err := loadItems(database.DB, &note); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch note",
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := export.WriteDocument(&buf, format, &note); err != nil {
+		log.Printf("Failed to export note %s as %s: %v", note.ID, format, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to export note",
+		})
+	}
+
+	c.Attachment(export.FileName(note.Title) + "." + format)
+	c.Set(fiber.HeaderContentType, export.ContentType(format))
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/importer"
+	"notes-api/jobs"
+	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/render"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxImportSize is the largest file that can be uploaded to import.
+const MaxImportSize = 100 << 20
+
+// importParams are the parameters of a models.JobNotesImport job.
+type importParams struct {
+	Source string `json:"source"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// imageExts maps the detected type of imported images to a file extension.
+var imageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ImportNotes godoc
+// @Summary Import notes from another application
+// @Description Upload a ZIP of Markdown files (optionally with YAML front matter, as written by the export), an Evernote .enex export, or a Google Keep Takeout archive. The import runs as a job: poll GET /api/jobs/{id} until it has finished; its result is a report with the outcome of every note. Titles, content, tags, timestamps, checklists and one image per note are imported. With dry_run=true nothing is created and the report shows what would be imported.
+// @Tags Notes
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "Export to import"
+// @Param source formData string false "Kind of export; detected when omitted" Enums(markdown, enex, keep)
+// @Param dry_run formData boolean false "Only check what would be imported"
+// @Success 202 {object} models.JobSuccessResponse "Import job queued"
+// @Failure 400 {object} models.ErrorResponse "Bad request"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/import [post]
+func ImportNotes(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(middleware.GetUserID(c))
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "file is required",
+		})
+	}
+	params := importParams{Source: c.FormValue("source")}
+	if params.Source != "" && !importer.ValidSource(params.Source) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "source must be markdown, enex or keep",
+		})
+	}
+	if raw := c.FormValue("dry_run"); raw != "" {
+		if params.DryRun, err = strconv.ParseBool(raw); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "dry_run must be true or false",
+			})
+		}
+	}
+
+	if err := jobs.MakeDir(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to store upload",
+		})
+	}
+	upload := filepath.Join(jobs.Dir, "upload-"+uuid.New().String())
+	if err := c.SaveFile(file, upload); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to store upload",
+		})
+	}
+	defer os.Remove(upload)
+
+	if params.Source == "" {
+		if params.Source, err = importer.Detect(upload); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  err.Error(),
+			})
+		}
+	}
+
+	// The job only becomes visible to workers once its file is in place
+	var job *models.Job
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if job, err = jobs.Enqueue(tx, userID, models.JobNotesImport, params); err != nil {
+			return err
+		}
+		return os.Rename(upload, jobs.InputPath(job))
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to queue import",
+		})
+	}
+
+	c.Location("/api/jobs/" + job.ID.String())
+	return c.Status(fiber.StatusAccepted).JSON(models.JobSuccessResponse{
+		Status:  "success",
+		Message: "Import queued",
+		Data: models.JobData{
+			Job: *job,
+		},
+	})
+}
+
+// RunNotesImport runs a models.JobNotesImport job. Notes are created one by
+// one, so a note that fails does not stop the others from being imported.
+// Each created note is recorded as a models.ImportedNote, so when the job is
+// run again after its worker died, notes created the first time are reported
+// rather than created again.
+func RunNotesImport(job *models.Job) error {
+	var params importParams
+	if err := jobs.Params(job, &params); err != nil {
+		return err
+	}
+	parsed, err := importer.Parse(params.Source, jobs.InputPath(job))
+	if err != nil {
+		return err
+	}
+
+	var previous []models.ImportedNote
+	if err := database.DB.Where("job_id = ?", job.ID).Find(&previous).Error; err != nil {
+		return err
+	}
+	imported := make(map[string]uuid.UUID, len(previous))
+	for _, p := range previous {
+		imported[p.Source] = p.NoteID
+	}
+
+	report := models.ImportReport{
+		Source: params.Source,
+		DryRun: params.DryRun,
+		Total:  len(parsed),
+		Items:  make([]models.ImportItemResult, 0, len(parsed)),
+	}
+	for i := range parsed {
+		var result models.ImportItemResult
+		if noteID, ok := imported[parsed[i].Source]; ok {
+			result = models.ImportItemResult{
+				Source:   parsed[i].Source,
+				Title:    parsed[i].Title,
+				Status:   "imported",
+				NoteID:   &noteID,
+				Warnings: parsed[i].Warnings,
+			}
+		} else {
+			result = importNote(job.ID, job.UserID, &parsed[i], params.DryRun)
+		}
+		if result.Status == "failed" {
+			report.Failed++
+		} else {
+			report.Imported++
+		}
+		report.Items = append(report.Items, result)
+	}
+	if err := database.DB.Where("job_id = ?", job.ID).Delete(&models.ImportedNote{}).Error; err != nil {
+		log.Printf("Failed to clean up import job %s: %v", job.ID, err)
+	}
+	return jobs.SetResult(job, report)
+}
+
+// importNote validates an imported note and, unless dryRun is set, creates it
+// for import job jobID.
+func importNote(jobID, userID uuid.UUID, in *importer.Note, dryRun bool) models.ImportItemResult {
+	result := models.ImportItemResult{
+		Source:   in.Source,
+		Title:    in.Title,
+		Warnings: in.Warnings,
+	}
+	fail := func(err error) models.ImportItemResult {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	if in.Err != nil {
+		return fail(in.Err)
+	}
+	warn := func(format string, args ...interface{}) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	note := models.Note{
+		Title:    strings.TrimSpace(in.Title),
+		Content:  in.Content,
+		Format:   in.Format,
+		Type:     in.Type,
+		Pinned:   in.Pinned,
+		Starred:  in.Starred,
+		Archived: in.Archived,
+		UserID:   userID,
+	}
+	if note.Title == "" {
+		note.Title = "Untitled"
+	}
+	if runes := []rune(note.Title); len(runes) > models.MaxTitleLength {
+		warn("Title is longer than %d characters and was shortened", models.MaxTitleLength)
+		note.Title = strings.TrimSpace(string(runes[:models.MaxTitleLength]))
+	}
+	if utf8.RuneCountInString(note.Content) > models.MaxContentLength {
+		return fail(fmt.Errorf("Content is longer than %d characters", models.MaxContentLength))
+	}
+	if !render.ValidFormat(note.Format) {
+		warn("Unknown format %q; imported as markdown", note.Format)
+		note.Format = render.FormatMarkdown
+	}
+	if note.Type != "" && !models.ValidNoteType(note.Type) {
+		warn("Unknown type %q; imported as a note", note.Type)
+		note.Type = models.NoteTypeNote
+	}
+	if in.Color != "" {
+		if models.ValidColor(in.Color) {
+			note.Color = in.Color
+		} else {
+			warn("Unknown color %q was left out", in.Color)
+		}
+	}
+
+	var tags []string
+	for _, tag := range in.Tags {
+		if utf8.RuneCountInString(strings.TrimSpace(tag)) > models.MaxTagLength {
+			warn("Tag %q is longer than %d characters and was left out", tag, models.MaxTagLength)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	note.Tags, _ = models.NormalizeTags(tags)
+
+	now := time.Now()
+	note.CreatedAt, note.UpdatedAt = in.Created, in.Updated
+	if note.CreatedAt.IsZero() || note.CreatedAt.After(now) {
+		note.CreatedAt = now
+	}
+	if note.UpdatedAt.IsZero() || note.UpdatedAt.Before(note.CreatedAt) || note.UpdatedAt.After(now) {
+		note.UpdatedAt = note.CreatedAt
+	}
+
+	if note.Type == models.NoteTypeChecklist {
+		for _, item := range in.Items {
+			if strings.TrimSpace(item.Text) == "" {
+				continue
+			}
+			note.Items = append(note.Items, models.ChecklistItem{
+				Text:     item.Text,
+				Checked:  item.Checked,
+				Position: len(note.Items),
+			})
+		}
+		content, items := splitTaskLines(note.Content, len(note.Items))
+		note.Content = content
+		note.Items = append(note.Items, items...)
+	}
+
+	image := in.Image
+	imageExt := ""
+	if image != nil {
+		imageExt = imageExts[http.DetectContentType(image.Data)]
+		if imageExt == "" {
+			warn("Image %s is not a JPEG, PNG or GIF image and was left out", image.Name)
+			image = nil
+		}
+	}
+
+	if dryRun {
+		result.Status = "ready"
+		return result
+	}
+
+	if image != nil {
+		path, err := newImagePath(imageExt)
+		if err != nil {
+			return fail(err)
+		}
+		if err := os.WriteFile(path, image.Data, 0644); err != nil {
+			return fail(errors.New("Failed to save image"))
+		}
+		note.ImagePath = path
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := createNote(tx, &note); err != nil {
+			return err
+		}
+		return tx.Create(&models.ImportedNote{JobID: jobID, Source: in.Source, NoteID: note.ID}).Error
+	})
+	if err != nil {
+		if note.ImagePath != "" {
+			os.Remove(note.ImagePath)
+		}
+		return fail(errors.New("Failed to create note"))
+	}
+	publishNoteEvent(events.NoteCreated, &note)
+
+	result.Status = "imported"
+	result.NoteID = &note.ID
+	return result
+}
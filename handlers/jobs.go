@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"notes-api/database"
+	"notes-api/jobs"
+	"notes-api/middleware"
+	"notes-api/models"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxJobsListed = 50
+
+// ListJobs godoc
+// @Summary List background jobs
+// @Description Retrieve the authenticated user's recent jobs, newest first. Finished jobs are kept for 7 days.
+// @Tags Jobs
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.JobsSuccessResponse "List of jobs"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/jobs [get]
+func ListJobs(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var list []models.Job
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").
+		Limit(maxJobsListed).Find(&list).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch jobs",
+		})
+	}
+	for i := range list {
+		setDownloadURL(c, &list[i])
+	}
+
+	return c.JSON(models.JobsSuccessResponse{
+		Status:  "success",
+		Message: "Jobs retrieved successfully",
+		Data: models.JobsData{
+			Jobs:  list,
+			Count: len(list),
+		},
+	})
+}
+
+// GetJob godoc
+// @Summary Get a background job
+// @Description Retrieve a job's status. Poll until it is succeeded or failed; a succeeded job that produced a file has a download_url.
+// @Tags Jobs
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.JobSuccessResponse "Job retrieved successfully"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Job not found"
+// @Router /api/jobs/{id} [get]
+func GetJob(c *fiber.Ctx) error {
+	job, err := findJob(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	setDownloadURL(c, job)
+
+	return c.JSON(models.JobSuccessResponse{
+		Status:  "success",
+		Message: "Job retrieved successfully",
+		Data: models.JobData{
+			Job: *job,
+		},
+	})
+}
+
+// DownloadJob godoc
+// @Summary Download the file a job produced
+// @Description Download the file of a succeeded job, such as an export archive. Browsers following the link may pass the token as access_token.
+// @Tags Jobs
+// @Produce application/zip
+// @Security BearerAuth
+// @Param id path string true "Job ID"
+// @Param access_token query string false "JWT, for clients that cannot set headers"
+// @Success 200 {file} file "The job's file"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Job or file not found"
+// @Failure 409 {object} models.ErrorResponse "Job has not finished"
+// @Router /api/jobs/{id}/download [get]
+func DownloadJob(c *fiber.Ctx) error {
+	job, err := findJob(c)
+	if err != nil {
+		return errorResponse(c, err)
+	}
+	if !job.Done() {
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Job has not finished yet",
+		})
+	}
+	if job.FileName == "" {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Job has no file",
+		})
+	}
+
+	if err := c.Download(jobs.Path(job), job.FileName); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "File is no longer available",
+		})
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(job.FileName)); contentType != "" {
+		c.Set(fiber.HeaderContentType, contentType)
+	}
+	return nil
+}
+
+// findJob loads the job in :id if it belongs to the authenticated user.
+func findJob(c *fiber.Ctx) (*models.Job, error) {
+	var job models.Job
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), middleware.GetUserID(c)).
+		First(&job).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Job not found")
+	}
+	return &job, nil
+}
+
+// setDownloadURL fills in the download link of a job's file.
+func setDownloadURL(c *fiber.Ctx, job *models.Job) {
+	if job.Status == models.JobSucceeded && job.FileName != "" {
+		job.DownloadURL = fmt.Sprintf("https://%s/api/jobs/%s/download", c.Get("Host"), job.ID)
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"notes-api/tokens"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWKS godoc
+// @Summary Token signing keys
+// @Description The public keys tokens are signed with, as a JSON Web Key Set (RFC 7517), for services that verify tokens themselves. Each token names its key in the kid header. Keys are rotated regularly and a new key is listed a day before it is used, so caching this for up to an hour is safe.
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} models.JSONWebKeySet "Key set"
+// @Router /.well-known/jwks.json [get]
+func JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.JSON(tokens.KeySet())
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"notes-api/database"
+	"notes-api/links"
+	"notes-api/middleware"
+	"notes-api/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// GetNoteLinks godoc
+// @Summary List a note's outgoing links
+// @Description List the [[Note Title]] and [[note-id]] references in a note's content, in order, with the notes they resolve to. References to titles no note has yet are included without a note.
+// @Tags Links
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Success 200 {object} models.LinksSuccessResponse "Outgoing links"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/links [get]
+func GetNoteLinks(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+
+	var rows []models.NoteLink
+	if err := database.DB.Where("source_id = ?", note.ID).Find(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch links",
+		})
+	}
+
+	var targetIDs []uuid.UUID
+	for _, row := range rows {
+		if row.TargetID != nil {
+			targetIDs = append(targetIDs, *row.TargetID)
+		}
+	}
+	targets := map[uuid.UUID]*models.LinkedNote{}
+	if len(targetIDs) > 0 {
+		var linked []models.LinkedNote
+		if err := database.DB.Model(&models.Note{}).Where("id IN ?", targetIDs).Find(&linked).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Failed to fetch links",
+			})
+		}
+		for i := range linked {
+			targets[linked[i].ID] = &linked[i]
+		}
+	}
+
+	// Rows have no order of their own; report links as they appear in the note
+	byTarget := make(map[string]models.NoteLink, len(rows))
+	for _, row := range rows {
+		byTarget[row.Target] = row
+	}
+	result := []models.OutgoingLink{}
+	for _, target := range links.Parse(note.Content) {
+		row, ok := byTarget[target]
+		if !ok {
+			continue
+		}
+		link := models.OutgoingLink{Target: target}
+		if row.TargetID != nil {
+			link.Note = targets[*row.TargetID]
+		}
+		result = append(result, link)
+	}
+
+	return c.JSON(models.LinksSuccessResponse{
+		Status:  "success",
+		Message: "Links retrieved successfully",
+		Data: models.LinksData{
+			Links: result,
+			Count: len(result),
+		},
+	})
+}
+
+// GetNoteBacklinks godoc
+// @Summary List a note's backlinks
+// @Description List the notes whose content links to this note, by title or by ID, most recently updated first
+// @Tags Links
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Success 200 {object} models.BacklinksSuccessResponse "Notes linking here"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/backlinks [get]
+func GetNoteBacklinks(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+
+	backlinks := []models.LinkedNote{}
+	linking := database.DB.Model(&models.NoteLink{}).Select("source_id").Where("target_id = ?", note.ID)
+	if err := database.DB.Model(&models.Note{}).
+		Where("user_id = ? AND id <> ? AND id IN (?)", userID, note.ID, linking).
+		Order("updated_at DESC").Find(&backlinks).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch backlinks",
+		})
+	}
+
+	return c.JSON(models.BacklinksSuccessResponse{
+		Status:  "success",
+		Message: "Backlinks retrieved successfully",
+		Data: models.BacklinksData{
+			Backlinks: backlinks,
+			Count:     len(backlinks),
+		},
+	})
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"fmt"
+	"notes-api/models"
+	"notes-api/render"
+	"sort"
+	"strings"
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+// noteDocument returns the patchable representation of a note. Its members
+// mirror the JSON field names returned by the API.
+func noteDocument(note *models.Note) map[string]interface{} {
+	doc := map[string]interface{}{
+		"title":    note.Title,
+		"content":  note.Content,
+		"format":   note.Format,
+		"type":     note.Type,
+		"pinned":   note.Pinned,
+		"starred":  note.Starred,
+		"archived": note.Archived,
+		"position": float64(note.Position),
+	}
+	if note.Color != "" {
+		doc["color"] = note.Color
+	}
+	if len(note.Properties) > 0 {
+		properties := make(map[string]interface{}, len(note.Properties))
+		for key, value := range note.Properties {
+			properties[key] = value
+		}
+		doc["properties"] = properties
+	}
+	if len(note.Tags) > 0 {
+		tags := make([]interface{}, len(note.Tags))
+		for i, tag := range note.Tags {
+			tags[i] = tag
+		}
+		doc["tags"] = tags
+	}
+	if note.ImageURL != "" {
+		doc["image_url"] = note.ImageURL
+	}
+	return doc
+}
+
+// applyNoteDocument validates a patched document and copies it onto note.
+// Members missing from the document are cleared.
+func applyNoteDocument(note *models.Note, doc map[string]interface{}) error {
+	var unknown []string
+	for key := range doc {
+		switch key {
+		case "title", "content", "format", "type", "pinned", "starred", "archived", "position", "color", "properties", "tags", "image_url":
+		default:
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("Unknown or read-only fields: %s", strings.Join(unknown, ", "))
+	}
+
+	title, ok := doc["title"].(string)
+	if !ok || title == "" {
+		return fmt.Errorf("Title is required and must be a string")
+	}
+	note.Title = title
+
+	switch content := doc["content"].(type) {
+	case nil:
+		note.Content = ""
+	case string:
+		note.Content = content
+	default:
+		return fmt.Errorf("Content must be a string")
+	}
+
+	switch format := doc["format"].(type) {
+	case nil:
+		note.Format = render.FormatPlain
+	case string:
+		if !render.ValidFormat(format) {
+			return fmt.Errorf("Format must be plain or markdown")
+		}
+		note.Format = format
+	default:
+		return fmt.Errorf("Format must be a string")
+	}
+
+	switch noteType := doc["type"].(type) {
+	case nil:
+		note.Type = models.NoteTypeNote
+	case string:
+		if !models.ValidNoteType(noteType) {
+			return fmt.Errorf("Type must be note or checklist")
+		}
+		note.Type = noteType
+	default:
+		return fmt.Errorf("Type must be a string")
+	}
+
+	for key, field := range map[string]*bool{
+		"pinned":   &note.Pinned,
+		"starred":  &note.Starred,
+		"archived": &note.Archived,
+	} {
+		switch value := doc[key].(type) {
+		case nil:
+			*field = false
+		case bool:
+			*field = value
+		default:
+			return fmt.Errorf("%s must be a boolean", strings.ToUpper(key[:1])+key[1:])
+		}
+	}
+
+	switch position := doc["position"].(type) {
+	case nil:
+		note.Position = 0
+	case float64:
+		if position != float64(int(position)) {
+			return fmt.Errorf("Position must be an integer")
+		}
+		note.Position = int(position)
+	default:
+		return fmt.Errorf("Position must be a number")
+	}
+
+	switch color := doc["color"].(type) {
+	case nil:
+		note.Color = ""
+	case string:
+		if !models.ValidColor(color) {
+			return fmt.Errorf("Color must be one of %s", strings.Join(models.Colors, ", "))
+		}
+		note.Color = color
+	default:
+		return fmt.Errorf("Color must be a string")
+	}
+
+	// Values are checked against the property definitions by the caller
+	switch properties := doc["properties"].(type) {
+	case nil:
+		note.Properties = map[string]interface{}{}
+	case map[string]interface{}:
+		note.Properties = properties
+	default:
+		return fmt.Errorf("Properties must be an object")
+	}
+
+	switch values := doc["tags"].(type) {
+	case nil:
+		note.Tags = []string{}
+	case []interface{}:
+		tags := make([]string, len(values))
+		for i, value := range values {
+			tag, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("Tags must be strings")
+			}
+			tags[i] = tag
+		}
+		normalized, err := models.NormalizeTags(tags)
+		if err != nil {
+			return err
+		}
+		note.Tags = normalized
+	default:
+		return fmt.Errorf("Tags must be an array")
+	}
+
+	imageURL, present := doc["image_url"]
+	switch {
+	case !present:
+		note.ImagePath = ""
+	case imageURL != note.ImageURL:
+		return fmt.Errorf("image_url can only be removed; upload a new image with PUT")
+	}
+	return nil
+}
@@ -1,34 +1,82 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
+	"mime/multipart"
 	"notes-api/database"
+	"notes-api/events"
 	"notes-api/middleware"
 	"notes-api/models"
+	"notes-api/patch"
+	"notes-api/render"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // GetNotes godoc
 // @Summary Get all notes for authenticated user
-// @Description Retrieve all notes belonging to the authenticated user with image URLs
+// @Description Retrieve all notes belonging to the authenticated user with image URLs, pinned notes first, then in manual order, then most recently updated first. Archived notes are left out unless requested. The response carries an ETag; send it back in If-None-Match to get 304 when nothing changed.
 // @Tags Notes
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Param archived query string false "Whether to list archived notes (default exclude)" Enums(exclude, include, only)
+// @Param pinned query bool false "Only pinned (true) or unpinned (false) notes"
+// @Param starred query bool false "Only starred (true) or unstarred (false) notes"
+// @Param type query string false "Only notes of this type" Enums(note, checklist)
+// @Param color query string false "Only notes with this color label"
+// @Param tag query string false "Only notes with this tag"
+// @Param prop.key query string false "Only notes whose property <key> equals the value. prop.<key>.<op> compares with ne, or for number and date properties gt, gte, lt or lte."
+// @Param sort query string false "title, created_at, updated_at or prop.<key>, prefixed with - for descending order. Replaces the default order."
+// @Param If-None-Match header string false "ETag of a previously fetched list"
 // @Success 200 {object} models.NotesSuccessResponse "List of notes"
+// @Success 304 "List unchanged"
+// @Failure 400 {object} models.ErrorResponse "Invalid filter"
 // @Failure 401 {object} models.ErrorResponse "Unauthorized"
 // @Failure 500 {object} models.ErrorResponse "Internal server error"
 // @Router /api/notes [get]
 func GetNotes(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 
+	filter, err := noteFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+
+	order, err := noteSort(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+
 	var notes []models.Note
-	if err := database.DB.Where("user_id = ?", userID).Find(&notes).Error; err != nil {
+	query := applyNoteFilter(database.DB.Where("user_id = ?", userID), filter)
+	if err := query.Scopes(order).Find(&notes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch notes",
+		})
+	}
+
+	if notModified(c, notesETag(notes)) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if err := attachChecklistSummaries(database.DB, notes); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
 			Status: "error",
 			Error:  "Failed to fetch notes",
@@ -36,10 +84,7 @@ func GetNotes(c *fiber.Ctx) error {
 	}
 
 	for i := range notes {
-		if notes[i].ImagePath != "" {
-			notes[i].ImageURL = fmt.Sprintf("https://%s/uploads/%s", 
-				c.Get("Host"), filepath.Base(notes[i].ImagePath))
-		}
+		setImageURL(c, &notes[i])
 	}
 
 	return c.JSON(models.NotesSuccessResponse{
@@ -54,13 +99,17 @@ func GetNotes(c *fiber.Ctx) error {
 
 // GetNote godoc
 // @Summary Get a specific note
-// @Description Retrieve a specific note by ID for the authenticated user
+// @Description Retrieve a specific note by ID for the authenticated user. The response carries an ETag; send it back in If-None-Match to get 304 when the note is unchanged.
 // @Tags Notes
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Note ID"
+// @Param render query string false "Set to html to include content_html: the content rendered from its format (plain or CommonMark with GFM tables, task lists and code fences) as sanitized HTML" Enums(html)
+// @Param If-None-Match header string false "ETag of a previously fetched version"
 // @Success 200 {object} models.NoteSuccessResponse "Note details"
+// @Success 304 "Note unchanged"
+// @Failure 400 {object} models.ErrorResponse "Unsupported render option"
 // @Failure 401 {object} models.ErrorResponse "Unauthorized"
 // @Failure 404 {object} models.ErrorResponse "Note not found"
 // @Failure 500 {object} models.ErrorResponse "Internal server error"
@@ -77,11 +126,42 @@ func GetNote(c *fiber.Ctx) error {
 		})
 	}
 
-	if note.ImagePath != "" {
-		note.ImageURL = fmt.Sprintf("https://%s/uploads/%s", 
-			c.Get("Host"), filepath.Base(note.ImagePath))
+	renderMode := c.Query("render")
+	if renderMode != "" && renderMode != "html" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Unsupported render option; use render=html",
+		})
+	}
+
+	etag := noteETag(&note)
+	if renderMode == "html" {
+		etag = strings.TrimSuffix(etag, `"`) + `-html"`
+	}
+	if notModified(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
+	if err := loadItems(database.DB, &note); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch note",
+		})
+	}
+
+	if renderMode == "html" {
+		contentHTML, err := render.HTML(note.Format, note.Content)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Failed to render note",
+			})
+		}
+		note.ContentHTML = contentHTML
+	}
+
+	setImageURL(c, &note)
+
 	return c.JSON(models.NoteSuccessResponse{
 		Status:  "success",
 		Message: "Note retrieved successfully",
@@ -93,13 +173,18 @@ func GetNote(c *fiber.Ctx) error {
 
 // CreateNote godoc
 // @Summary Create a new note
-// @Description Create a new note with optional image upload using multipart form data
+// @Description Create a new note with optional image upload using multipart form data, or from a JSON body when no image is attached
 // @Tags Notes
-// @Accept multipart/form-data
+// @Accept multipart/form-data,json
 // @Produce json
 // @Security BearerAuth
 // @Param title formData string true "Note title"
 // @Param content formData string false "Note content"
+// @Param format formData string false "Content format (default plain)" Enums(plain, markdown)
+// @Param type formData string false "Note type (default note). For checklists, \"- [ ]\" and \"- [x]\" lines in content become items." Enums(note, checklist)
+// @Param color formData string false "Color label" Enums(red, orange, yellow, green, teal, blue, purple, pink, brown, gray)
+// @Param properties formData string false "Custom properties as a JSON object, e.g. {\"priority\": \"high\"}"
+// @Param tags formData string false "Comma-separated tags"
 // @Param image formData file false "Image file (JPEG, PNG, GIF)"
 // @Success 201 {object} models.NoteSuccessResponse "Note created successfully"
 // @Failure 400 {object} models.ErrorResponse "Bad request"
@@ -109,81 +194,153 @@ func GetNote(c *fiber.Ctx) error {
 func CreateNote(c *fiber.Ctx) error {
 	userID := middleware.GetUserID(c)
 
-	form, err := c.MultipartForm()
-	if err != nil {
+	var req models.CreateNoteRequest
+	var image *multipart.FileHeader
+
+	if mediaType(c) == fiber.MIMEApplicationJSON {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Invalid request body",
+			})
+		}
+	} else {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Invalid multipart form",
+			})
+		}
+
+		if titleValues := form.Value["title"]; len(titleValues) > 0 {
+			req.Title = titleValues[0]
+		}
+		if contentValues := form.Value["content"]; len(contentValues) > 0 {
+			req.Content = contentValues[0]
+		}
+		if formatValues := form.Value["format"]; len(formatValues) > 0 {
+			req.Format = formatValues[0]
+		}
+		if typeValues := form.Value["type"]; len(typeValues) > 0 {
+			req.Type = typeValues[0]
+		}
+		if colorValues := form.Value["color"]; len(colorValues) > 0 {
+			req.Color = colorValues[0]
+		}
+		if propertyValues := form.Value["properties"]; len(propertyValues) > 0 && propertyValues[0] != "" {
+			if err := json.Unmarshal([]byte(propertyValues[0]), &req.Properties); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+					Status: "error",
+					Error:  "Properties must be a JSON object",
+				})
+			}
+		}
+		if tagValues := form.Value["tags"]; len(tagValues) > 0 {
+			req.Tags = strings.Split(tagValues[0], ",")
+		}
+		if files := form.File["image"]; len(files) > 0 {
+			image = files[0]
+		}
+	}
+
+	if req.Title == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
 			Status: "error",
-			Error:  "Invalid multipart form",
+			Error:  "Title is required",
 		})
 	}
-
-	title := ""
-	content := ""
-	
-	if titleValues := form.Value["title"]; len(titleValues) > 0 {
-		title = titleValues[0]
+	if req.Format != "" && !render.ValidFormat(req.Format) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Format must be plain or markdown",
+		})
 	}
-	if contentValues := form.Value["content"]; len(contentValues) > 0 {
-		content = contentValues[0]
+	if req.Type != "" && !models.ValidNoteType(req.Type) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Type must be note or checklist",
+		})
 	}
-
-	if title == "" {
+	if len(req.Items) > 0 && req.Type != models.NoteTypeChecklist {
 		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
 			Status: "error",
-			Error:  "Title is required",
+			Error:  "Items are only allowed on checklist notes",
+		})
+	}
+	if req.Color != "" && !models.ValidColor(req.Color) {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Color must be one of " + strings.Join(models.Colors, ", "),
+		})
+	}
+	if err := validateProperties(database.DB, userID, req.Properties); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+	tags, err := models.NormalizeTags(req.Tags)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
 		})
 	}
 
 	userUUID, _ := uuid.Parse(userID)
 	note := models.Note{
-		Title:   title,
-		Content: content,
-		UserID:  userUUID,
+		Title:      req.Title,
+		Content:    req.Content,
+		Format:     req.Format,
+		Type:       req.Type,
+		Pinned:     req.Pinned,
+		Starred:    req.Starred,
+		Color:      req.Color,
+		Properties: req.Properties,
+		Tags:       tags,
+		UserID:     userUUID,
 	}
 
-	if files := form.File["image"]; len(files) > 0 {
-		file := files[0]
-		
-		if !isValidImageType(file.Header.Get("Content-Type")) {
-			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
-				Status: "error",
-				Error:  "Invalid image type. Only JPEG, PNG, and GIF are allowed",
-			})
-		}
-
-		ext := filepath.Ext(file.Filename)
-		filename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-		
-		uploadsDir := "uploads"
-		if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
-				Status: "error",
-				Error:  "Failed to create uploads directory",
+	if note.Type == models.NoteTypeChecklist {
+		for i, item := range req.Items {
+			if strings.TrimSpace(item.Text) == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+					Status: "error",
+					Error:  "Item text is required",
+				})
+			}
+			note.Items = append(note.Items, models.ChecklistItem{
+				Text:     item.Text,
+				Checked:  item.Checked,
+				Position: i,
+				DueAt:    item.DueAt,
 			})
 		}
+		content, items := splitTaskLines(note.Content, len(note.Items))
+		note.Content = content
+		note.Items = append(note.Items, items...)
+	}
 
-		savePath := filepath.Join(uploadsDir, filename)
-		if err := c.SaveFile(file, savePath); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
-				Status: "error",
-				Error:  "Failed to save image",
-			})
+	if image != nil {
+		savePath, err := saveImage(c, image)
+		if err != nil {
+			return imageError(c, err)
 		}
-
 		note.ImagePath = savePath
 	}
 
-	if err := database.DB.Create(&note).Error; err != nil {
+	if err := createNote(database.DB, &note); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
 			Status: "error",
 			Error:  "Failed to create note",
 		})
 	}
 
-	if note.ImagePath != "" {
-		note.ImageURL = fmt.Sprintf("https://%s/uploads/%s", 
-			c.Get("Host"), filepath.Base(note.ImagePath))
-	}
+	publishNoteEvent(events.NoteCreated, &note)
+
+	setImageURL(c, &note)
+	c.Set(fiber.HeaderETag, noteETag(&note))
 
 	return c.Status(fiber.StatusCreated).JSON(models.NoteSuccessResponse{
 		Status:  "success",
@@ -196,7 +353,7 @@ func CreateNote(c *fiber.Ctx) error {
 
 // UpdateNote godoc
 // @Summary Update an existing note
-// @Description Update a note's title, content, and/or image using multipart form data
+// @Description Update a note's title, content, and/or image using multipart form data. Set remove_image to true to delete the current image.
 // @Tags Notes
 // @Accept multipart/form-data
 // @Produce json
@@ -204,11 +361,19 @@ func CreateNote(c *fiber.Ctx) error {
 // @Param id path string true "Note ID"
 // @Param title formData string false "Note title"
 // @Param content formData string false "Note content"
+// @Param format formData string false "Content format" Enums(plain, markdown)
+// @Param color formData string false "Color label; empty removes it" Enums(red, orange, yellow, green, teal, blue, purple, pink, brown, gray)
+// @Param properties formData string false "Custom properties as a JSON object, replacing the current ones"
+// @Param tags formData string false "Comma-separated tags, replacing the current ones"
 // @Param image formData file false "Image file (JPEG, PNG, GIF)"
+// @Param remove_image formData boolean false "Remove the current image"
+// @Param If-Match header string false "Only update if the note still has this ETag"
 // @Success 200 {object} models.NoteSuccessResponse "Note updated successfully"
 // @Failure 400 {object} models.ErrorResponse "Bad request"
 // @Failure 401 {object} models.ErrorResponse "Unauthorized"
 // @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
 // @Failure 500 {object} models.ErrorResponse "Internal server error"
 // @Router /api/notes/{id} [put]
 func UpdateNote(c *fiber.Ctx) error {
@@ -223,6 +388,10 @@ func UpdateNote(c *fiber.Ctx) error {
 		})
 	}
 
+	if preconditionFailed(c, &note) {
+		return preconditionFailedResponse(c)
+	}
+
 	form, err := c.MultipartForm()
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
@@ -231,61 +400,235 @@ func UpdateNote(c *fiber.Ctx) error {
 		})
 	}
 
+	oldTitle := note.Title
 	if titleValues := form.Value["title"]; len(titleValues) > 0 && titleValues[0] != "" {
 		note.Title = titleValues[0]
 	}
 	if contentValues := form.Value["content"]; len(contentValues) > 0 {
 		note.Content = contentValues[0]
 	}
-
-	if files := form.File["image"]; len(files) > 0 {
-		file := files[0]
-		
-		if !isValidImageType(file.Header.Get("Content-Type")) {
+	if formatValues := form.Value["format"]; len(formatValues) > 0 {
+		if !render.ValidFormat(formatValues[0]) {
 			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
 				Status: "error",
-				Error:  "Invalid image type. Only JPEG, PNG, and GIF are allowed",
+				Error:  "Format must be plain or markdown",
 			})
 		}
-
-		if note.ImagePath != "" {
-			os.Remove(note.ImagePath)
+		note.Format = formatValues[0]
+	}
+	if colorValues := form.Value["color"]; len(colorValues) > 0 {
+		if colorValues[0] != "" && !models.ValidColor(colorValues[0]) {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Color must be one of " + strings.Join(models.Colors, ", "),
+			})
 		}
-
-		ext := filepath.Ext(file.Filename)
-		filename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-		
-		uploadsDir := "uploads"
-		if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+		note.Color = colorValues[0]
+	}
+	if propertyValues := form.Value["properties"]; len(propertyValues) > 0 {
+		properties := map[string]interface{}{}
+		if propertyValues[0] != "" {
+			if err := json.Unmarshal([]byte(propertyValues[0]), &properties); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+					Status: "error",
+					Error:  "Properties must be a JSON object",
+				})
+			}
+		}
+		if err := validateProperties(database.DB, userID, properties); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
 				Status: "error",
-				Error:  "Failed to create uploads directory",
+				Error:  err.Error(),
 			})
 		}
-
-		savePath := filepath.Join(uploadsDir, filename)
-		if err := c.SaveFile(file, savePath); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+		note.Properties = properties
+	}
+	if tagValues := form.Value["tags"]; len(tagValues) > 0 {
+		tags, err := models.NormalizeTags(strings.Split(tagValues[0], ","))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
 				Status: "error",
-				Error:  "Failed to save image",
+				Error:  err.Error(),
 			})
 		}
+		note.Tags = tags
+	}
+
+	oldImagePath := note.ImagePath
+	if values := form.Value["remove_image"]; len(values) > 0 {
+		if remove, _ := strconv.ParseBool(values[0]); remove {
+			note.ImagePath = ""
+		}
+	}
 
+	if files := form.File["image"]; len(files) > 0 {
+		savePath, err := saveImage(c, files[0])
+		if err != nil {
+			return imageError(c, err)
+		}
 		note.ImagePath = savePath
 	}
 
-	if err := database.DB.Save(&note).Error; err != nil {
+	var renamed []models.Note
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if renamed, err = renameLinks(tx, &note, oldTitle); err != nil {
+			return err
+		}
+		return saveNote(tx, &note)
+	})
+	if err != nil {
+		if errors.Is(err, errVersionConflict) {
+			return conflictResponse(c)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
 			Status: "error",
 			Error:  "Failed to update note",
 		})
 	}
 
-	if note.ImagePath != "" {
-		note.ImageURL = fmt.Sprintf("https://%s/uploads/%s", 
-			c.Get("Host"), filepath.Base(note.ImagePath))
+	if oldImagePath != "" && oldImagePath != note.ImagePath {
+		os.Remove(oldImagePath)
+	}
+
+	if err := loadItems(database.DB, &note); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch note",
+		})
 	}
 
+	publishNoteEvent(events.NoteUpdated, &note)
+	for i := range renamed {
+		publishNoteEvent(events.NoteUpdated, &renamed[i])
+	}
+
+	setImageURL(c, &note)
+	c.Set(fiber.HeaderETag, noteETag(&note))
+
+	return c.JSON(models.NoteSuccessResponse{
+		Status:  "success",
+		Message: "Note updated successfully",
+		Data: models.NoteData{
+			Note: note,
+		},
+	})
+}
+
+// PatchNote godoc
+// @Summary Partially update a note
+// @Description Apply a JSON Merge Patch (application/merge-patch+json or application/json) or a JSON Patch (application/json-patch+json) to a note. Patchable members are title, content, format and image_url; image_url can only be removed (null in a merge patch, a remove operation in a JSON Patch).
+// @Tags Notes
+// @Accept application/merge-patch+json,application/json-patch+json,json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param patch body models.NoteMergePatch true "Merge patch document, or an array of JSON Patch operations"
+// @Param If-Match header string false "Only update if the note still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Note updated successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid patch document"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "JSON Patch test operation failed, or the note was changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 415 {object} models.ErrorResponse "Unsupported patch format"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id} [patch]
+func PatchNote(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	noteID := c.Params("id")
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", noteID, userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+
+	if preconditionFailed(c, &note) {
+		return preconditionFailedResponse(c)
+	}
+
+	setImageURL(c, &note)
+	doc := noteDocument(&note)
+
+	var err error
+	switch mediaType(c) {
+	case mimeMergePatch, fiber.MIMEApplicationJSON:
+		doc, err = patch.Merge(doc, c.Body())
+	case mimeJSONPatch:
+		doc, err = patch.Apply(doc, c.Body())
+	default:
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Content-Type must be application/merge-patch+json or application/json-patch+json",
+		})
+	}
+	if errors.Is(err, patch.ErrTestFailed) {
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+
+	oldImagePath := note.ImagePath
+	oldType := note.Type
+	oldTitle := note.Title
+	if err := applyNoteDocument(&note, doc); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+	if err := validateProperties(database.DB, userID, note.Properties); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+
+	var renamed []models.Note
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := convertNoteType(tx, &note, oldType); err != nil {
+			return err
+		}
+		if renamed, err = renameLinks(tx, &note, oldTitle); err != nil {
+			return err
+		}
+		if err := saveNote(tx, &note); err != nil {
+			return err
+		}
+		return loadItems(tx, &note)
+	})
+	if err != nil {
+		if errors.Is(err, errVersionConflict) {
+			return conflictResponse(c)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to update note",
+		})
+	}
+
+	if oldImagePath != "" && oldImagePath != note.ImagePath {
+		os.Remove(oldImagePath)
+	}
+
+	publishNoteEvent(events.NoteUpdated, &note)
+	for i := range renamed {
+		publishNoteEvent(events.NoteUpdated, &renamed[i])
+	}
+
+	note.ImageURL = ""
+	setImageURL(c, &note)
+	c.Set(fiber.HeaderETag, noteETag(&note))
+
 	return c.JSON(models.NoteSuccessResponse{
 		Status:  "success",
 		Message: "Note updated successfully",
@@ -303,9 +646,12 @@ func UpdateNote(c *fiber.Ctx) error {
 // @Produce json
 // @Security BearerAuth
 // @Param id path string true "Note ID"
+// @Param If-Match header string false "Only delete if the note still has this ETag"
 // @Success 200 {object} models.MessageSuccessResponse "Note deleted successfully"
 // @Failure 401 {object} models.ErrorResponse "Unauthorized"
 // @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
 // @Failure 500 {object} models.ErrorResponse "Internal server error"
 // @Router /api/notes/{id} [delete]
 func DeleteNote(c *fiber.Ctx) error {
@@ -320,17 +666,26 @@ func DeleteNote(c *fiber.Ctx) error {
 		})
 	}
 
-	if note.ImagePath != "" {
-		os.Remove(note.ImagePath)
+	if preconditionFailed(c, &note) {
+		return preconditionFailedResponse(c)
 	}
 
-	if err := database.DB.Delete(&note).Error; err != nil {
+	if err := deleteNote(database.DB, &note); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			return conflictResponse(c)
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
 			Status: "error",
 			Error:  "Failed to delete note",
 		})
 	}
 
+	if note.ImagePath != "" {
+		os.Remove(note.ImagePath)
+	}
+
+	publishNoteEvent(events.NoteDeleted, &note)
+
 	return c.JSON(models.MessageSuccessResponse{
 		Status:  "success",
 		Message: "Note deleted successfully",
@@ -355,3 +710,63 @@ func isValidImageType(contentType string) bool {
 	}
 	return false
 }
+
+var errInvalidImageType = errors.New("Invalid image type. Only JPEG, PNG, and GIF are allowed")
+
+// saveImage validates and stores an uploaded image, returning its path on disk.
+func saveImage(c *fiber.Ctx, file *multipart.FileHeader) (string, error) {
+	if !isValidImageType(file.Header.Get("Content-Type")) {
+		return "", errInvalidImageType
+	}
+
+	savePath, err := newImagePath(filepath.Ext(file.Filename))
+	if err != nil {
+		return "", err
+	}
+	if err := c.SaveFile(file, savePath); err != nil {
+		return "", errors.New("Failed to save image")
+	}
+	return savePath, nil
+}
+
+// newImagePath returns a new path in the uploads directory for an image with
+// the given extension.
+func newImagePath(ext string) (string, error) {
+	filename := fmt.Sprintf("%s%s", uuid.New().String(), ext)
+
+	uploadsDir := "uploads"
+	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
+		return "", errors.New("Failed to create uploads directory")
+	}
+	return filepath.Join(uploadsDir, filename), nil
+}
+
+func imageError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusInternalServerError
+	if err == errInvalidImageType {
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(models.ErrorResponse{
+		Status: "error",
+		Error:  err.Error(),
+	})
+}
+
+func setImageURL(c *fiber.Ctx, note *models.Note) {
+	if note.ImagePath != "" {
+		note.ImageURL = imageURL(c.Get("Host"), note.ImagePath)
+	}
+}
+
+func imageURL(host, imagePath string) string {
+	return fmt.Sprintf("https://%s/uploads/%s", host, filepath.Base(imagePath))
+}
+
+// mediaType returns the request's Content-Type without parameters.
+func mediaType(c *fiber.Ctx) string {
+	mt, _, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(mt)
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"errors"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// noteOrder is the default order of note listings: pinned notes first, then
+// the manual order, then the most recently changed.
+const noteOrder = "pinned DESC, position, updated_at DESC"
+
+// positionGap is the distance left between manually ordered notes, so a note
+// can be moved between two others without renumbering the rest.
+const positionGap = 1024
+
+// manualOrder returns the IDs of userID's notes as they are listed, and
+// their positions, locking the notes until the transaction ends.
+func manualOrder(tx *gorm.DB, userID string) ([]uuid.UUID, map[uuid.UUID]int, error) {
+	var all []models.Note
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "position").
+		Where("user_id = ?", userID).Order(noteOrder).Find(&all).Error; err != nil {
+		return nil, nil, err
+	}
+	order := make([]uuid.UUID, len(all))
+	current := make(map[uuid.UUID]int, len(all))
+	for i := range all {
+		order[i] = all[i].ID
+		current[all[i].ID] = all[i].Position
+	}
+	return order, current, nil
+}
+
+// positionNotes gives the notes at slots in order positions that list them
+// there, and returns the IDs of the notes it changed.
+func positionNotes(tx *gorm.DB, order []uuid.UUID, current map[uuid.UUID]int, slots []int) ([]uuid.UUID, error) {
+	positions, ok := placeNotes(order, current, slots)
+	if !ok {
+		// No room between the neighbours: space every note out again
+		positions = make(map[uuid.UUID]int, len(order))
+		for i, id := range order {
+			positions[id] = (i + 1) * positionGap
+		}
+	}
+
+	var changed []uuid.UUID
+	for _, id := range order {
+		position, ok := positions[id]
+		if !ok || current[id] == position {
+			continue
+		}
+		columns := models.ChangeColumns()
+		columns["position"] = position
+		columns["version"] = gorm.Expr("version + 1")
+		if err := tx.Model(&models.Note{}).Where("id = ?", id).UpdateColumns(columns).Error; err != nil {
+			return nil, err
+		}
+		changed = append(changed, id)
+	}
+	return changed, nil
+}
+
+// placeNotes picks new positions for the notes at slots (sorted indexes into
+// order) that put them strictly between their neighbours in order, leaving
+// every other note where it is. It reports false if some neighbours are too
+// close together to fit the notes between them.
+func placeNotes(order []uuid.UUID, current map[uuid.UUID]int, slots []int) (map[uuid.UUID]int, bool) {
+	positions := make(map[uuid.UUID]int, len(slots))
+	for k := 0; k < len(slots); {
+		// Place each run of adjacent slots at once
+		first, last := slots[k], slots[k]
+		for k++; k < len(slots) && slots[k] == last+1; k++ {
+			last++
+		}
+		count := last - first + 1
+
+		// The neighbours of a run are never slots themselves
+		var lo, hi int
+		hasLo, hasHi := first > 0, last < len(order)-1
+		if hasLo {
+			lo = current[order[first-1]]
+		}
+		if hasHi {
+			hi = current[order[last+1]]
+		}
+		switch {
+		case !hasLo && !hasHi:
+			lo, hi = 0, (count+1)*positionGap
+		case !hasLo:
+			lo = hi - (count+1)*positionGap
+		case !hasHi:
+			hi = lo + (count+1)*positionGap
+		}
+		if hi-lo <= count {
+			return nil, false
+		}
+		for i := 0; i < count; i++ {
+			positions[order[first+i]] = lo + (hi-lo)*(i+1)/(count+1)
+		}
+	}
+	return positions, true
+}
+
+// PinNote godoc
+// @Summary Pin a note
+// @Description Pin a note so it is listed before unpinned notes
+// @Tags Notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Note pinned"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/pin [post]
+func PinNote(c *fiber.Ctx) error {
+	return setNoteState(c, func(n *models.Note) { n.Pinned = true }, "Note pinned successfully")
+}
+
+// UnpinNote godoc
+// @Summary Unpin a note
+// @Description Return a pinned note to the regular order
+// @Tags Notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Note unpinned"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/unpin [post]
+func UnpinNote(c *fiber.Ctx) error {
+	return setNoteState(c, func(n *models.Note) { n.Pinned = false }, "Note unpinned successfully")
+}
+
+// StarNote godoc
+// @Summary Star a note
+// @Description Mark a note as a favorite
+// @Tags Notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Note starred"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/star [post]
+func StarNote(c *fiber.Ctx) error {
+	return setNoteState(c, func(n *models.Note) { n.Starred = true }, "Note starred successfully")
+}
+
+// UnstarNote godoc
+// @Summary Unstar a note
+// @Description Remove a note from the favorites
+// @Tags Notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Note unstarred"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/unstar [post]
+func UnstarNote(c *fiber.Ctx) error {
+	return setNoteState(c, func(n *models.Note) { n.Starred = false }, "Note unstarred successfully")
+}
+
+// ArchiveNote godoc
+// @Summary Archive a note
+// @Description Archive a note. Archived notes are left out of GET /api/notes unless archived=include or archived=only is passed.
+// @Tags Notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Note archived"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/archive [post]
+func ArchiveNote(c *fiber.Ctx) error {
+	return setNoteState(c, func(n *models.Note) { n.Archived = true }, "Note archived successfully")
+}
+
+// UnarchiveNote godoc
+// @Summary Unarchive a note
+// @Description Bring an archived note back into the regular list
+// @Tags Notes
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param If-Match header string false "Only change the note if it still has this ETag"
+// @Success 200 {object} models.NoteSuccessResponse "Note unarchived"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 409 {object} models.ErrorResponse "Note changed by a concurrent request"
+// @Failure 412 {object} models.ErrorResponse "Note has been modified"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/unarchive [post]
+func UnarchiveNote(c *fiber.Ctx) error {
+	return setNoteState(c, func(n *models.Note) { n.Archived = false }, "Note unarchived successfully")
+}
+
+// ReorderNotes godoc
+// @Summary Reorder notes
+// @Description Set the manual order of notes, e.g. after a drag and drop. The listed notes are rearranged among the places they already occupy in the list, in the given order; other notes keep their places. Pinned notes are still listed first.
+// @Tags Notes
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ReorderNotesRequest true "Note IDs in their new order"
+// @Success 200 {object} models.NotesSuccessResponse "The reordered notes"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/order [put]
+func ReorderNotes(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req models.ReorderNotesRequest
+	if err := c.BodyParser(&req); err != nil || len(req.NoteIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "note_ids is required",
+		})
+	}
+
+	var changed []uuid.UUID
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		order, current, err := manualOrder(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		index := make(map[uuid.UUID]int, len(order))
+		for i, id := range order {
+			index[id] = i
+		}
+		slots := make([]int, 0, len(req.NoteIDs))
+		seen := map[uuid.UUID]bool{}
+		for _, id := range req.NoteIDs {
+			i, ok := index[id]
+			if !ok {
+				return fiber.NewError(fiber.StatusNotFound, "Note not found: "+id.String())
+			}
+			if seen[id] {
+				return fiber.NewError(fiber.StatusBadRequest, "Note listed twice: "+id.String())
+			}
+			seen[id] = true
+			slots = append(slots, i)
+		}
+		sort.Ints(slots)
+		for k, id := range req.NoteIDs {
+			order[slots[k]] = id
+		}
+
+		changed, err = positionNotes(tx, order, current, slots)
+		return err
+	})
+	if err != nil {
+		return errorResponse(c, err)
+	}
+
+	var notes []models.Note
+	if err := database.DB.Where("user_id = ? AND id IN ?", userID, req.NoteIDs).Order(noteOrder).Find(&notes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch notes",
+		})
+	}
+
+	publishNotesUpdated(changed)
+
+	for i := range notes {
+		setImageURL(c, &notes[i])
+	}
+
+	return c.JSON(models.NotesSuccessResponse{
+		Status:  "success",
+		Message: "Notes reordered successfully",
+		Data: models.NotesData{
+			Notes: notes,
+			Count: len(notes),
+		},
+	})
+}
+
+// setNoteState applies a state change to the note in :id, honoring If-Match.
+func setNoteState(c *fiber.Ctx, change func(*models.Note), message string) error {
+	userID := middleware.GetUserID(c)
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+	if preconditionFailed(c, &note) {
+		return preconditionFailedResponse(c)
+	}
+
+	change(&note)
+	if err := saveNote(database.DB, &note); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			return conflictResponse(c)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to update note",
+		})
+	}
+
+	if err := loadItems(database.DB, &note); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch note",
+		})
+	}
+	publishNoteEvent(events.NoteUpdated, &note)
+
+	setImageURL(c, &note)
+	c.Set(fiber.HeaderETag, noteETag(&note))
+
+	return c.JSON(models.NoteSuccessResponse{
+		Status:  "success",
+		Message: message,
+		Data: models.NoteData{
+			Note: note,
+		},
+	})
+}
+
+// noteFilter reads a NoteFilter from the query string.
+func noteFilter(c *fiber.Ctx) (models.NoteFilter, error) {
+	return parseNoteFilter(c.Context().QueryArgs(), middleware.GetUserID(c))
+}
+
+// parseNoteFilter reads a NoteFilter from query arguments, looking up the
+// property definitions of userID for prop.<key> filters.
+func parseNoteFilter(args *fasthttp.Args, userID string) (models.NoteFilter, error) {
+	filter := models.NoteFilter{
+		Archived: string(args.Peek("archived")),
+		Type:     string(args.Peek("type")),
+		Color:    string(args.Peek("color")),
+		Tag:      strings.TrimSpace(string(args.Peek("tag"))),
+	}
+	if filter.Archived == "" {
+		filter.Archived = "exclude"
+	}
+	switch filter.Archived {
+	case "exclude", "include", "only":
+	default:
+		return filter, errors.New("archived must be exclude, include or only")
+	}
+	if filter.Type != "" && !models.ValidNoteType(filter.Type) {
+		return filter, errors.New("type must be note or checklist")
+	}
+	if filter.Color != "" && !models.ValidColor(filter.Color) {
+		return filter, errors.New("color must be one of " + strings.Join(models.Colors, ", "))
+	}
+	for name, field := range map[string]**bool{"pinned": &filter.Pinned, "starred": &filter.Starred} {
+		if raw := string(args.Peek(name)); raw != "" {
+			value, err := strconv.ParseBool(raw)
+			if err != nil {
+				return filter, errors.New(name + " must be true or false")
+			}
+			*field = &value
+		}
+	}
+
+	var err error
+	filter.Properties, err = propertyFilters(args, func() (map[string]models.PropertySchema, error) {
+		return loadPropertySchemas(database.DB, userID)
+	})
+	return filter, err
+}
+
+// noteSort reads the sort query parameter: title, created_at, updated_at or
+// prop.<key>, prefixed with - for descending order, and returns a scope
+// ordering a query by it. Without it, notes are listed in noteOrder.
+func noteSort(c *fiber.Ctx) (func(*gorm.DB) *gorm.DB, error) {
+	order := func(by interface{}) func(*gorm.DB) *gorm.DB {
+		return func(query *gorm.DB) *gorm.DB {
+			if expr, ok := by.(clause.OrderBy); ok {
+				return query.Clauses(expr)
+			}
+			return query.Order(by)
+		}
+	}
+
+	sortBy := c.Query("sort")
+	if sortBy == "" {
+		return order(noteOrder), nil
+	}
+	field, desc := strings.CutPrefix(sortBy, "-")
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+
+	switch field {
+	case "title", "created_at", "updated_at":
+		return order(field + direction + ", id"), nil
+	}
+	key, ok := strings.CutPrefix(field, "prop.")
+	if !ok {
+		return nil, errors.New("sort must be title, created_at, updated_at or prop.<key>, optionally prefixed with -")
+	}
+	schemas, err := loadPropertySchemas(database.DB, middleware.GetUserID(c))
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := schemas[key]
+	if !ok {
+		return nil, errors.New("Unknown property \"" + key + "\"")
+	}
+	return order(propertyOrder(schema, desc)), nil
+}
+
+// applyNoteFilter narrows query to the notes selected by filter.
+func applyNoteFilter(query *gorm.DB, filter models.NoteFilter) *gorm.DB {
+	switch filter.Archived {
+	case "only":
+		query = query.Where("archived = ?", true)
+	case "include":
+	default:
+		query = query.Where("archived = ?", false)
+	}
+	if filter.Pinned != nil {
+		query = query.Where("pinned = ?", *filter.Pinned)
+	}
+	if filter.Starred != nil {
+		query = query.Where("starred = ?", *filter.Starred)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Color != "" {
+		query = query.Where("color = ?", filter.Color)
+	}
+	if filter.Tag != "" {
+		// Tags match regardless of case
+		query = query.Where("EXISTS (SELECT 1 FROM jsonb_array_elements_text(tags) AS tag WHERE LOWER(tag) = LOWER(?))", filter.Tag)
+	}
+	for _, property := range filter.Properties {
+		query = applyPropertyFilter(query, property)
+	}
+	return query
+}
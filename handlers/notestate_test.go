@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlaceNotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  []int
+		slots    []int
+		changed  int
+		wantFail bool
+	}{
+		{name: "between spaced notes", current: []int{1024, 2048, 3072, 4096}, slots: []int{1, 2}, changed: 2},
+		{name: "at the top", current: []int{1024, 2048, 3072}, slots: []int{0}, changed: 1},
+		{name: "at the bottom", current: []int{1024, 2048, 3072}, slots: []int{2}, changed: 1},
+		{name: "separate runs", current: []int{0, 10, 20, 30, 40}, slots: []int{1, 3}, changed: 2},
+		{name: "every note", current: []int{5, 5, 5}, slots: []int{0, 1, 2}, changed: 3},
+		{name: "negative positions", current: []int{-2048, -1024, 0}, slots: []int{0, 1}, changed: 2},
+		{name: "tied neighbours", current: []int{0, 0, 0}, slots: []int{1}, wantFail: true},
+		{name: "adjacent neighbours", current: []int{1, 1, 2}, slots: []int{1}, wantFail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := make([]uuid.UUID, len(tt.current))
+			current := map[uuid.UUID]int{}
+			for i, position := range tt.current {
+				order[i] = uuid.New()
+				current[order[i]] = position
+			}
+
+			positions, ok := placeNotes(order, current, tt.slots)
+			if ok == tt.wantFail {
+				t.Fatalf("got ok %v", ok)
+			}
+			if !ok {
+				return
+			}
+			if len(positions) != tt.changed {
+				t.Errorf("placed %d notes, want %d", len(positions), tt.changed)
+			}
+			previous := 0
+			for i, id := range order {
+				position, ok := positions[id]
+				if !ok {
+					position = current[id]
+				}
+				if i > 0 && position <= previous {
+					t.Errorf("note %d at %d does not follow %d", i, position, previous)
+				}
+				previous = position
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"notes-api/links"
+	"notes-api/models"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errVersionConflict is returned when a note changed between being read and
+// being written.
+var errVersionConflict = errors.New("note version conflict")
+
+// createNote inserts a new note. Unless it was given a position, it goes
+// before the user's other notes in the manual order. A tombstone the same
+// user left for an earlier note with the same ID (possible when sync clients
+// pick their own IDs) is cleared.
+func createNote(tx *gorm.DB, note *models.Note) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if note.Position == 0 {
+			if err := tx.Model(&models.Note{}).Select("COALESCE(MIN(position) - ?, 0)", positionGap).
+				Where("user_id = ?", note.UserID).Scan(&note.Position).Error; err != nil {
+				return err
+			}
+		}
+		if note.ID != uuid.Nil {
+			if err := tx.Delete(&models.NoteTombstone{}, "note_id = ? AND user_id = ?", note.ID, note.UserID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(note).Error; err != nil {
+			return err
+		}
+		return updateLinks(tx, note)
+	})
+}
+
+// saveNote writes all columns of an existing note and bumps its version. The
+// write only succeeds if the stored version still equals note.Version, so
+// concurrent writers cannot silently overwrite each other.
+func saveNote(tx *gorm.DB, note *models.Note) error {
+	expected := note.Version
+	note.Version++
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		res := tx.Select("*").Omit("id", "user_id", "created_at", clause.Associations).
+			Where("version = ?", expected).Updates(note)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		return updateLinks(tx, note)
+	})
+	if err != nil {
+		note.Version = expected
+	}
+	return err
+}
+
+// deleteNote deletes a note and everything attached to it if it is still at
+// note.Version, and leaves a tombstone behind for sync clients.
+func deleteNote(tx *gorm.DB, note *models.Note) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("note_id = ?", note.ID).Delete(&models.NoteRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("note_id = ?", note.ID).Delete(&models.ChecklistItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("note_id = ?", note.ID).Delete(&models.Reminder{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("source_id = ?", note.ID).Delete(&models.NoteLink{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Where("version = ?", note.Version).Delete(note)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errVersionConflict
+		}
+		if err := resolveInbound(tx, note); err != nil {
+			return err
+		}
+
+		tombstone := models.NoteTombstone{
+			NoteID:    note.ID,
+			UserID:    note.UserID,
+			DeletedAt: time.Now(),
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&tombstone).Error
+	})
+}
+
+// loadItems fills in the items of a checklist note, in order.
+func loadItems(tx *gorm.DB, note *models.Note) error {
+	if note.Type != models.NoteTypeChecklist {
+		note.Items = nil
+		return nil
+	}
+	note.Items = []models.ChecklistItem{}
+	return tx.Where("note_id = ?", note.ID).Order("position").Find(&note.Items).Error
+}
+
+// updateLinks rebuilds the links from note's content to other notes, and
+// resolves links elsewhere to note again.
+func updateLinks(tx *gorm.DB, note *models.Note) error {
+	if err := tx.Where("source_id = ?", note.ID).Delete(&models.NoteLink{}).Error; err != nil {
+		return err
+	}
+
+	if targets := links.Parse(note.Content); len(targets) > 0 {
+		resolved, err := resolveTargets(tx, note.UserID, targets)
+		if err != nil {
+			return err
+		}
+		rows := make([]models.NoteLink, 0, len(targets))
+		for _, target := range targets {
+			rows = append(rows, models.NoteLink{
+				SourceID: note.ID,
+				Target:   target,
+				TargetID: resolved[strings.ToLower(target)],
+				UserID:   note.UserID,
+			})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+	}
+
+	return resolveInbound(tx, note)
+}
+
+// resolveTargets looks up the notes of userID that link targets refer to,
+// keyed by lowercased target: the note with that ID for [[id]] references,
+// otherwise the oldest note with that title. Targets without a note are
+// missing from the result.
+func resolveTargets(tx *gorm.DB, userID uuid.UUID, targets []string) (map[string]*uuid.UUID, error) {
+	var ids []uuid.UUID
+	var titles []string
+	idTargets := map[uuid.UUID][]string{}
+	for _, target := range targets {
+		key := strings.ToLower(target)
+		if id, ok := links.ID(target); ok {
+			ids = append(ids, id)
+			idTargets[id] = append(idTargets[id], key)
+		} else {
+			titles = append(titles, key)
+		}
+	}
+
+	var notes []models.Note
+	query := tx.Model(&models.Note{}).Select("id", "title").Where("user_id = ?", userID)
+	switch {
+	case len(ids) > 0 && len(titles) > 0:
+		query = query.Where("id IN ? OR LOWER(title) IN ?", ids, titles)
+	case len(ids) > 0:
+		query = query.Where("id IN ?", ids)
+	default:
+		query = query.Where("LOWER(title) IN ?", titles)
+	}
+	if err := query.Order("created_at, id").Find(&notes).Error; err != nil {
+		return nil, err
+	}
+
+	resolved := map[string]*uuid.UUID{}
+	for i := range notes {
+		id := &notes[i].ID
+		for _, key := range idTargets[*id] {
+			resolved[key] = id
+		}
+		if key := strings.ToLower(notes[i].Title); slices.Contains(titles, key) && resolved[key] == nil {
+			resolved[key] = id
+		}
+	}
+	return resolved, nil
+}
+
+// resolveInbound resolves links that point to note, or name its title, again
+// after it was created, changed or deleted: a title link follows the note to
+// its new title, or falls back to the oldest note still having the old one.
+func resolveInbound(tx *gorm.DB, note *models.Note) error {
+	var targets []string
+	if err := tx.Model(&models.NoteLink{}).Distinct("target").
+		Where("user_id = ? AND (target_id = ? OR LOWER(target) = LOWER(?))", note.UserID, note.ID, note.Title).
+		Pluck("target", &targets).Error; err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	resolved, err := resolveTargets(tx, note.UserID, targets)
+	if err != nil {
+		return err
+	}
+	done := map[string]bool{}
+	for _, target := range targets {
+		key := strings.ToLower(target)
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		if err := tx.Model(&models.NoteLink{}).
+			Where("user_id = ? AND LOWER(target) = ? AND target_id IS DISTINCT FROM ?", note.UserID, key, resolved[key]).
+			Update("target_id", resolved[key]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameLinks rewrites [[oldTitle]] references to note in other notes when
+// note is renamed to note.Title. It has to run before note itself is saved,
+// which resolves the old links elsewhere. It returns the notes it changed,
+// for the caller to publish once the transaction has committed.
+func renameLinks(tx *gorm.DB, note *models.Note, oldTitle string) ([]models.Note, error) {
+	if oldTitle == note.Title {
+		return nil, nil
+	}
+
+	linking := tx.Model(&models.NoteLink{}).Select("source_id").
+		Where("target_id = ? AND LOWER(target) = LOWER(?)", note.ID, oldTitle)
+	var sources []models.Note
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id <> ? AND id IN (?)", note.ID, linking).Find(&sources).Error; err != nil {
+		return nil, err
+	}
+
+	var changed []models.Note
+	for i := range sources {
+		content, ok := links.Rename(sources[i].Content, oldTitle, note.Title)
+		if !ok {
+			continue
+		}
+		sources[i].Content = content
+		if err := saveNote(tx, &sources[i]); err != nil {
+			return nil, err
+		}
+		if err := loadItems(tx, &sources[i]); err != nil {
+			return nil, err
+		}
+		changed = append(changed, sources[i])
+	}
+	return changed, nil
+}
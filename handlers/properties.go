@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"notes-api/database"
+	"notes-api/middleware"
+	"notes-api/models"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var propertyKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// errOptionsInUse is returned when select options notes still have would be
+// removed.
+var errOptionsInUse = errors.New("options in use")
+
+// ListPropertySchemas godoc
+// @Summary List property definitions
+// @Description Retrieve the custom note properties the authenticated user has defined
+// @Tags Properties
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.PropertySchemasSuccessResponse "List of properties"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/properties [get]
+func ListPropertySchemas(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var schemas []models.PropertySchema
+	if err := database.DB.Where("user_id = ?", userID).Order("key").Find(&schemas).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch properties",
+		})
+	}
+
+	return c.JSON(models.PropertySchemasSuccessResponse{
+		Status:  "success",
+		Message: "Properties retrieved successfully",
+		Data: models.PropertySchemasData{
+			Properties: schemas,
+			Count:      len(schemas),
+		},
+	})
+}
+
+// CreatePropertySchema godoc
+// @Summary Define a property
+// @Description Define a custom property for notes. key is lowercase letters, digits and underscores; type is text, number, date (YYYY-MM-DD) or select, which requires options.
+// @Tags Properties
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreatePropertySchemaRequest true "Property definition"
+// @Success 201 {object} models.PropertySchemaSuccessResponse "Property created successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 409 {object} models.ErrorResponse "Key already defined"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/properties [post]
+func CreatePropertySchema(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req models.CreatePropertySchemaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+
+	userUUID, _ := uuid.Parse(userID)
+	schema := models.PropertySchema{
+		UserID:  userUUID,
+		Key:     req.Key,
+		Name:    req.Name,
+		Type:    req.Type,
+		Options: req.Options,
+	}
+	if schema.Name == "" {
+		schema.Name = schema.Key
+	}
+	if err := validatePropertySchema(&schema); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+
+	var count int64
+	database.DB.Model(&models.PropertySchema{}).Where("user_id = ? AND key = ?", userID, schema.Key).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "A property with this key already exists",
+		})
+	}
+
+	if err := database.DB.Create(&schema).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to create property",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.PropertySchemaSuccessResponse{
+		Status:  "success",
+		Message: "Property created successfully",
+		Data: models.PropertySchemaData{
+			Property: schema,
+		},
+	})
+}
+
+// UpdatePropertySchema godoc
+// @Summary Update a property definition
+// @Description Rename a property or change the options of a select property. New writes are checked against the new options. Options that notes still have cannot be removed; change those notes first.
+// @Tags Properties
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Property ID"
+// @Param request body models.UpdatePropertySchemaRequest true "Fields to change"
+// @Success 200 {object} models.PropertySchemaSuccessResponse "Property updated successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Property not found"
+// @Failure 409 {object} models.ErrorResponse "Removed options are in use"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/properties/{id} [patch]
+func UpdatePropertySchema(c *fiber.Ctx) error {
+	schema, err := findPropertySchema(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Property not found",
+		})
+	}
+
+	var req models.UpdatePropertySchemaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	if req.Name != nil {
+		schema.Name = *req.Name
+	}
+	if req.Options != nil {
+		schema.Options = *req.Options
+	}
+	if err := validatePropertySchema(schema); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+
+	// Options that notes still have cannot be removed
+	var inUse []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.PropertySchema
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", schema.ID).First(&current).Error; err != nil {
+			return err
+		}
+		var removed []string
+		for _, option := range current.Options {
+			if !slices.Contains(schema.Options, option) {
+				removed = append(removed, option)
+			}
+		}
+		if len(removed) > 0 {
+			if err := tx.Raw("SELECT DISTINCT properties ->> ? FROM notes WHERE user_id = ? AND properties ->> ? IN ?",
+				schema.Key, schema.UserID, schema.Key, removed).Scan(&inUse).Error; err != nil {
+				return err
+			}
+			if len(inUse) > 0 {
+				return errOptionsInUse
+			}
+		}
+		return tx.Save(schema).Error
+	})
+	if errors.Is(err, errOptionsInUse) {
+		sort.Strings(inUse)
+		return c.Status(fiber.StatusConflict).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Options still used by notes cannot be removed: " + strings.Join(inUse, ", "),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to update property",
+		})
+	}
+
+	return c.JSON(models.PropertySchemaSuccessResponse{
+		Status:  "success",
+		Message: "Property updated successfully",
+		Data: models.PropertySchemaData{
+			Property: *schema,
+		},
+	})
+}
+
+// DeletePropertySchema godoc
+// @Summary Delete a property definition
+// @Description Delete a property and remove its values from all notes
+// @Tags Properties
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Property ID"
+// @Success 200 {object} models.MessageSuccessResponse "Property deleted successfully"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Property not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/properties/{id} [delete]
+func DeletePropertySchema(c *fiber.Ctx) error {
+	schema, err := findPropertySchema(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Property not found",
+		})
+	}
+
+	var changed []uuid.UUID
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Note{}).
+			Where("user_id = ? AND properties -> ? IS NOT NULL", schema.UserID, schema.Key).
+			Pluck("id", &changed).Error; err != nil {
+			return err
+		}
+		if len(changed) > 0 {
+			columns := models.ChangeColumns()
+			columns["properties"] = gorm.Expr("properties - ?", schema.Key)
+			columns["version"] = gorm.Expr("version + 1")
+			if err := tx.Model(&models.Note{}).Where("id IN ?", changed).UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(schema).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to delete property",
+		})
+	}
+
+	publishNotesUpdated(changed)
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Property deleted successfully",
+		Data: models.MessageData{
+			Message: "Property deleted successfully",
+		},
+	})
+}
+
+func findPropertySchema(c *fiber.Ctx) (*models.PropertySchema, error) {
+	userID := middleware.GetUserID(c)
+
+	var schema models.PropertySchema
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&schema).Error; err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+func validatePropertySchema(schema *models.PropertySchema) error {
+	if !propertyKey.MatchString(schema.Key) {
+		return errors.New("Key must start with a lowercase letter and contain only lowercase letters, digits and underscores (at most 40)")
+	}
+	switch schema.Type {
+	case models.PropertyText, models.PropertyNumber, models.PropertyDate:
+		schema.Options = nil
+	case models.PropertySelect:
+		if len(schema.Options) == 0 {
+			return errors.New("Select properties need at least one option")
+		}
+		seen := map[string]bool{}
+		for _, option := range schema.Options {
+			if option == "" || seen[option] {
+				return errors.New("Options must be non-empty and unique")
+			}
+			seen[option] = true
+		}
+	default:
+		return errors.New("Type must be text, number, date or select")
+	}
+	return nil
+}
+
+// loadPropertySchemas returns a user's property definitions by key.
+func loadPropertySchemas(tx *gorm.DB, userID interface{}) (map[string]models.PropertySchema, error) {
+	var schemas []models.PropertySchema
+	if err := tx.Where("user_id = ?", userID).Find(&schemas).Error; err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]models.PropertySchema, len(schemas))
+	for _, schema := range schemas {
+		byKey[schema.Key] = schema
+	}
+	return byKey, nil
+}
+
+// validateProperties checks note properties against the user's property
+// definitions. Null values are dropped.
+func validateProperties(tx *gorm.DB, userID interface{}, properties map[string]interface{}) error {
+	if len(properties) == 0 {
+		return nil
+	}
+	schemas, err := loadPropertySchemas(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := properties[key]
+		if value == nil {
+			delete(properties, key)
+			continue
+		}
+		schema, ok := schemas[key]
+		if !ok {
+			return fmt.Errorf("Unknown property %q; define it first", key)
+		}
+		if err := checkPropertyValue(schema, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkPropertyValue(schema models.PropertySchema, value interface{}) error {
+	switch schema.Type {
+	case models.PropertyNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("Property %q must be a number", schema.Key)
+		}
+	case models.PropertyDate:
+		s, ok := value.(string)
+		if _, err := time.Parse(models.PropertyDateLayout, s); !ok || err != nil {
+			return fmt.Errorf("Property %q must be a date (YYYY-MM-DD)", schema.Key)
+		}
+	case models.PropertySelect:
+		s, _ := value.(string)
+		for _, option := range schema.Options {
+			if s == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("Property %q must be one of %s", schema.Key, strings.Join(schema.Options, ", "))
+	default:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("Property %q must be a string", schema.Key)
+		}
+	}
+	return nil
+}
+
+// propertyFilters reads prop.<key>=value and prop.<key>.<op>=value query
+// parameters.
+func propertyFilters(args *fasthttp.Args, schemas func() (map[string]models.PropertySchema, error)) ([]models.PropertyFilter, error) {
+	var filters []models.PropertyFilter
+	var known map[string]models.PropertySchema
+
+	var parseErr error
+	args.VisitAll(func(k, v []byte) {
+		name := string(k)
+		if parseErr != nil || !strings.HasPrefix(name, "prop.") {
+			return
+		}
+		if known == nil {
+			if known, parseErr = schemas(); parseErr != nil {
+				return
+			}
+		}
+
+		key, op, _ := strings.Cut(strings.TrimPrefix(name, "prop."), ".")
+		if op == "" {
+			op = "eq"
+		}
+		schema, ok := known[key]
+		if !ok {
+			parseErr = fmt.Errorf("Unknown property %q", key)
+			return
+		}
+		switch op {
+		case "eq", "ne":
+		case "gt", "gte", "lt", "lte":
+			if schema.Type != models.PropertyNumber && schema.Type != models.PropertyDate {
+				parseErr = fmt.Errorf("Property %q only supports eq and ne", key)
+				return
+			}
+		default:
+			parseErr = fmt.Errorf("Unknown operator %q; use eq, ne, gt, gte, lt or lte", op)
+			return
+		}
+
+		var value interface{} = string(v)
+		switch schema.Type {
+		case models.PropertyNumber:
+			n, err := strconv.ParseFloat(string(v), 64)
+			if err != nil {
+				parseErr = fmt.Errorf("Property %q must be compared with a number", key)
+				return
+			}
+			value = n
+		case models.PropertyDate:
+			if err := checkPropertyValue(schema, value); err != nil {
+				parseErr = err
+				return
+			}
+		}
+		filters = append(filters, models.PropertyFilter{Key: key, Type: schema.Type, Op: op, Value: value})
+	})
+	return filters, parseErr
+}
+
+var propertyOps = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+// propertyExpr is the SQL expression for a property value, numeric for
+// number properties.
+func propertyExpr(propertyType string) string {
+	if propertyType == models.PropertyNumber {
+		return "(CASE WHEN jsonb_typeof(properties -> ?) = 'number' THEN (properties ->> ?)::numeric END)"
+	}
+	return "(properties ->> ?)"
+}
+
+// applyPropertyFilter narrows query to notes whose property matches f.
+func applyPropertyFilter(query *gorm.DB, f models.PropertyFilter) *gorm.DB {
+	expr := propertyExpr(f.Type)
+	args := []interface{}{f.Key}
+	if f.Type == models.PropertyNumber {
+		args = append(args, f.Key)
+	}
+	if f.Op == "ne" {
+		// Notes without the property also differ from the value
+		return query.Where(expr+" IS DISTINCT FROM ?", append(args, f.Value)...)
+	}
+	return query.Where(expr+" "+propertyOps[f.Op]+" ?", append(args, f.Value)...)
+}
+
+// propertyOrder is the ORDER BY clause for sorting by a property. Notes
+// without the property come last, and notes with the same value are ordered
+// by ID, so pages do not overlap.
+func propertyOrder(schema models.PropertySchema, desc bool) clause.OrderBy {
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	args := []interface{}{schema.Key}
+	if schema.Type == models.PropertyNumber {
+		args = append(args, schema.Key)
+	}
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:                propertyExpr(schema.Type) + " " + direction + " NULLS LAST, id",
+		Vars:               args,
+		WithoutParentheses: true,
+	}}
+}
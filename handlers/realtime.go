@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsWriteTimeout = 10 * time.Second
+
+	sseHeartbeat   = 15 * time.Second
+	sseRetry       = 3 * time.Second
+	sseReplayBatch = 200
+)
+
+// WebSocketUpgrade only lets WebSocket handshakes through and hands the
+// authenticated user to the socket handler.
+func WebSocketUpgrade(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "WebSocket upgrade required",
+		})
+	}
+	c.Locals("user_id", middleware.GetUserID(c))
+	c.Locals("host", c.Get("Host"))
+	return c.Next()
+}
+
+// NoteEventsSocket godoc
+// @Summary Stream note change events over WebSocket
+// @Description Upgrade to a WebSocket that receives a JSON message ({"type": "note.created|note.updated|note.deleted", "note_id": "...", "note": {...}, "created_at": "..."}) whenever one of the user's notes changes on any device. Browsers that cannot set the Authorization header may pass the token as access_token.
+// @Tags Realtime
+// @Security BearerAuth
+// @Param access_token query string false "JWT, for clients that cannot set headers"
+// @Success 101 "Switching protocols"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 426 {object} models.ErrorResponse "WebSocket upgrade required"
+// @Router /api/ws [get]
+func NoteEventsSocket(c *fiber.Ctx) error {
+	return noteEventsSocket(c)
+}
+
+var noteEventsSocket = websocket.New(streamNoteEvents)
+
+func streamNoteEvents(conn *websocket.Conn) {
+	userID, _ := uuid.Parse(conn.Locals("user_id").(string))
+	host, _ := conn.Locals("host").(string)
+
+	sub := events.Subscribe(userID)
+	defer sub.Close()
+
+	// Clients only send control frames; reading detects when they go away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, reconnect"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if !event.Realtime() {
+				continue
+			}
+			resolveEventURLs(&event, host)
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// publishNoteEvent notifies the note's owner about a change. Call it only
+// after the change has been committed.
+func publishNoteEvent(eventType string, note *models.Note) {
+	event := events.Event{
+		Type:   eventType,
+		UserID: note.UserID,
+		NoteID: note.ID,
+	}
+	if eventType != events.NoteDeleted {
+		// Image URLs are made absolute per connection, see resolveEventURLs
+		event.Note = events.Snapshot(note)
+	}
+	events.Publish(event)
+}
+
+// publishNotesUpdated publishes note.updated for notes changed by a bulk
+// update, reloading them first. Call it only after the change has been
+// committed.
+func publishNotesUpdated(ids []uuid.UUID) {
+	if len(ids) == 0 {
+		return
+	}
+	var notes []models.Note
+	if err := database.DB.Where("id IN ?", ids).Find(&notes).Error; err != nil {
+		return
+	}
+	for i := range notes {
+		loadItems(database.DB, &notes[i])
+		publishNoteEvent(events.NoteUpdated, &notes[i])
+	}
+}
+
+// resolveEventURLs turns the host-relative URLs stored in events into
+// absolute URLs for the host the client connected to.
+func resolveEventURLs(event *events.Event, host string) {
+	if event.Note != nil && strings.HasPrefix(event.Note.ImageURL, "/") {
+		note := *event.Note
+		note.ImageURL = "https://" + host + note.ImageURL
+		event.Note = &note
+	}
+}
+
+// StreamEvents godoc
+// @Summary Stream note change events with Server-Sent Events
+// @Description Open a text/event-stream of note change events, an alternative to the WebSocket for clients behind proxies that break WebSockets. Events carry an SSE id marking their position in the event log; after a disconnect, EventSource resends the last one in Last-Event-ID and the stream resumes with the events missed in between. Events that could still be preceded by one being committed are sent without an id, so some may arrive twice after a reconnect; drop duplicates by the id in the event data. If those events are no longer retained, a "reset" event is sent first and the client should resynchronize. The token may be passed as access_token.
+// @Tags Realtime
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param Last-Event-ID header string false "SSE id of the last event received"
+// @Param last_event_id query string false "Alternative to the Last-Event-ID header"
+// @Param access_token query string false "JWT, for clients that cannot set headers"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} models.ErrorResponse "Invalid Last-Event-ID"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Router /api/events [get]
+func StreamEvents(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(middleware.GetUserID(c))
+	host := c.Get("Host")
+
+	var last models.Change
+	resume := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	if resume != "" {
+		var err error
+		last, err = parseEventID(resume)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Invalid Last-Event-ID",
+			})
+		}
+	}
+
+	// Subscribe before replaying so nothing published in between is lost
+	sub := events.Subscribe(userID)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		if last.Seq > 0 {
+			if expired, err := events.Expired(last.Seq); err == nil && expired {
+				fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+			}
+			for {
+				missed, err := events.Since(userID, last, sseReplayBatch)
+				if err != nil {
+					return
+				}
+				for _, event := range missed {
+					writeSSE(w, event, host, true)
+					last = event.Position()
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+				if len(missed) < sseReplayBatch {
+					break
+				}
+			}
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					// Fell behind; the client reconnects and resumes from the log
+					return
+				}
+				// Take whatever else is waiting, to look up for the whole
+				// batch which events a client can resume from
+				batch := []events.Event{event}
+				closed := false
+			drain:
+				for len(batch) < sseReplayBatch {
+					select {
+					case event, ok := <-sub.C:
+						if !ok {
+							closed = true
+							break drain
+						}
+						batch = append(batch, event)
+					default:
+						break drain
+					}
+				}
+				horizon := resumeHorizon(batch)
+				for _, event := range batch {
+					// Events replayed already; anything committed after the
+					// replay comes after it in the log
+					if event.ID != 0 && !event.Position().After(last) {
+						continue
+					}
+					writeSSE(w, event, host, event.ID != 0 && event.XID < horizon)
+				}
+				if closed {
+					w.Flush()
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// resumeHorizon returns the transaction below which events of batch can be
+// resumed from without missing any: no transaction that could record an
+// earlier event is still running. It is zero if none can.
+func resumeHorizon(batch []events.Event) int64 {
+	for _, event := range batch {
+		if event.ID == 0 {
+			continue
+		}
+		horizon, err := models.SafeXID(database.DB)
+		if err != nil {
+			return 0
+		}
+		return horizon
+	}
+	return 0
+}
+
+// writeSSE writes an event to the stream. Its position is sent as the
+// event's id only if withID is set, so a client resuming from the last id it
+// received never skips an event, though it may receive some twice.
+func writeSSE(w *bufio.Writer, event events.Event, host string, withID bool) {
+	if !event.Realtime() {
+		return
+	}
+	resolveEventURLs(&event, host)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if withID && event.ID != 0 {
+		fmt.Fprintf(w, "id: %s\n", formatEventID(event.Position()))
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+// formatEventID encodes the position of an event as an SSE event id.
+func formatEventID(position models.Change) string {
+	return strconv.FormatInt(position.XID, 10) + "." + strconv.FormatInt(position.Seq, 10)
+}
+
+// parseEventID decodes an SSE event id.
+func parseEventID(id string) (models.Change, error) {
+	xid, seq, ok := strings.Cut(id, ".")
+	if !ok {
+		return models.Change{}, errors.New("invalid event id")
+	}
+	var position models.Change
+	var err1, err2 error
+	position.XID, err1 = strconv.ParseInt(xid, 10, 64)
+	position.Seq, err2 = strconv.ParseInt(seq, 10, 64)
+	if err1 != nil || err2 != nil || position.XID < 0 || position.Seq < 0 {
+		return models.Change{}, errors.New("invalid event id")
+	}
+	return position, nil
+}
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"notes-api/database"
+	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/reminders"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxSnooze = 30 * 24 * time.Hour
+
+// ListNoteReminders godoc
+// @Summary List a note's reminders
+// @Description Retrieve the reminders attached to a note, soonest first
+// @Tags Reminders
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Success 200 {object} models.RemindersSuccessResponse "List of reminders"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/reminders [get]
+func ListNoteReminders(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+
+	var list []models.Reminder
+	if err := database.DB.Where("note_id = ?", note.ID).Order("next_at").Find(&list).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch reminders",
+		})
+	}
+
+	return c.JSON(models.RemindersSuccessResponse{
+		Status:  "success",
+		Message: "Reminders retrieved successfully",
+		Data: models.RemindersData{
+			Reminders: list,
+			Count:     len(list),
+		},
+	})
+}
+
+// CreateReminder godoc
+// @Summary Add a reminder to a note
+// @Description Schedule a reminder at an absolute time. remind_at is an RFC 3339 timestamp, or a local date-time interpreted in timezone (an IANA name, default UTC). An optional RRULE (RFC 5545, e.g. FREQ=WEEKLY;BYDAY=MO) makes it recur from remind_at, keeping its local time across DST changes. When due, a reminder.due event is sent through the chosen channels: realtime (WebSocket and SSE, the default), webhook and email.
+// @Tags Reminders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Note ID"
+// @Param request body models.CreateReminderRequest true "Reminder schedule"
+// @Success 201 {object} models.ReminderSuccessResponse "Reminder created successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Note not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/notes/{id}/reminders [post]
+func CreateReminder(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&note).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Note not found",
+		})
+	}
+
+	var req models.CreateReminderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+
+	userUUID, _ := uuid.Parse(userID)
+	reminder := models.Reminder{
+		NoteID: note.ID,
+		UserID: userUUID,
+	}
+	if err := reminders.Schedule(&reminder, req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+
+	if err := database.DB.Create(&reminder).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to create reminder",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.ReminderSuccessResponse{
+		Status:  "success",
+		Message: "Reminder created successfully",
+		Data: models.ReminderData{
+			Reminder: reminder,
+		},
+	})
+}
+
+// ListReminders godoc
+// @Summary List reminders
+// @Description Retrieve the authenticated user's reminders across all notes, soonest first
+// @Tags Reminders
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Only reminders in this state" Enums(scheduled, fired, dismissed)
+// @Success 200 {object} models.RemindersSuccessResponse "List of reminders"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/reminders [get]
+func ListReminders(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	query := database.DB.Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var list []models.Reminder
+	if err := query.Order("next_at").Find(&list).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch reminders",
+		})
+	}
+
+	return c.JSON(models.RemindersSuccessResponse{
+		Status:  "success",
+		Message: "Reminders retrieved successfully",
+		Data: models.RemindersData{
+			Reminders: list,
+			Count:     len(list),
+		},
+	})
+}
+
+// SnoozeReminder godoc
+// @Summary Snooze a reminder
+// @Description Fire a reminder again after the given number of minutes or at the given time. A one-off reminder is moved; a recurring reminder fires once more in between and keeps its schedule.
+// @Tags Reminders
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Reminder ID"
+// @Param request body models.SnoozeReminderRequest true "Snooze duration"
+// @Success 200 {object} models.ReminderSuccessResponse "Reminder snoozed successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Reminder not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/reminders/{id}/snooze [post]
+func SnoozeReminder(c *fiber.Ctx) error {
+	reminder, err := findReminder(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Reminder not found",
+		})
+	}
+
+	var req models.SnoozeReminderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+
+	now := time.Now()
+	until := now.Add(time.Duration(req.Minutes) * time.Minute)
+	if req.Until != nil {
+		until = *req.Until
+	}
+	if !until.After(now) || until.Sub(now) > maxSnooze {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Snooze must end in the future and within 30 days",
+		})
+	}
+
+	err = lockReminder(reminder, func() { reminders.Snooze(reminder, until) })
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to snooze reminder",
+		})
+	}
+
+	return c.JSON(models.ReminderSuccessResponse{
+		Status:  "success",
+		Message: "Reminder snoozed successfully",
+		Data: models.ReminderData{
+			Reminder: *reminder,
+		},
+	})
+}
+
+// DismissReminder godoc
+// @Summary Dismiss a reminder
+// @Description Acknowledge a reminder. A one-off reminder is marked dismissed and will not fire again; a recurring reminder drops any pending snooze and carries on with its next occurrence.
+// @Tags Reminders
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Reminder ID"
+// @Success 200 {object} models.ReminderSuccessResponse "Reminder dismissed successfully"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Reminder not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/reminders/{id}/dismiss [post]
+func DismissReminder(c *fiber.Ctx) error {
+	reminder, err := findReminder(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Reminder not found",
+		})
+	}
+
+	err = lockReminder(reminder, func() { reminders.Dismiss(reminder) })
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to dismiss reminder",
+		})
+	}
+
+	return c.JSON(models.ReminderSuccessResponse{
+		Status:  "success",
+		Message: "Reminder dismissed successfully",
+		Data: models.ReminderData{
+			Reminder: *reminder,
+		},
+	})
+}
+
+// DeleteReminder godoc
+// @Summary Delete a reminder
+// @Description Delete a reminder, stopping all future occurrences
+// @Tags Reminders
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Reminder ID"
+// @Success 200 {object} models.MessageSuccessResponse "Reminder deleted successfully"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Reminder not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/reminders/{id} [delete]
+func DeleteReminder(c *fiber.Ctx) error {
+	reminder, err := findReminder(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Reminder not found",
+		})
+	}
+
+	if err := database.DB.Delete(reminder).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to delete reminder",
+		})
+	}
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Reminder deleted successfully",
+		Data: models.MessageData{
+			Message: "Reminder deleted successfully",
+		},
+	})
+}
+
+// lockReminder reloads a reminder locked for update, applies change to it and
+// saves it, so the change is made to its current state and cannot be
+// overwritten by the scheduler firing it at the same time.
+func lockReminder(reminder *models.Reminder, change func()) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", reminder.ID).First(reminder).Error; err != nil {
+			return err
+		}
+		change()
+		return tx.Save(reminder).Error
+	})
+}
+
+func findReminder(c *fiber.Ctx) (*models.Reminder, error) {
+	userID := middleware.GetUserID(c)
+
+	var reminder models.Reminder
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&reminder).Error; err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
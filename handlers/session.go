@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"notes-api/accounts"
+	"notes-api/database"
+	"notes-api/middleware"
+	"notes-api/models"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ListSessions godoc
+// @Summary List my sessions
+// @Description List the devices the account is logged in on, most recently used first: the device name, User-Agent and IP address of each, when it logged in and when it was last seen. The session of the token making the request has current set.
+// @Tags Account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SessionsSuccessResponse "Sessions"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/sessions [get]
+func ListSessions(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND expires_at > now()", userID).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch sessions",
+		})
+	}
+	current := middleware.GetSessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.String() == current
+	}
+
+	return c.JSON(models.SessionsSuccessResponse{
+		Status:  "success",
+		Message: "Sessions retrieved successfully",
+		Data: models.SessionsData{
+			Sessions: sessions,
+			Count:    len(sessions),
+		},
+	})
+}
+
+// RevokeSession godoc
+// @Summary Log out a session
+// @Description Revoke one session. Its token stops working at once; revoking the current session logs this client out.
+// @Tags Account
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} models.MessageSuccessResponse "Session revoked"
+// @Failure 400 {object} models.ErrorResponse "Invalid session ID"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Session not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/sessions/{id} [delete]
+func RevokeSession(c *fiber.Ctx) error {
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid session ID",
+		})
+	}
+
+	res := database.DB.Where("id = ? AND user_id = ?", sessionID, middleware.GetUserID(c)).Delete(&models.Session{})
+	if res.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to revoke session",
+		})
+	}
+	if res.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Session not found",
+		})
+	}
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Session revoked",
+		Data: models.MessageData{
+			Message: "The device has been logged out.",
+		},
+	})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Log out all other sessions
+// @Description Revoke every session except the one making the request, logging the account out on all other devices.
+// @Tags Account
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.MessageSuccessResponse "Sessions revoked"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/account/sessions [delete]
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	userID, _ := uuid.Parse(middleware.GetUserID(c))
+	current, _ := uuid.Parse(middleware.GetSessionID(c))
+
+	revoked, err := accounts.EndSessions(database.DB, userID, current)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to revoke sessions",
+		})
+	}
+
+	message := strconv.FormatInt(revoked, 10) + " other devices have been logged out."
+	if revoked == 1 {
+		message = "1 other device has been logged out."
+	}
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Sessions revoked",
+		Data: models.MessageData{
+			Message: message,
+		},
+	})
+}
+
+// currentSession loads the session of the request's token.
+func currentSession(c *fiber.Ctx) (*models.Session, error) {
+	sessionID := middleware.GetSessionID(c)
+	if sessionID == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var session models.Session
+	if err := database.DB.Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
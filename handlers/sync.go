@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/render"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+	maxSyncPush      = 500
+)
+
+// GetSyncChanges godoc
+// @Summary Get note changes since a sync token
+// @Description Return notes created or updated and notes deleted since the given sync token, ordered by change. Omit since for a full sync. Keep calling with the returned sync_token while has_more is true.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param since query string false "Sync token from a previous response"
+// @Param limit query int false "Maximum number of changes to return (default 500, max 1000)"
+// @Success 200 {object} models.SyncSuccessResponse "Changes since the sync token"
+// @Failure 400 {object} models.ErrorResponse "Invalid sync token"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/sync [get]
+func GetSyncChanges(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	since, err := parseSyncToken(c.Query("since"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid sync token",
+		})
+	}
+
+	limit := c.QueryInt("limit", defaultSyncLimit)
+	if limit <= 0 || limit > maxSyncLimit {
+		limit = defaultSyncLimit
+	}
+
+	// Only changes of transactions that have ended are returned, so a later
+	// commit of an earlier change cannot fall behind the token
+	horizon, err := models.SafeXID(database.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch changes",
+		})
+	}
+	changed := "user_id = ? AND (change_xid, change_seq) > (?, ?) AND change_xid < ?"
+
+	// Fetch one extra row of each kind to tell whether more changes follow
+	var notes []models.Note
+	if err := database.DB.Where(changed, userID, since.XID, since.Seq, horizon).
+		Preload("Items", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Order("change_xid, change_seq").Limit(limit + 1).Find(&notes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch changes",
+		})
+	}
+
+	deleted := []models.NoteTombstone{}
+	if since != (models.Change{}) {
+		if err := database.DB.Where(changed, userID, since.XID, since.Seq, horizon).
+			Order("change_xid, change_seq").Limit(limit + 1).Find(&deleted).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Failed to fetch changes",
+			})
+		}
+	}
+
+	resultNotes, resultDeleted, token, hasMore := mergeChanges(notes, deleted, since, limit)
+	for i := range resultNotes {
+		setImageURL(c, &resultNotes[i])
+	}
+
+	return c.JSON(models.SyncSuccessResponse{
+		Status:  "success",
+		Message: "Changes retrieved successfully",
+		Data: models.SyncData{
+			Notes:     resultNotes,
+			Deleted:   resultDeleted,
+			SyncToken: formatSyncToken(token),
+			HasMore:   hasMore,
+		},
+	})
+}
+
+// PushSyncChanges godoc
+// @Summary Push offline changes
+// @Description Apply a batch of note changes made offline. Each change is applied independently; updates and deletes must carry the base_version they were made against and are reported as conflicts (with the server copy) when the note has changed since. Creates may supply their own note ID. Changes that are invalid will never apply; changes that failed with status error should be pushed again.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SyncPushRequest true "Changes to apply"
+// @Success 200 {object} models.SyncPushSuccessResponse "Per-change results"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Router /api/sync/push [post]
+func PushSyncChanges(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+	userUUID, _ := uuid.Parse(userID)
+
+	var req models.SyncPushRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	if len(req.Changes) > maxSyncPush {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Too many changes; push at most " + strconv.Itoa(maxSyncPush) + " at a time",
+		})
+	}
+
+	results := make([]models.SyncChangeResult, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		result := applySyncChange(userUUID, change)
+		if result.Note != nil {
+			setImageURL(c, result.Note)
+		}
+		results = append(results, result)
+	}
+
+	return c.JSON(models.SyncPushSuccessResponse{
+		Status:  "success",
+		Message: "Changes processed",
+		Data: models.SyncPushData{
+			Results: results,
+		},
+	})
+}
+
+func applySyncChange(userID uuid.UUID, change models.SyncChange) models.SyncChangeResult {
+	result := models.SyncChangeResult{ID: change.ID, Action: change.Action}
+	invalid := func(msg string) models.SyncChangeResult {
+		result.Status = "invalid"
+		result.Error = msg
+		return result
+	}
+	// failed reports a server-side failure; unlike an invalid change, the
+	// client should push it again later
+	failed := func(msg string) models.SyncChangeResult {
+		result.Status = "error"
+		result.Error = msg
+		return result
+	}
+
+	if change.Action == "create" {
+		if change.Title == nil || *change.Title == "" {
+			return invalid("Title is required")
+		}
+		note := models.Note{Title: *change.Title, UserID: userID}
+		if change.Content != nil {
+			note.Content = *change.Content
+		}
+		if change.Format != nil {
+			if !render.ValidFormat(*change.Format) {
+				return invalid("Format must be plain or markdown")
+			}
+			note.Format = *change.Format
+		}
+		applySyncState(&note, &change)
+		if err := applySyncProperties(userID, &note, &change); err != nil {
+			return invalid(err.Error())
+		}
+
+		if change.ID != nil {
+			note.ID = *change.ID
+			// IDs of other users' notes, live or deleted, are refused like
+			// invalid ones, so they cannot be probed for
+			if note.ID == uuid.Nil {
+				return invalid("Invalid note ID")
+			}
+			foreign, err := foreignNoteID(note.ID, userID)
+			if err != nil {
+				return failed("Failed to create note")
+			}
+			if foreign {
+				return invalid("Invalid note ID")
+			}
+			var existing models.Note
+			err = database.DB.Where("id = ?", note.ID).First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return failed("Failed to create note")
+			}
+			if err == nil {
+				// Already created, e.g. by an earlier push that timed out
+				result.Status = "conflict"
+				result.Error = "Note already exists"
+				result.Note = &existing
+				return result
+			}
+		}
+
+		if err := createNote(database.DB, &note); err != nil {
+			return failed("Failed to create note")
+		}
+		publishNoteEvent(events.NoteCreated, &note)
+		result.ID = &note.ID
+		result.Status = "applied"
+		result.Note = &note
+		return result
+	}
+
+	if change.Action != "update" && change.Action != "delete" {
+		return invalid("Action must be create, update or delete")
+	}
+	if change.ID == nil {
+		return invalid("Note ID is required")
+	}
+	if change.BaseVersion <= 0 {
+		return invalid("base_version is required")
+	}
+
+	var note models.Note
+	if err := database.DB.Where("id = ? AND user_id = ?", *change.ID, userID).First(&note).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return failed("Failed to " + change.Action + " note")
+		}
+		result.Status = "not_found"
+		result.Error = "Note not found"
+		return result
+	}
+	if note.Version != change.BaseVersion {
+		result.Status = "conflict"
+		result.Error = "Note has been modified since base_version"
+		result.Note = &note
+		return result
+	}
+
+	var err error
+	var renamed []models.Note
+	if change.Action == "update" {
+		oldTitle := note.Title
+		if change.Title != nil {
+			if *change.Title == "" {
+				return invalid("Title cannot be empty")
+			}
+			note.Title = *change.Title
+		}
+		if change.Content != nil {
+			note.Content = *change.Content
+		}
+		if change.Format != nil {
+			if !render.ValidFormat(*change.Format) {
+				return invalid("Format must be plain or markdown")
+			}
+			note.Format = *change.Format
+		}
+		applySyncState(&note, &change)
+		if err := applySyncProperties(userID, &note, &change); err != nil {
+			return invalid(err.Error())
+		}
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if renamed, err = renameLinks(tx, &note, oldTitle); err != nil {
+				return err
+			}
+			if err := saveNote(tx, &note); err != nil {
+				return err
+			}
+			return loadItems(tx, &note)
+		})
+	} else {
+		err = deleteNote(database.DB, &note)
+	}
+
+	if errors.Is(err, errVersionConflict) {
+		database.DB.Where("id = ?", note.ID).First(&note)
+		result.Status = "conflict"
+		result.Error = "Note has been modified since base_version"
+		result.Note = &note
+		return result
+	}
+	if err != nil {
+		return failed("Failed to " + change.Action + " note")
+	}
+
+	if change.Action == "delete" {
+		if note.ImagePath != "" {
+			os.Remove(note.ImagePath)
+		}
+		publishNoteEvent(events.NoteDeleted, &note)
+	} else {
+		publishNoteEvent(events.NoteUpdated, &note)
+		for i := range renamed {
+			publishNoteEvent(events.NoteUpdated, &renamed[i])
+		}
+		result.Note = &note
+	}
+	result.Status = "applied"
+	return result
+}
+
+// foreignNoteID reports whether a note or tombstone of a user other than
+// userID has the ID noteID.
+func foreignNoteID(noteID, userID uuid.UUID) (bool, error) {
+	var notes, tombstones int64
+	if err := database.DB.Model(&models.Note{}).Where("id = ? AND user_id <> ?", noteID, userID).
+		Count(&notes).Error; err != nil {
+		return false, err
+	}
+	if err := database.DB.Model(&models.NoteTombstone{}).Where("note_id = ? AND user_id <> ?", noteID, userID).
+		Count(&tombstones).Error; err != nil {
+		return false, err
+	}
+	return notes+tombstones > 0, nil
+}
+
+// mergeChanges merges notes and deleted, each in change order, and cuts the
+// merged list after limit changes so the token never skips a change. It
+// returns the changes to send, the token they lead up to and whether more
+// changes follow.
+func mergeChanges(notes []models.Note, deleted []models.NoteTombstone, since models.Change, limit int) ([]models.Note, []models.NoteTombstone, models.Change, bool) {
+	changes := make([]models.Change, 0, len(notes)+len(deleted))
+	for i := range notes {
+		changes = append(changes, notes[i].Change())
+	}
+	for i := range deleted {
+		changes = append(changes, deleted[i].Change())
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[j].After(changes[i]) })
+
+	hasMore := len(changes) > limit
+	token := since
+	if hasMore {
+		token = changes[limit-1]
+	} else if len(changes) > 0 {
+		token = changes[len(changes)-1]
+	}
+
+	resultNotes := []models.Note{}
+	for i := range notes {
+		if !notes[i].Change().After(token) {
+			resultNotes = append(resultNotes, notes[i])
+		}
+	}
+	resultDeleted := []models.NoteTombstone{}
+	for i := range deleted {
+		if !deleted[i].Change().After(token) {
+			resultDeleted = append(resultDeleted, deleted[i])
+		}
+	}
+	return resultNotes, resultDeleted, token, hasMore
+}
+
+// Sync tokens are opaque to clients; they wrap the position of the last
+// change seen.
+
+// formatSyncToken encodes the position of a change as a sync token.
+func formatSyncToken(change models.Change) string {
+	raw := "v1:" + strconv.FormatInt(change.XID, 10) + "." + strconv.FormatInt(change.Seq, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseSyncToken decodes a sync token.
+func parseSyncToken(token string) (models.Change, error) {
+	if token == "" {
+		return models.Change{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return models.Change{}, err
+	}
+	value, ok := strings.CutPrefix(string(raw), "v1:")
+	if !ok {
+		return models.Change{}, errors.New("unknown sync token version")
+	}
+	xid, seq, ok := strings.Cut(value, ".")
+	if !ok {
+		return models.Change{}, errors.New("invalid sync token")
+	}
+	var change models.Change
+	if change.XID, err = strconv.ParseInt(xid, 10, 64); err != nil {
+		return models.Change{}, err
+	}
+	if change.Seq, err = strconv.ParseInt(seq, 10, 64); err != nil {
+		return models.Change{}, err
+	}
+	return change, nil
+}
+
+// applySyncState copies the note states a change sets.
+func applySyncState(note *models.Note, change *models.SyncChange) {
+	if change.Pinned != nil {
+		note.Pinned = *change.Pinned
+	}
+	if change.Starred != nil {
+		note.Starred = *change.Starred
+	}
+	if change.Archived != nil {
+		note.Archived = *change.Archived
+	}
+}
+
+// applySyncProperties copies the color, properties and tags a change sets.
+func applySyncProperties(userID uuid.UUID, note *models.Note, change *models.SyncChange) error {
+	if change.Color != nil {
+		if *change.Color != "" && !models.ValidColor(*change.Color) {
+			return errors.New("Color must be one of " + strings.Join(models.Colors, ", "))
+		}
+		note.Color = *change.Color
+	}
+	if change.Properties != nil {
+		if err := validateProperties(database.DB, userID, change.Properties); err != nil {
+			return err
+		}
+		note.Properties = change.Properties
+	}
+	if change.Tags != nil {
+		tags, err := models.NormalizeTags(change.Tags)
+		if err != nil {
+			return err
+		}
+		note.Tags = tags
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"notes-api/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMergeChanges(t *testing.T) {
+	note := func(xid, seq int64) models.Note {
+		return models.Note{ID: uuid.New(), ChangeXID: xid, ChangeSeq: seq}
+	}
+	tombstone := func(xid, seq int64) models.NoteTombstone {
+		return models.NoteTombstone{NoteID: uuid.New(), ChangeXID: xid, ChangeSeq: seq}
+	}
+	// Sequence numbers are drawn before commit, so a later transaction can
+	// hold a lower one
+	notes := []models.Note{note(10, 5), note(12, 1), note(11, 7)}
+	deleted := []models.NoteTombstone{tombstone(10, 6), tombstone(13, 2)}
+	since := models.Change{XID: 9, Seq: 100}
+
+	tests := []struct {
+		name        string
+		limit       int
+		wantNotes   []models.Change
+		wantDeleted []models.Change
+		token       models.Change
+		hasMore     bool
+	}{
+		{
+			name:        "everything",
+			limit:       10,
+			wantNotes:   []models.Change{{XID: 10, Seq: 5}, {XID: 12, Seq: 1}, {XID: 11, Seq: 7}},
+			wantDeleted: []models.Change{{XID: 10, Seq: 6}, {XID: 13, Seq: 2}},
+			token:       models.Change{XID: 13, Seq: 2},
+		},
+		{
+			name:        "exactly the limit",
+			limit:       5,
+			wantNotes:   []models.Change{{XID: 10, Seq: 5}, {XID: 12, Seq: 1}, {XID: 11, Seq: 7}},
+			wantDeleted: []models.Change{{XID: 10, Seq: 6}, {XID: 13, Seq: 2}},
+			token:       models.Change{XID: 13, Seq: 2},
+		},
+		{
+			name:        "cut between a note and a tombstone",
+			limit:       2,
+			wantNotes:   []models.Change{{XID: 10, Seq: 5}},
+			wantDeleted: []models.Change{{XID: 10, Seq: 6}},
+			token:       models.Change{XID: 10, Seq: 6},
+			hasMore:     true,
+		},
+		{
+			name:        "cut in commit order",
+			limit:       3,
+			wantNotes:   []models.Change{{XID: 10, Seq: 5}, {XID: 11, Seq: 7}},
+			wantDeleted: []models.Change{{XID: 10, Seq: 6}},
+			token:       models.Change{XID: 11, Seq: 7},
+			hasMore:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotNotes, gotDeleted, token, hasMore := mergeChanges(notes, deleted, since, tt.limit)
+			if token != tt.token || hasMore != tt.hasMore {
+				t.Errorf("got token %+v, more %v; want %+v, %v", token, hasMore, tt.token, tt.hasMore)
+			}
+			if len(gotNotes) != len(tt.wantNotes) {
+				t.Fatalf("got %d notes, want %d", len(gotNotes), len(tt.wantNotes))
+			}
+			for i := range gotNotes {
+				if gotNotes[i].Change() != tt.wantNotes[i] {
+					t.Errorf("note %d: got %+v, want %+v", i, gotNotes[i].Change(), tt.wantNotes[i])
+				}
+			}
+			if len(gotDeleted) != len(tt.wantDeleted) {
+				t.Fatalf("got %d tombstones, want %d", len(gotDeleted), len(tt.wantDeleted))
+			}
+			for i := range gotDeleted {
+				if gotDeleted[i].Change() != tt.wantDeleted[i] {
+					t.Errorf("tombstone %d: got %+v, want %+v", i, gotDeleted[i].Change(), tt.wantDeleted[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMergeChangesEmpty(t *testing.T) {
+	since := models.Change{XID: 3, Seq: 4}
+	notes, deleted, token, hasMore := mergeChanges(nil, nil, since, 10)
+	if notes == nil || deleted == nil || len(notes)+len(deleted) != 0 {
+		t.Errorf("got %v and %v, want empty lists", notes, deleted)
+	}
+	if token != since || hasMore {
+		t.Errorf("got token %+v, more %v; want %+v", token, hasMore, since)
+	}
+}
+
+func TestSyncToken(t *testing.T) {
+	for _, change := range []models.Change{{}, {XID: 1, Seq: 2}, {XID: 1 << 40, Seq: 987654321}} {
+		got, err := parseSyncToken(formatSyncToken(change))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != change {
+			t.Errorf("round trip of %+v gave %+v", change, got)
+		}
+	}
+
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	tests := []struct {
+		token   string
+		want    models.Change
+		wantErr bool
+	}{
+		{token: "", want: models.Change{}},
+		{token: encode("v1:7.8"), want: models.Change{XID: 7, Seq: 8}},
+		{token: encode("v1:42"), wantErr: true},
+		{token: encode("v1:7"), wantErr: true},
+		{token: encode("v1:a.8"), wantErr: true},
+		{token: encode("v2:1.2"), wantErr: true},
+		{token: "not base64!", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSyncToken(tt.token)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSyncToken(%q): expected an error, got %+v", tt.token, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSyncToken(%q) = %+v, %v; want %+v", tt.token, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/render"
+	"notes-api/templates"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// ListTemplates godoc
+// @Summary List templates
+// @Description Retrieve the system templates and the authenticated user's own templates
+// @Tags Templates
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TemplatesSuccessResponse "List of templates"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/templates [get]
+func ListTemplates(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var list []models.Template
+	if err := database.DB.Where("user_id IS NULL OR user_id = ?", userID).
+		Order("user_id NULLS FIRST, name").Find(&list).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch templates",
+		})
+	}
+
+	return c.JSON(models.TemplatesSuccessResponse{
+		Status:  "success",
+		Message: "Templates retrieved successfully",
+		Data: models.TemplatesData{
+			Templates: list,
+			Count:     len(list),
+		},
+	})
+}
+
+// GetTemplate godoc
+// @Summary Get a template
+// @Description Retrieve a system template or one of the authenticated user's templates
+// @Tags Templates
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.TemplateSuccessResponse "Template details"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Template not found"
+// @Router /api/templates/{id} [get]
+func GetTemplate(c *fiber.Ctx) error {
+	template, err := findTemplate(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Template not found",
+		})
+	}
+
+	return c.JSON(models.TemplateSuccessResponse{
+		Status:  "success",
+		Message: "Template retrieved successfully",
+		Data: models.TemplateData{
+			Template: *template,
+		},
+	})
+}
+
+// CreateTemplate godoc
+// @Summary Create a template
+// @Description Create a note template. Title and content may contain placeholders: {{date}}, {{time}}, {{datetime}}, {{weekday}}, {{year}}, {{user.name}}, {{user.email}}, and custom ones whose values are given when a note is created.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateTemplateRequest true "Template"
+// @Success 201 {object} models.TemplateSuccessResponse "Template created successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/templates [post]
+func CreateTemplate(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req models.CreateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	if req.Format == "" {
+		req.Format = render.FormatPlain
+	}
+	if req.Type == "" {
+		req.Type = models.NoteTypeNote
+	}
+
+	userUUID, _ := uuid.Parse(userID)
+	template := models.Template{
+		UserID:      &userUUID,
+		Name:        req.Name,
+		Description: req.Description,
+		Title:       req.Title,
+		Content:     req.Content,
+		Format:      req.Format,
+		Type:        req.Type,
+	}
+	if msg := validateTemplate(&template); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  msg,
+		})
+	}
+
+	if err := database.DB.Create(&template).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to create template",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.TemplateSuccessResponse{
+		Status:  "success",
+		Message: "Template created successfully",
+		Data: models.TemplateData{
+			Template: template,
+		},
+	})
+}
+
+// UpdateTemplate godoc
+// @Summary Update a template
+// @Description Change one of the authenticated user's templates. Omitted fields are unchanged. System templates cannot be changed.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Template ID"
+// @Param request body models.UpdateTemplateRequest true "Fields to change"
+// @Success 200 {object} models.TemplateSuccessResponse "Template updated successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "System template"
+// @Failure 404 {object} models.ErrorResponse "Template not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/templates/{id} [patch]
+func UpdateTemplate(c *fiber.Ctx) error {
+	template, err := findTemplate(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Template not found",
+		})
+	}
+	if template.System {
+		return c.Status(fiber.StatusForbidden).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "System templates cannot be changed",
+		})
+	}
+
+	var req models.UpdateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	if req.Name != nil {
+		template.Name = *req.Name
+	}
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+	if req.Title != nil {
+		template.Title = *req.Title
+	}
+	if req.Content != nil {
+		template.Content = *req.Content
+	}
+	if req.Format != nil {
+		template.Format = *req.Format
+	}
+	if req.Type != nil {
+		template.Type = *req.Type
+	}
+	if msg := validateTemplate(template); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  msg,
+		})
+	}
+
+	if err := database.DB.Save(template).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to update template",
+		})
+	}
+
+	return c.JSON(models.TemplateSuccessResponse{
+		Status:  "success",
+		Message: "Template updated successfully",
+		Data: models.TemplateData{
+			Template: *template,
+		},
+	})
+}
+
+// DeleteTemplate godoc
+// @Summary Delete a template
+// @Description Delete one of the authenticated user's templates. Notes created from it are not affected. System templates cannot be deleted.
+// @Tags Templates
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Template ID"
+// @Success 200 {object} models.MessageSuccessResponse "Template deleted successfully"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 403 {object} models.ErrorResponse "System template"
+// @Failure 404 {object} models.ErrorResponse "Template not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/templates/{id} [delete]
+func DeleteTemplate(c *fiber.Ctx) error {
+	template, err := findTemplate(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Template not found",
+		})
+	}
+	if template.System {
+		return c.Status(fiber.StatusForbidden).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "System templates cannot be deleted",
+		})
+	}
+
+	if err := database.DB.Delete(template).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to delete template",
+		})
+	}
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Template deleted successfully",
+		Data: models.MessageData{
+			Message: "Template deleted successfully",
+		},
+	})
+}
+
+// CreateNoteFromTemplate godoc
+// @Summary Create a note from a template
+// @Description Create a note from a template, expanding its placeholders. Date and time placeholders use the given timezone (default UTC); custom placeholders take their values from variables, and placeholders without a value are kept as written. Task lines in checklist templates become items.
+// @Tags Templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Template ID"
+// @Param request body models.NoteFromTemplateRequest false "Placeholder values"
+// @Success 201 {object} models.NoteSuccessResponse "Note created successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Template not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/templates/{id}/notes [post]
+func CreateNoteFromTemplate(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	template, err := findTemplate(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Template not found",
+		})
+	}
+
+	var req models.NoteFromTemplateRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Invalid request body",
+			})
+		}
+	}
+
+	loc := time.UTC
+	if req.Timezone != "" {
+		if loc, err = time.LoadLocation(req.Timezone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  "Unknown timezone",
+			})
+		}
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to load user",
+		})
+	}
+
+	vars := templates.Variables(&user, time.Now().In(loc))
+	for name, value := range req.Variables {
+		vars[name] = value
+	}
+
+	title := req.Title
+	if title == "" {
+		title = template.Title
+	}
+	title = strings.TrimSpace(templates.Expand(title, vars))
+	if title == "" {
+		title = template.Name
+	}
+
+	note := models.Note{
+		Title:   title,
+		Content: templates.Expand(template.Content, vars),
+		Format:  template.Format,
+		Type:    template.Type,
+		UserID:  user.ID,
+	}
+	if note.Type == models.NoteTypeChecklist {
+		note.Content, note.Items = splitTaskLines(note.Content, 0)
+	}
+
+	if err := createNote(database.DB, &note); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to create note",
+		})
+	}
+
+	publishNoteEvent(events.NoteCreated, &note)
+
+	c.Set(fiber.HeaderETag, noteETag(&note))
+
+	return c.Status(fiber.StatusCreated).JSON(models.NoteSuccessResponse{
+		Status:  "success",
+		Message: "Note created successfully",
+		Data: models.NoteData{
+			Note: note,
+		},
+	})
+}
+
+// findTemplate loads the template in :id if it is a system template or
+// belongs to the authenticated user.
+func findTemplate(c *fiber.Ctx) (*models.Template, error) {
+	userID := middleware.GetUserID(c)
+
+	var template models.Template
+	if err := database.DB.Where("id = ? AND (user_id IS NULL OR user_id = ?)", c.Params("id"), userID).
+		First(&template).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func validateTemplate(template *models.Template) string {
+	switch {
+	case strings.TrimSpace(template.Name) == "":
+		return "Name is required"
+	case !render.ValidFormat(template.Format):
+		return "Format must be plain or markdown"
+	case !models.ValidNoteType(template.Type):
+		return "Type must be note or checklist"
+	}
+	return ""
+}
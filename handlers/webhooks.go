@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"encoding/json"
+	"notes-api/database"
+	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/webhooks"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const maxDeliveriesListed = 100
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Description Retrieve the webhook subscriptions of the authenticated user
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.WebhooksSuccessResponse "List of webhooks"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/webhooks [get]
+func ListWebhooks(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var hooks []models.Webhook
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&hooks).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch webhooks",
+		})
+	}
+
+	return c.JSON(models.WebhooksSuccessResponse{
+		Status:  "success",
+		Message: "Webhooks retrieved successfully",
+		Data: models.WebhooksData{
+			Webhooks: hooks,
+			Count:    len(hooks),
+		},
+	})
+}
+
+// CreateWebhook godoc
+// @Summary Create a webhook
+// @Description Subscribe a URL to note events (note.created, note.updated, note.deleted, reminder.due or * for all). Each delivery is a POST of the event as JSON, signed in the X-Webhook-Signature header as sha256=HMAC-SHA256(secret, "<X-Webhook-Timestamp>.<body>"). A secret is generated when none is given; it is only returned in this response.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateWebhookRequest true "Webhook subscription"
+// @Success 201 {object} models.WebhookSuccessResponse "Webhook created successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/webhooks [post]
+func CreateWebhook(c *fiber.Ctx) error {
+	userID := middleware.GetUserID(c)
+
+	var req models.CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+	if err := webhooks.ValidateURL(req.URL); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+	if err := webhooks.ValidateEvents(req.Events); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  err.Error(),
+		})
+	}
+	if req.Secret == "" {
+		req.Secret = webhooks.GenerateSecret()
+	}
+
+	userUUID, _ := uuid.Parse(userID)
+	webhook := models.Webhook{
+		UserID: userUUID,
+		URL:    req.URL,
+		Events: req.Events,
+		Secret: req.Secret,
+		Active: true,
+	}
+	if err := database.DB.Create(&webhook).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to create webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.WebhookSuccessResponse{
+		Status:  "success",
+		Message: "Webhook created successfully",
+		Data: models.WebhookData{
+			Webhook: webhook,
+			Secret:  webhook.Secret,
+		},
+	})
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook
+// @Description Retrieve a webhook subscription by ID
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.WebhookSuccessResponse "Webhook details"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Webhook not found"
+// @Router /api/webhooks/{id} [get]
+func GetWebhook(c *fiber.Ctx) error {
+	webhook, err := findWebhook(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Webhook not found",
+		})
+	}
+
+	return c.JSON(models.WebhookSuccessResponse{
+		Status:  "success",
+		Message: "Webhook retrieved successfully",
+		Data: models.WebhookData{
+			Webhook: *webhook,
+		},
+	})
+}
+
+// UpdateWebhook godoc
+// @Summary Update a webhook
+// @Description Change a webhook's URL, event types, secret or active flag. Omitted fields are left unchanged.
+// @Tags Webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Param request body models.UpdateWebhookRequest true "Fields to change"
+// @Success 200 {object} models.WebhookSuccessResponse "Webhook updated successfully"
+// @Failure 400 {object} models.ErrorResponse "Invalid request body"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Webhook not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/webhooks/{id} [patch]
+func UpdateWebhook(c *fiber.Ctx) error {
+	webhook, err := findWebhook(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Webhook not found",
+		})
+	}
+
+	var req models.UpdateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Invalid request body",
+		})
+	}
+
+	if req.URL != nil {
+		if err := webhooks.ValidateURL(*req.URL); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  err.Error(),
+			})
+		}
+		webhook.URL = *req.URL
+	}
+	if req.Events != nil {
+		if err := webhooks.ValidateEvents(*req.Events); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(models.ErrorResponse{
+				Status: "error",
+				Error:  err.Error(),
+			})
+		}
+		webhook.Events = *req.Events
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	secret := ""
+	if req.Secret != nil {
+		secret = *req.Secret
+		if secret == "" {
+			secret = webhooks.GenerateSecret()
+		}
+		webhook.Secret = secret
+	}
+
+	if err := database.DB.Save(webhook).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to update webhook",
+		})
+	}
+
+	return c.JSON(models.WebhookSuccessResponse{
+		Status:  "success",
+		Message: "Webhook updated successfully",
+		Data: models.WebhookData{
+			Webhook: *webhook,
+			Secret:  secret,
+		},
+	})
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Delete a webhook subscription and its delivery log
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} models.MessageSuccessResponse "Webhook deleted successfully"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Webhook not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/webhooks/{id} [delete]
+func DeleteWebhook(c *fiber.Ctx) error {
+	webhook, err := findWebhook(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Webhook not found",
+		})
+	}
+
+	if err := database.DB.Where("webhook_id = ?", webhook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to delete webhook",
+		})
+	}
+	if err := database.DB.Delete(webhook).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to delete webhook",
+		})
+	}
+
+	return c.JSON(models.MessageSuccessResponse{
+		Status:  "success",
+		Message: "Webhook deleted successfully",
+		Data: models.MessageData{
+			Message: "Webhook deleted successfully",
+		},
+	})
+}
+
+// ListWebhookDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Retrieve the most recent deliveries of a webhook with their status, attempt count and last response
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Param status query string false "Only deliveries in this state (pending, succeeded, failed)"
+// @Success 200 {object} models.WebhookDeliveriesSuccessResponse "Delivery log"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Webhook not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/webhooks/{id}/deliveries [get]
+func ListWebhookDeliveries(c *fiber.Ctx) error {
+	webhook, err := findWebhook(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Webhook not found",
+		})
+	}
+
+	query := database.DB.Where("webhook_id = ?", webhook.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at DESC").Limit(maxDeliveriesListed).Find(&deliveries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to fetch deliveries",
+		})
+	}
+
+	return c.JSON(models.WebhookDeliveriesSuccessResponse{
+		Status:  "success",
+		Message: "Deliveries retrieved successfully",
+		Data: models.WebhookDeliveriesData{
+			Deliveries: deliveries,
+			Count:      len(deliveries),
+		},
+	})
+}
+
+// RedeliverWebhook godoc
+// @Summary Redeliver a webhook delivery
+// @Description Queue a new delivery with the same payload as an earlier one, keeping the original in the log
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Param deliveryId path string true "Delivery ID"
+// @Success 202 {object} models.WebhookDeliverySuccessResponse "Delivery queued"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Delivery not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/webhooks/{id}/deliveries/{deliveryId}/redeliver [post]
+func RedeliverWebhook(c *fiber.Ctx) error {
+	webhook, err := findWebhook(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Webhook not found",
+		})
+	}
+
+	var original models.WebhookDelivery
+	if err := database.DB.Where("id = ? AND webhook_id = ?", c.Params("deliveryId"), webhook.ID).First(&original).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Delivery not found",
+		})
+	}
+
+	delivery, err := webhooks.Enqueue(database.DB, webhook.ID, original.EventType, original.Payload)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to queue delivery",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(models.WebhookDeliverySuccessResponse{
+		Status:  "success",
+		Message: "Delivery queued",
+		Data: models.WebhookDeliveryData{
+			Delivery: *delivery,
+		},
+	})
+}
+
+// TestWebhook godoc
+// @Summary Send a test delivery
+// @Description Queue a "ping" event to the webhook, for checking a receiver (including one on localhost) without changing any note
+// @Tags Webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Success 202 {object} models.WebhookDeliverySuccessResponse "Delivery queued"
+// @Failure 401 {object} models.ErrorResponse "Unauthorized"
+// @Failure 404 {object} models.ErrorResponse "Webhook not found"
+// @Failure 500 {object} models.ErrorResponse "Internal server error"
+// @Router /api/webhooks/{id}/test [post]
+func TestWebhook(c *fiber.Ctx) error {
+	webhook, err := findWebhook(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Webhook not found",
+		})
+	}
+
+	payload, _ := json.Marshal(fiber.Map{
+		"type":       webhooks.Ping,
+		"webhook_id": webhook.ID,
+		"created_at": time.Now(),
+	})
+	delivery, err := webhooks.Enqueue(database.DB, webhook.ID, webhooks.Ping, payload)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(models.ErrorResponse{
+			Status: "error",
+			Error:  "Failed to queue delivery",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(models.WebhookDeliverySuccessResponse{
+		Status:  "success",
+		Message: "Delivery queued",
+		Data: models.WebhookDeliveryData{
+			Delivery: *delivery,
+		},
+	})
+}
+
+// findWebhook loads the webhook in the :id parameter if it belongs to the
+// authenticated user.
+func findWebhook(c *fiber.Ctx) (*models.Webhook, error) {
+	userID := middleware.GetUserID(c)
+
+	var webhook models.Webhook
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
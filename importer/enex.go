@@ -0,0 +1,353 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const enexTimeLayout = "20060102T150405Z"
+
+// enexNote is a <note> of an Evernote export.
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data struct {
+		Encoding string `xml:"encoding,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"data"`
+	Mime       string `xml:"mime"`
+	Attributes struct {
+		FileName string `xml:"file-name"`
+	} `xml:"resource-attributes"`
+}
+
+func parseENEX(r io.Reader) ([]Note, error) {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	var notes []Note
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ENEX file: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+		if len(notes) == MaxNotes {
+			return nil, fmt.Errorf("Import has more than %d notes", MaxNotes)
+		}
+
+		source := fmt.Sprintf("note %d", len(notes)+1)
+		var en enexNote
+		if err := dec.DecodeElement(&en, &start); err != nil {
+			return nil, fmt.Errorf("Invalid ENEX file at %s: %v", source, err)
+		}
+		if title := strings.TrimSpace(en.Title); title != "" {
+			source += fmt.Sprintf(" (%s)", title)
+		}
+		notes = append(notes, readENEX(source, &en))
+	}
+	return notes, nil
+}
+
+func readENEX(source string, en *enexNote) Note {
+	note := Note{
+		Source: source,
+		Title:  strings.TrimSpace(en.Title),
+		Format: "markdown",
+		Tags:   en.Tags,
+	}
+	if note.Title == "" {
+		note.Title = "Untitled"
+	}
+	note.Created, _ = time.Parse(enexTimeLayout, strings.TrimSpace(en.Created))
+	note.Updated, _ = time.Parse(enexTimeLayout, strings.TrimSpace(en.Updated))
+
+	// Resources are referenced from the content by the MD5 hash of their data
+	resources := map[string]*Attachment{}
+	for i, res := range en.Resources {
+		name := strings.TrimSpace(res.Attributes.FileName)
+		if name == "" {
+			name = fmt.Sprintf("attachment %d", i+1)
+		}
+		if !strings.EqualFold(strings.TrimSpace(res.Data.Encoding), "base64") {
+			note.Warnings = append(note.Warnings, fmt.Sprintf("Attachment %s has an unsupported encoding", name))
+			continue
+		}
+		if base64.StdEncoding.DecodedLen(len(res.Data.Value)) > MaxFileSize*2 {
+			note.Warnings = append(note.Warnings, fmt.Sprintf("Attachment %s is larger than %d MB", name, MaxFileSize>>20))
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(stripSpace(res.Data.Value))
+		if err != nil || len(data) > MaxFileSize {
+			note.Warnings = append(note.Warnings, fmt.Sprintf("Attachment %s could not be read", name))
+			continue
+		}
+		sum := md5.Sum(data)
+		resources[hex.EncodeToString(sum[:])] = &Attachment{Name: name, MimeType: strings.TrimSpace(res.Mime), Data: data}
+	}
+
+	content, err := enmlToMarkdown(en.Content, func(hash string) {
+		attachment, ok := resources[hash]
+		if !ok {
+			return
+		}
+		delete(resources, hash)
+		if note.Image == nil && isImageType(attachment.MimeType) {
+			note.Image = attachment
+			return
+		}
+		note.Warnings = append(note.Warnings, fmt.Sprintf("Attachment %s was not imported; a note can only have one JPEG, PNG or GIF image", attachment.Name))
+	})
+	if err != nil {
+		note.Err = fmt.Errorf("Invalid note content: %v", err)
+		return note
+	}
+	note.Content = content
+	for _, attachment := range resources {
+		note.Warnings = append(note.Warnings, fmt.Sprintf("Attachment %s is not referenced by the note and was not imported", attachment.Name))
+	}
+	return note
+}
+
+func isImageType(mimeType string) bool {
+	for _, t := range imageTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+func stripSpace(s string) string {
+	return whitespace.ReplaceAllString(s, "")
+}
+
+// enmlToMarkdown converts the ENML (Evernote's XHTML dialect) of a note to
+// Markdown. media is called with the hash of every embedded resource.
+func enmlToMarkdown(enml string, media func(hash string)) (string, error) {
+	doc, err := html.Parse(strings.NewReader(enml))
+	if err != nil {
+		return "", err
+	}
+	w := &enmlWriter{media: media}
+	w.walk(doc)
+	return w.String(), nil
+}
+
+type enmlWriter struct {
+	b      strings.Builder
+	media  func(hash string)
+	lists  []atom.Atom
+	pre    int
+	prefix string
+}
+
+func (w *enmlWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	out := strings.Join(lines, "\n")
+	for strings.Contains(out, "\n\n\n") {
+		out = strings.ReplaceAll(out, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(out)
+}
+
+// atLineStart reports whether nothing has been written on the current line.
+func (w *enmlWriter) atLineStart() bool {
+	s := w.b.String()
+	return s == "" || s == w.prefix || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, "\n"+w.prefix)
+}
+
+// breakLines ends the current line and makes sure n line breaks precede
+// what comes next.
+func (w *enmlWriter) breakLines(n int) {
+	s := w.b.String()
+	if s == "" {
+		return
+	}
+	have := len(s) - len(strings.TrimRight(s, "\n"))
+	for ; have < n; have++ {
+		w.b.WriteString("\n")
+	}
+}
+
+func (w *enmlWriter) text(s string) {
+	if w.pre == 0 {
+		s = whitespace.ReplaceAllString(s, " ")
+		if w.atLineStart() {
+			s = strings.TrimLeft(s, " ")
+		}
+	}
+	if s == "" {
+		return
+	}
+	if b := w.b.String(); (b == "" || strings.HasSuffix(b, "\n")) && w.prefix != "" {
+		w.b.WriteString(w.prefix)
+	}
+	w.b.WriteString(s)
+}
+
+func (w *enmlWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+// wrap writes the children of n between two markers, e.g. ** for bold.
+func (w *enmlWriter) wrap(n *html.Node, marker string) {
+	w.text(marker)
+	w.children(n)
+	w.text(marker)
+}
+
+func (w *enmlWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+
+	// The HTML parser does not close self-closing en-media and en-todo
+	// tags, so whatever follows them ends up as their children
+	switch n.Data {
+	case "en-media":
+		w.media(attr(n, "hash"))
+		w.children(n)
+	case "en-todo":
+		marker := "[ ] "
+		if attr(n, "checked") == "true" {
+			marker = "[x] "
+		}
+		if w.atLineStart() && len(w.lists) == 0 {
+			marker = "- " + marker
+		}
+		w.text(marker)
+		w.children(n)
+	case "br":
+		w.b.WriteString("\n")
+	case "hr":
+		w.breakLines(2)
+		w.text("---")
+		w.breakLines(2)
+	case "p", "blockquote", "table":
+		w.breakLines(2)
+		if n.DataAtom == atom.Blockquote {
+			w.prefix += "> "
+			w.children(n)
+			w.prefix = strings.TrimSuffix(w.prefix, "> ")
+		} else {
+			w.children(n)
+		}
+		w.breakLines(2)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.breakLines(2)
+		w.text(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+		w.children(n)
+		w.breakLines(2)
+	case "div", "tr":
+		w.breakLines(1)
+		w.children(n)
+		w.breakLines(1)
+	case "td", "th":
+		if !w.atLineStart() {
+			w.text(" | ")
+		}
+		w.children(n)
+	case "ul", "ol":
+		w.breakLines(1)
+		w.lists = append(w.lists, n.DataAtom)
+		w.children(n)
+		w.lists = w.lists[:len(w.lists)-1]
+		w.breakLines(1)
+	case "li":
+		w.breakLines(1)
+		marker := "- "
+		if len(w.lists) > 0 && w.lists[len(w.lists)-1] == atom.Ol {
+			marker = "1. "
+		}
+		if len(w.lists) > 1 {
+			marker = strings.Repeat("  ", len(w.lists)-1) + marker
+		}
+		w.b.WriteString(w.prefix + marker)
+		w.children(n)
+		w.breakLines(1)
+	case "pre":
+		w.breakLines(2)
+		w.pre++
+		w.text("```\n")
+		w.children(n)
+		w.breakLines(1)
+		w.text("```")
+		w.pre--
+		w.breakLines(2)
+	case "b", "strong":
+		w.wrap(n, "**")
+	case "i", "em":
+		w.wrap(n, "*")
+	case "s", "strike", "del":
+		w.wrap(n, "~~")
+	case "code":
+		if w.pre > 0 {
+			w.children(n)
+		} else {
+			w.wrap(n, "`")
+		}
+	case "a":
+		href := attr(n, "href")
+		if href == "" {
+			w.children(n)
+			return
+		}
+		w.text("[")
+		w.children(n)
+		w.text("](" + href + ")")
+	case "img":
+		if src := attr(n, "src"); src != "" {
+			w.text("![" + attr(n, "alt") + "](" + src + ")")
+		}
+	case "head", "script", "style":
+	default:
+		w.children(n)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestENMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		enml string
+		want string
+	}{
+		{
+			name: "paragraphs and emphasis",
+			enml: `<en-note><p>Hello <b>bold</b> and <i>italic</i></p><p>Second   line</p></en-note>`,
+			want: "Hello **bold** and *italic*\n\nSecond line",
+		},
+		{
+			name: "headings and rules",
+			enml: `<en-note><h2>Title</h2><div>text</div><hr/><div>after</div></en-note>`,
+			want: "## Title\n\ntext\n\n---\n\nafter",
+		},
+		{
+			name: "lists",
+			enml: `<en-note><ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul></en-note>`,
+			want: "- one\n- two\n  1. nested",
+		},
+		{
+			name: "todos",
+			enml: `<en-note><div><en-todo checked="true"/>done</div><div><en-todo/>open</div></en-note>`,
+			want: "- [x] done\n- [ ] open",
+		},
+		{
+			name: "links and code",
+			enml: `<en-note><div><a href="https://example.com">site</a> and <code>x := 1</code></div><pre>a  b
+c</pre></en-note>`,
+			want: "[site](https://example.com) and `x := 1`\n\n```\na  b\nc\n```",
+		},
+		{
+			name: "blockquote",
+			enml: `<en-note><blockquote><div>quoted</div><div>twice</div></blockquote><div>after</div></en-note>`,
+			want: "> quoted\n> twice\n\nafter",
+		},
+		{
+			name: "line breaks",
+			enml: `<en-note><div>a<br/>b</div></en-note>`,
+			want: "a\nb",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enmlToMarkdown(tt.enml, func(string) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func enexResourceXML(name, mime string, data []byte) string {
+	return fmt.Sprintf(`<resource><data encoding="base64">%s</data><mime>%s</mime>`+
+		`<resource-attributes><file-name>%s</file-name></resource-attributes></resource>`,
+		base64.StdEncoding.EncodeToString(data), mime, name)
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseENEX(t *testing.T) {
+	photo, doc, unused := []byte("photo"), []byte("document"), []byte("unused")
+	content := fmt.Sprintf(`<![CDATA[<?xml version="1.0"?><en-note><div>Look:</div>`+
+		`<en-media type="image/png" hash="%s"/><en-media type="application/pdf" hash="%s"/></en-note>]]>`,
+		md5Hex(photo), md5Hex(doc))
+	enex := `<?xml version="1.0" encoding="UTF-8"?>
+<en-export>
+<note>
+  <title> Trip </title>
+  <content>` + content + `</content>
+  <created>20210102T030405Z</created>
+  <updated>20210203T040506Z</updated>
+  <tag>travel</tag><tag>photos</tag>
+  ` + enexResourceXML("photo.png", "image/png", photo) +
+		enexResourceXML("doc.pdf", "application/pdf", doc) +
+		enexResourceXML("unused.png", "image/png", unused) + `
+</note>
+<note><title></title><content><![CDATA[<en-note>plain &amp; simple&nbsp;</en-note>]]></content></note>
+</en-export>`
+
+	notes, err := parseENEX(strings.NewReader(enex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("got %d notes, want 2", len(notes))
+	}
+
+	trip := notes[0]
+	if trip.Source != "note 1 (Trip)" || trip.Title != "Trip" || trip.Format != "markdown" {
+		t.Errorf("got source %q, title %q, format %q", trip.Source, trip.Title, trip.Format)
+	}
+	if trip.Content != "Look:" {
+		t.Errorf("got content %q", trip.Content)
+	}
+	if want := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC); !trip.Created.Equal(want) {
+		t.Errorf("got created %s, want %s", trip.Created, want)
+	}
+	if want := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC); !trip.Updated.Equal(want) {
+		t.Errorf("got updated %s, want %s", trip.Updated, want)
+	}
+	if strings.Join(trip.Tags, ",") != "travel,photos" {
+		t.Errorf("got tags %q", trip.Tags)
+	}
+	if trip.Image == nil || trip.Image.Name != "photo.png" || string(trip.Image.Data) != "photo" {
+		t.Errorf("got image %+v", trip.Image)
+	}
+	// The PDF cannot be imported and unused.png is never referenced
+	if len(trip.Warnings) != 2 {
+		t.Errorf("got warnings %q, want 2", trip.Warnings)
+	}
+
+	untitled := notes[1]
+	if untitled.Title != "Untitled" || untitled.Content != "plain & simple" || untitled.Err != nil {
+		t.Errorf("got %+v", untitled)
+	}
+}
+
+func TestParseENEXInvalid(t *testing.T) {
+	if _, err := parseENEX(strings.NewReader(`<en-export><note><title>x</title`)); err == nil {
+		t.Error("expected an error for a truncated export")
+	}
+}
+
+func TestENEXBadResource(t *testing.T) {
+	enex := `<en-export><note><title>x</title><content><![CDATA[<en-note/>]]></content>` +
+		`<resource><data encoding="hex">00</data><mime>image/png</mime></resource>` +
+		`<resource><data encoding="base64">!!!</data><mime>image/png</mime></resource></note></en-export>`
+	notes, err := parseENEX(strings.NewReader(enex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || len(notes[0].Warnings) != 2 || notes[0].Image != nil {
+		t.Errorf("got %+v", notes)
+	}
+}
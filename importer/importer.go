@@ -0,0 +1,235 @@
+// Package importer reads notes exported by other applications: folders of
+// Markdown files, Evernote .enex exports and Google Keep Takeout archives.
+// It only parses; creating the notes is up to the caller.
+package importer
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sources
+const (
+	SourceMarkdown = "markdown"
+	SourceENEX     = "enex"
+	SourceKeep     = "keep"
+)
+
+const (
+	// MaxFileSize is the largest file read from an archive.
+	MaxFileSize = 20 << 20
+	// MaxTotalSize is the most an archive may hold once decompressed.
+	MaxTotalSize = 200 << 20
+	// MaxNotes is the most notes read from one import.
+	MaxNotes = 5000
+	// MaxFiles is the most files an archive may contain.
+	MaxFiles = 20000
+)
+
+// Note is a note read from an export, not yet validated.
+type Note struct {
+	// Source identifies the note in the export, e.g. its file name
+	Source   string
+	Title    string
+	Content  string
+	Format   string
+	Type     string
+	Tags     []string
+	Pinned   bool
+	Starred  bool
+	Archived bool
+	Color    string
+	Items    []Item
+	Created  time.Time
+	Updated  time.Time
+	Image    *Attachment
+	// Warnings are problems that did not stop the note from being read
+	Warnings []string
+	// Err is set when the note could not be read
+	Err error
+}
+
+// Item is a checklist item.
+type Item struct {
+	Text    string
+	Checked bool
+}
+
+// Attachment is a file attached to a note.
+type Attachment struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+// ValidSource reports whether source is a known import source.
+func ValidSource(source string) bool {
+	return source == SourceMarkdown || source == SourceENEX || source == SourceKeep
+}
+
+// Detect guesses the source of the export in the file at name.
+func Detect(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+	case bytes.Contains(head, []byte("<en-export")):
+		return SourceENEX, nil
+	default:
+		return "", errors.New("Unrecognized file; upload a ZIP archive or an .enex file")
+	}
+
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return "", errors.New("Invalid ZIP archive")
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if isKeepNote(f.Name) {
+			return SourceKeep, nil
+		}
+	}
+	return SourceMarkdown, nil
+}
+
+// Parse reads the notes of an export from the file at name.
+func Parse(source, name string) ([]Note, error) {
+	switch source {
+	case SourceENEX:
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseENEX(bufio.NewReader(f))
+	case SourceMarkdown, SourceKeep:
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, errors.New("Invalid ZIP archive")
+		}
+		defer zr.Close()
+		if len(zr.File) > MaxFiles {
+			return nil, fmt.Errorf("Archive has more than %d files", MaxFiles)
+		}
+		files := &archive{files: make(map[string]*zip.File, len(zr.File))}
+		var size uint64
+		for _, f := range zr.File {
+			files.files[path.Clean(f.Name)] = f
+			size += f.UncompressedSize64
+		}
+		if size > MaxTotalSize {
+			return nil, errArchiveTooLarge
+		}
+		if source == SourceKeep {
+			return parseKeep(files)
+		}
+		return parseMarkdown(files)
+	}
+	return nil, fmt.Errorf("Unknown source %q", source)
+}
+
+// errArchiveTooLarge stops an import whose archive holds more than
+// MaxTotalSize.
+var errArchiveTooLarge = fmt.Errorf("Archive is larger than %d MB once decompressed", MaxTotalSize>>20)
+
+// archive indexes the files of a ZIP archive by their cleaned path, and
+// counts how much has been read from it. The sizes in the archive's
+// directory are checked up front, but they are written by whoever made the
+// archive, so what is actually decompressed is counted too.
+type archive struct {
+	files map[string]*zip.File
+	read  int64
+}
+
+// file returns the file at name in the archive.
+func (a *archive) file(name string) (*zip.File, bool) {
+	f, ok := a.files[path.Clean(name)]
+	return f, ok
+}
+
+// readFile returns the contents of a file in the archive, refusing files
+// that are too large once decompressed. Once more than MaxTotalSize has been
+// read it fails with errArchiveTooLarge.
+func (a *archive) readFile(name string) ([]byte, error) {
+	f, ok := a.file(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is missing from the archive", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	limit := min(int64(MaxFileSize), MaxTotalSize-a.read)
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	a.read += int64(len(data))
+	if err != nil {
+		return nil, err
+	}
+	if a.read > MaxTotalSize {
+		return nil, errArchiveTooLarge
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", name, MaxFileSize>>20)
+	}
+	return data, nil
+}
+
+// names returns the paths of the files in the archive, sorted.
+func (a *archive) names() []string {
+	names := make([]string, 0, len(a.files))
+	for name, f := range a.files {
+		if !f.FileInfo().IsDir() && !hidden(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hidden reports whether a path is metadata added by the archiver, such as
+// __MACOSX folders and dot files.
+func hidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// imageTypes maps the image extensions notes can carry to their MIME type.
+var imageTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+}
+
+// imageType returns the MIME type of an image file name, or "" if notes
+// cannot carry it.
+func imageType(name string) string {
+	return imageTypes[strings.ToLower(path.Ext(name))]
+}
+
+// baseName returns the file name of p without its extension.
+func baseName(p string) string {
+	name := path.Base(p)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
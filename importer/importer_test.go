@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeZip writes an archive holding files to a temporary file and returns
+// its path.
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for path, content := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Deflate, Modified: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// parse reads the notes of an export, keyed by source.
+func parse(t *testing.T, source, name string) map[string]Note {
+	t.Helper()
+	notes, err := Parse(source, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bySource := make(map[string]Note, len(notes))
+	for _, note := range notes {
+		bySource[note.Source] = note
+	}
+	return bySource
+}
+
+func TestDetect(t *testing.T) {
+	enex := filepath.Join(t.TempDir(), "export.enex")
+	if err := os.WriteFile(enex, []byte(`<?xml version="1.0"?><en-export></en-export>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(other, []byte("just text"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "enex", file: enex, want: SourceENEX},
+		{name: "keep", file: writeZip(t, map[string]string{"Takeout/Keep/Note.json": "{}"}), want: SourceKeep},
+		{name: "markdown", file: writeZip(t, map[string]string{"notes/a.md": "# A"}), want: SourceMarkdown},
+		{name: "unknown", file: other, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(tt.file)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHidden(t *testing.T) {
+	tests := map[string]bool{
+		"notes/a.md":            false,
+		".DS_Store":             true,
+		"notes/.hidden/a.md":    true,
+		"__MACOSX/notes/._a.md": true,
+		"notes/a.with.dots.md":  false,
+	}
+	for name, want := range tests {
+		if got := hidden(name); got != want {
+			t.Errorf("hidden(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
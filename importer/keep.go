@@ -0,0 +1,156 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// keepNote is a note in a Google Keep Takeout archive, stored as
+// Takeout/Keep/<title>.json.
+type keepNote struct {
+	Title                   string `json:"title"`
+	TextContent             string `json:"textContent"`
+	Color                   string `json:"color"`
+	IsTrashed               bool   `json:"isTrashed"`
+	IsPinned                bool   `json:"isPinned"`
+	IsArchived              bool   `json:"isArchived"`
+	CreatedTimestampUsec    int64  `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64  `json:"userEditedTimestampUsec"`
+	Labels                  []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Attachments []struct {
+		FilePath string `json:"filePath"`
+		MimeType string `json:"mimetype"`
+	} `json:"attachments"`
+}
+
+// keepColors maps Keep's colors to color labels.
+var keepColors = map[string]string{
+	"RED":      "red",
+	"ORANGE":   "orange",
+	"YELLOW":   "yellow",
+	"GREEN":    "green",
+	"TEAL":     "teal",
+	"BLUE":     "blue",
+	"CERULEAN": "blue",
+	"PURPLE":   "purple",
+	"PINK":     "pink",
+	"BROWN":    "brown",
+	"GRAY":     "gray",
+}
+
+func isKeepNote(name string) bool {
+	name = path.Clean(name)
+	return strings.EqualFold(path.Ext(name), ".json") &&
+		strings.EqualFold(path.Base(path.Dir(name)), "Keep")
+}
+
+func parseKeep(files *archive) ([]Note, error) {
+	var notes []Note
+	for _, name := range files.names() {
+		if !isKeepNote(name) {
+			continue
+		}
+		data, err := files.readFile(name)
+		if errors.Is(err, errArchiveTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			notes = append(notes, Note{Source: name, Err: err})
+			continue
+		}
+		var keep keepNote
+		if err := json.Unmarshal(data, &keep); err != nil {
+			notes = append(notes, Note{Source: name, Err: fmt.Errorf("Invalid Keep note: %v", err)})
+			continue
+		}
+		// Notes in the trash are left behind
+		if keep.IsTrashed {
+			continue
+		}
+		if len(notes) == MaxNotes {
+			return nil, fmt.Errorf("Import has more than %d notes", MaxNotes)
+		}
+		notes = append(notes, readKeep(name, &keep, files))
+	}
+	return notes, nil
+}
+
+func readKeep(name string, keep *keepNote, files *archive) Note {
+	note := Note{
+		Source:   name,
+		Title:    strings.TrimSpace(keep.Title),
+		Content:  keep.TextContent,
+		Format:   "plain",
+		Pinned:   keep.IsPinned,
+		Archived: keep.IsArchived,
+		Color:    keepColors[keep.Color],
+		Created:  usec(keep.CreatedTimestampUsec),
+		Updated:  usec(keep.UserEditedTimestampUsec),
+	}
+	if note.Title == "" {
+		note.Title = firstLine(keep.TextContent)
+	}
+	if note.Title == "" && len(keep.ListContent) > 0 {
+		note.Title = firstLine(keep.ListContent[0].Text)
+	}
+	if note.Title == "" {
+		note.Title = "Untitled"
+	}
+	for _, label := range keep.Labels {
+		note.Tags = append(note.Tags, label.Name)
+	}
+	if len(keep.ListContent) > 0 {
+		note.Type = "checklist"
+		for _, item := range keep.ListContent {
+			note.Items = append(note.Items, Item{Text: item.Text, Checked: item.IsChecked})
+		}
+	}
+
+	dir := path.Dir(name)
+	for _, attachment := range keep.Attachments {
+		file := path.Join(dir, attachment.FilePath)
+		mimeType := imageType(file)
+		if note.Image != nil || mimeType == "" {
+			note.Warnings = append(note.Warnings, fmt.Sprintf("Attachment %s was not imported; a note can only have one JPEG, PNG or GIF image", attachment.FilePath))
+			continue
+		}
+		data, err := files.readFile(file)
+		if err != nil {
+			note.Warnings = append(note.Warnings, err.Error())
+			continue
+		}
+		note.Image = &Attachment{Name: path.Base(file), MimeType: mimeType, Data: data}
+	}
+	return note
+}
+
+// usec converts a Keep timestamp in microseconds since the epoch.
+func usec(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(t).UTC()
+}
+
+// firstLine returns the first non-empty line of s, shortened for a title.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if runes := []rune(line); len(runes) > 80 {
+				line = string(runes[:80]) + "…"
+			}
+			return line
+		}
+	}
+	return ""
+}
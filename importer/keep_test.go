@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKeep(t *testing.T) {
+	name := writeZip(t, map[string]string{
+		"Takeout/Keep/Shopping.json": `{
+			"title": "Shopping", "color": "CERULEAN", "isPinned": true,
+			"createdTimestampUsec": 1600000000000000, "userEditedTimestampUsec": 1600000001000000,
+			"labels": [{"name": "home"}],
+			"listContent": [{"text": "Milk", "isChecked": true}, {"text": "Bread"}]
+		}`,
+		"Takeout/Keep/Idea.json": `{
+			"textContent": "\n  First line is the title\nmore", "isArchived": true,
+			"attachments": [{"filePath": "sketch.jpg", "mimetype": "image/jpeg"},
+				{"filePath": "voice.3gp", "mimetype": "audio/3gpp"}]
+		}`,
+		"Takeout/Keep/sketch.jpg":  "jpeg data",
+		"Takeout/Keep/Trash.json":  `{"title": "Gone", "isTrashed": true}`,
+		"Takeout/Keep/Broken.json": `{"title": `,
+		"Takeout/Keep/Labels.txt":  "home",
+	})
+	notes := parse(t, SourceKeep, name)
+	if len(notes) != 3 {
+		t.Fatalf("got %d notes, want 3", len(notes))
+	}
+
+	shopping := notes["Takeout/Keep/Shopping.json"]
+	want := Note{
+		Source:  "Takeout/Keep/Shopping.json",
+		Title:   "Shopping",
+		Format:  "plain",
+		Type:    "checklist",
+		Tags:    []string{"home"},
+		Pinned:  true,
+		Color:   "blue",
+		Items:   []Item{{Text: "Milk", Checked: true}, {Text: "Bread"}},
+		Created: time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC),
+		Updated: time.Date(2020, 9, 13, 12, 26, 41, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(shopping, want) {
+		t.Errorf("got %+v, want %+v", shopping, want)
+	}
+
+	idea := notes["Takeout/Keep/Idea.json"]
+	if idea.Title != "First line is the title" || !idea.Archived || idea.Type != "" {
+		t.Errorf("got %+v", idea)
+	}
+	if idea.Image == nil || idea.Image.MimeType != "image/jpeg" || string(idea.Image.Data) != "jpeg data" {
+		t.Errorf("got image %+v", idea.Image)
+	}
+	if len(idea.Warnings) != 1 {
+		t.Errorf("got warnings %q, want one about the recording", idea.Warnings)
+	}
+
+	if broken := notes["Takeout/Keep/Broken.json"]; broken.Err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	long := strings.Repeat("é", 100)
+	tests := map[string]string{
+		"":                "",
+		"\n \n":           "",
+		"  title  \nbody": "title",
+		"\n\nsecond":      "second",
+		long:              strings.Repeat("é", 80) + "…",
+	}
+	for s, want := range tests {
+		if got := firstLine(s); got != want {
+			t.Errorf("firstLine(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestIsKeepNote(t *testing.T) {
+	tests := map[string]bool{
+		"Takeout/Keep/Note.json": true,
+		"Keep/Note.JSON":         true,
+		"Takeout/Keep/Note.html": false,
+		"Takeout/Drive/a.json":   false,
+	}
+	for name, want := range tests {
+		if got := isKeepNote(name); got != want {
+			t.Errorf("isKeepNote(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
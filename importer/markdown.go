@@ -0,0 +1,172 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// markdownExts are the files read from a Markdown archive.
+var markdownExts = map[string]string{
+	".md":       "markdown",
+	".markdown": "markdown",
+	".txt":      "plain",
+}
+
+var (
+	imageLink = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	heading   = regexp.MustCompile(`(?m)^#\s+(.+?)\s*#*\s*$`)
+)
+
+// markdownMeta is the YAML front matter understood in Markdown files, a
+// superset of what the Markdown export writes.
+type markdownMeta struct {
+	Title    string      `yaml:"title"`
+	Tags     interface{} `yaml:"tags"`
+	Created  time.Time   `yaml:"created"`
+	Date     time.Time   `yaml:"date"`
+	Updated  time.Time   `yaml:"updated"`
+	Format   string      `yaml:"format"`
+	Type     string      `yaml:"type"`
+	Pinned   bool        `yaml:"pinned"`
+	Starred  bool        `yaml:"starred"`
+	Archived bool        `yaml:"archived"`
+	Color    string      `yaml:"color"`
+}
+
+func parseMarkdown(files *archive) ([]Note, error) {
+	var notes []Note
+	for _, name := range files.names() {
+		format, ok := markdownExts[strings.ToLower(path.Ext(name))]
+		if !ok {
+			continue
+		}
+		if len(notes) == MaxNotes {
+			return nil, fmt.Errorf("Import has more than %d notes", MaxNotes)
+		}
+		note := Note{Source: name, Format: format}
+		data, err := files.readFile(name)
+		if errors.Is(err, errArchiveTooLarge) {
+			return nil, err
+		}
+		if err != nil {
+			note.Err = err
+		} else {
+			readMarkdown(&note, data, files)
+			// Archivers write the DOS epoch when they know no better
+			f, _ := files.file(name)
+			modified := f.Modified
+			if modified.Year() <= 1980 {
+				modified = time.Time{}
+			}
+			if note.Created.IsZero() {
+				note.Created = modified
+			}
+			if note.Updated.IsZero() {
+				note.Updated = modified
+			}
+		}
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+func readMarkdown(note *Note, data []byte, files *archive) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	if rest, ok := strings.CutPrefix(content, "---\n"); ok {
+		if header, body, ok := cutLine(rest, "---"); ok {
+			var meta markdownMeta
+			if err := yaml.Unmarshal([]byte(header), &meta); err != nil {
+				note.Warnings = append(note.Warnings, "Front matter is not valid YAML and was ignored")
+			} else {
+				applyMeta(note, &meta)
+				content = strings.TrimLeft(body, "\n")
+			}
+		}
+	}
+
+	if note.Title == "" {
+		if m := heading.FindStringSubmatch(content); m != nil {
+			note.Title = m[1]
+		} else {
+			note.Title = baseName(note.Source)
+		}
+	}
+
+	// A note carries one image: the first one the archive contains
+	dir := path.Dir(note.Source)
+	content = imageLink.ReplaceAllStringFunc(content, func(link string) string {
+		target := imageLink.FindStringSubmatch(link)[1]
+		if strings.Contains(target, "://") || strings.HasPrefix(target, "data:") {
+			return link
+		}
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		file := path.Join(dir, target)
+		if _, ok := files.file(file); !ok {
+			note.Warnings = append(note.Warnings, fmt.Sprintf("Image %s is missing from the archive", target))
+			return link
+		}
+		if note.Image != nil || imageType(file) == "" {
+			note.Warnings = append(note.Warnings, fmt.Sprintf("Image %s was not imported; a note can only have one JPEG, PNG or GIF image", target))
+			return link
+		}
+		data, err := files.readFile(file)
+		if err != nil {
+			note.Warnings = append(note.Warnings, err.Error())
+			return link
+		}
+		note.Image = &Attachment{Name: path.Base(file), MimeType: imageType(file), Data: data}
+		return ""
+	})
+	note.Content = strings.TrimSpace(content)
+}
+
+// cutLine splits s around the first line that equals sep.
+func cutLine(s, sep string) (before, after string, found bool) {
+	if strings.HasPrefix(s, sep+"\n") || s == sep {
+		return "", strings.TrimPrefix(s[len(sep):], "\n"), true
+	}
+	if i := strings.Index(s, "\n"+sep+"\n"); i >= 0 {
+		return s[:i], s[i+len(sep)+2:], true
+	}
+	if strings.HasSuffix(s, "\n"+sep) {
+		return s[:len(s)-len(sep)-1], "", true
+	}
+	return s, "", false
+}
+
+func applyMeta(note *Note, meta *markdownMeta) {
+	note.Title = strings.TrimSpace(meta.Title)
+	switch tags := meta.Tags.(type) {
+	case string:
+		note.Tags = strings.Split(tags, ",")
+	case []interface{}:
+		for _, tag := range tags {
+			note.Tags = append(note.Tags, fmt.Sprint(tag))
+		}
+	}
+	note.Created = meta.Created
+	if note.Created.IsZero() {
+		note.Created = meta.Date
+	}
+	note.Updated = meta.Updated
+	if meta.Format != "" {
+		note.Format = meta.Format
+	}
+	note.Type = meta.Type
+	note.Pinned = meta.Pinned
+	note.Starred = meta.Starred
+	note.Archived = meta.Archived
+	note.Color = meta.Color
+}
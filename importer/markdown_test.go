@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadMarkdown(t *testing.T) {
+	created := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		name     string
+		source   string
+		data     string
+		want     Note
+		warnings int
+	}{
+		{
+			name:   "front matter",
+			source: "a.md",
+			data: "---\ntitle: Groceries\ntags: [food, home]\ncreated: 2022-03-04T05:06:07Z\n" +
+				"pinned: true\ncolor: green\n---\n\nMilk\n",
+			want: Note{Title: "Groceries", Content: "Milk", Tags: []string{"food", "home"},
+				Created: created, Pinned: true, Color: "green"},
+		},
+		{
+			name:   "comma separated tags and date",
+			source: "a.md",
+			data:   "---\ntags: work\ndate: 2022-03-04T05:06:07Z\nformat: plain\n---\nText",
+			want:   Note{Title: "a", Content: "Text", Tags: []string{"work"}, Created: created, Format: "plain"},
+		},
+		{
+			name:   "heading as title",
+			source: "notes/b.md",
+			data:   "\xef\xbb\xbfIntro\r\n\r\n# The Title ##\r\nBody\r\n",
+			want:   Note{Title: "The Title", Content: "Intro\n\n# The Title ##\nBody"},
+		},
+		{
+			name:   "file name as title",
+			source: "notes/plain note.txt",
+			data:   "no heading here",
+			want:   Note{Title: "plain note", Content: "no heading here"},
+		},
+		{
+			name:     "invalid front matter",
+			source:   "c.md",
+			data:     "---\ntitle: [unclosed\n---\nBody",
+			want:     Note{Title: "c", Content: "---\ntitle: [unclosed\n---\nBody"},
+			warnings: 1,
+		},
+		{
+			name:   "unclosed front matter",
+			source: "d.md",
+			data:   "---\ntitle: x\nBody",
+			want:   Note{Title: "d", Content: "---\ntitle: x\nBody"},
+		},
+		{
+			name:   "empty front matter",
+			source: "e.md",
+			data:   "---\n---\n# Heading",
+			want:   Note{Title: "Heading", Content: "# Heading"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note := Note{Source: tt.source}
+			readMarkdown(&note, []byte(tt.data), &archive{})
+			if len(note.Warnings) != tt.warnings {
+				t.Errorf("got warnings %q, want %d", note.Warnings, tt.warnings)
+			}
+			note.Source, note.Warnings = "", nil
+			if !reflect.DeepEqual(note, tt.want) {
+				t.Errorf("got %+v, want %+v", note, tt.want)
+			}
+		})
+	}
+}
+
+func TestCutLine(t *testing.T) {
+	tests := []struct {
+		s             string
+		before, after string
+		found         bool
+	}{
+		{s: "a: 1\n---\nbody", before: "a: 1", after: "body", found: true},
+		{s: "---\nbody", before: "", after: "body", found: true},
+		{s: "a: 1\n---", before: "a: 1", after: "", found: true},
+		{s: "a: 1\n----\nbody", before: "a: 1\n----\nbody", after: "", found: false},
+	}
+	for _, tt := range tests {
+		before, after, found := cutLine(tt.s, "---")
+		if before != tt.before || after != tt.after || found != tt.found {
+			t.Errorf("cutLine(%q) = %q, %q, %v", tt.s, before, after, found)
+		}
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	name := writeZip(t, map[string]string{
+		"notes/a.md":            "# A\n\n![photo](images/a%20b.png)\n\nText\n\n![second](images/c.png)",
+		"notes/images/a b.png":  "png data",
+		"notes/images/c.png":    "more png data",
+		"notes/b.markdown":      "![missing](nowhere.png) ![web](https://example.com/x.png)",
+		"notes/.obsidian/x.md":  "hidden",
+		"notes/readme.pdf":      "not a note",
+		"__MACOSX/notes/._a.md": "resource fork",
+	})
+	notes := parse(t, SourceMarkdown, name)
+	if len(notes) != 2 {
+		t.Fatalf("got %d notes, want 2: %v", len(notes), notes)
+	}
+
+	a := notes["notes/a.md"]
+	if a.Content != "# A\n\n\n\nText\n\n![second](images/c.png)" {
+		t.Errorf("got content %q", a.Content)
+	}
+	if a.Image == nil || a.Image.Name != "a b.png" || a.Image.MimeType != "image/png" || string(a.Image.Data) != "png data" {
+		t.Errorf("got image %+v", a.Image)
+	}
+	if len(a.Warnings) != 1 {
+		t.Errorf("got warnings %q, want one about the second image", a.Warnings)
+	}
+	if want := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC); !a.Created.Equal(want) || !a.Updated.Equal(want) {
+		t.Errorf("got times %s, %s; want the file's", a.Created, a.Updated)
+	}
+
+	b := notes["notes/b.markdown"]
+	if b.Image != nil || len(b.Warnings) != 1 || b.Title != "b" {
+		t.Errorf("got %+v", b)
+	}
+}
@@ -0,0 +1,249 @@
+// Package jobs runs long tasks such as exports in the background. Jobs are
+// queued in the database and claimed by a worker on any replica with a lease
+// that is renewed while the job runs; a job whose replica dies is picked up
+// again once its lease runs out.
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"notes-api/database"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxAttempts   = 3
+	pollInterval  = 5 * time.Second
+	claimLease    = 2 * time.Minute
+	cleanInterval = time.Hour
+
+	// Retention is how long finished jobs and their files are kept.
+	Retention = 7 * 24 * time.Hour
+)
+
+// Dir is where job output files are written. It is not served statically;
+// files are downloaded through the API by their owner.
+var Dir = "jobs"
+
+// Runner performs a job. It may write a file with Create and record a
+// result with SetResult; returning an error fails the job with that message.
+type Runner func(job *models.Job) error
+
+var runners = map[string]Runner{}
+
+// Register sets the runner for a job type. Call it before Start.
+func Register(jobType string, run Runner) {
+	runners[jobType] = run
+}
+
+// Start runs the worker in the background.
+func Start() {
+	go work()
+}
+
+// Enqueue queues a job for userID with params encoded as JSON.
+func Enqueue(tx *gorm.DB, userID uuid.UUID, jobType string, params interface{}) (*models.Job, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	job := models.Job{
+		UserID:     userID,
+		Type:       jobType,
+		Status:     models.JobPending,
+		Params:     raw,
+		LeaseUntil: time.Now(),
+	}
+	if err := tx.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Params decodes the parameters a job was queued with.
+func Params(job *models.Job, params interface{}) error {
+	if len(job.Params) == 0 {
+		return nil
+	}
+	return json.Unmarshal(job.Params, params)
+}
+
+// SetResult stores result as the job's JSON result.
+func SetResult(job *models.Job, result interface{}) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	job.Result = raw
+	return nil
+}
+
+// Path returns the location of a job's output file.
+func Path(job *models.Job) string {
+	return filepath.Join(Dir, job.ID.String())
+}
+
+// InputPath returns the location of the file a job reads, such as an
+// uploaded archive. It is deleted once the job has finished.
+func InputPath(job *models.Job) string {
+	return filepath.Join(Dir, job.ID.String()+".input")
+}
+
+// Create creates the job's output file, downloaded as name.
+func Create(job *models.Job, name string) (*os.File, error) {
+	if err := MakeDir(); err != nil {
+		return nil, err
+	}
+	job.FileName = name
+	return os.Create(Path(job))
+}
+
+// MakeDir creates Dir if it does not exist.
+func MakeDir() error {
+	return os.MkdirAll(Dir, 0700)
+}
+
+func work() {
+	lastClean := time.Time{}
+	for {
+		for {
+			job, err := claim()
+			if err != nil {
+				log.Println("Job worker:", err)
+			}
+			if job == nil {
+				break
+			}
+			run(job)
+		}
+		if time.Since(lastClean) >= cleanInterval {
+			if err := clean(); err != nil {
+				log.Println("Failed to clean up jobs:", err)
+			}
+			lastClean = time.Now()
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// claim takes the oldest pending job, or a running job whose lease has run
+// out, and leases it to this worker.
+func claim() (*models.Job, error) {
+	var job models.Job
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND lease_until <= ?", []string{models.JobPending, models.JobRunning}, now).
+			Order("created_at").Limit(1).Find(&job)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		job.Status = models.JobRunning
+		job.Attempts++
+		job.LeaseUntil = now.Add(claimLease)
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+		}
+		return tx.Save(&job).Error
+	})
+	if err != nil || job.ID == uuid.Nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func run(job *models.Job) {
+	// Renew the lease while the job runs so no other worker takes it over
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(claimLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				database.DB.Model(&models.Job{}).Where("id = ?", job.ID).
+					Update("lease_until", time.Now().Add(claimLease))
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	err := execute(job)
+	close(stop)
+	os.Remove(InputPath(job))
+
+	now := time.Now()
+	expires := now.Add(Retention)
+	job.FinishedAt = &now
+	job.ExpiresAt = &expires
+	if err != nil {
+		log.Printf("Job %s (%s) failed: %v", job.ID, job.Type, err)
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+		os.Remove(Path(job))
+		job.FileName = ""
+		job.FileSize = 0
+	} else {
+		job.Status = models.JobSucceeded
+		if job.FileName != "" {
+			if info, err := os.Stat(Path(job)); err == nil {
+				job.FileSize = info.Size()
+			}
+		}
+	}
+	// Only update the job: it is gone if its account was deleted meanwhile
+	res := database.DB.Model(job).Select("*").Omit("created_at").Updates(job)
+	if res.Error != nil {
+		log.Printf("Failed to record job %s: %v", job.ID, res.Error)
+	} else if res.RowsAffected == 0 {
+		os.Remove(Path(job))
+	}
+}
+
+// execute runs a job, failing it for good once it has been attempted too
+// often, e.g. because it keeps crashing the worker.
+func execute(job *models.Job) (err error) {
+	if job.Attempts > maxAttempts {
+		return fmt.Errorf("gave up after %d attempts", maxAttempts)
+	}
+	runner, ok := runners[job.Type]
+	if !ok {
+		return fmt.Errorf("unknown job type %q", job.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return runner(job)
+}
+
+// clean deletes expired jobs and their files.
+func clean() error {
+	var expired []models.Job
+	if err := database.DB.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		return err
+	}
+	for i := range expired {
+		os.Remove(Path(&expired[i]))
+		os.Remove(InputPath(&expired[i]))
+		// An import that gave up leaves its record of imported notes behind
+		if err := database.DB.Where("job_id = ?", expired[i].ID).Delete(&models.ImportedNote{}).Error; err != nil {
+			return err
+		}
+		if err := database.DB.Delete(&expired[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package links finds wiki-style references between notes in note content.
+// A reference is written [[Note Title]] or [[note-id]], optionally followed by
+// a label: [[Note Title|shown text]].
+package links
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var reference = regexp.MustCompile(`\[\[([^\[\]|\n]+)(\|[^\[\]\n]*)?\]\]`)
+
+// Parse returns the distinct link targets in content, in order of first
+// appearance. Targets differing only in case are the same target.
+func Parse(content string) []string {
+	var targets []string
+	seen := map[string]bool{}
+	for _, m := range reference.FindAllStringSubmatch(content, -1) {
+		target := strings.TrimSpace(m[1])
+		key := strings.ToLower(target)
+		if target == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// ID returns the note ID a target refers to, if it is an [[id]] reference.
+func ID(target string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(target)
+	return id, err == nil
+}
+
+// Valid reports whether title can be referred to as [[title]]: it has to be
+// non-blank, fit on one line, leave out the characters that delimit
+// references and not read as a note ID.
+func Valid(title string) bool {
+	title = strings.TrimSpace(title)
+	if _, isID := ID(title); title == "" || isID {
+		return false
+	}
+	return !strings.ContainsAny(title, "[]|\n")
+}
+
+// Rename rewrites references to the title from so they point to the title to,
+// keeping any label. It reports whether content changed, which it never does
+// when to is not a Valid title.
+func Rename(content, from, to string) (string, bool) {
+	if !Valid(to) {
+		return content, false
+	}
+	to = strings.TrimSpace(to)
+	changed := false
+	result := reference.ReplaceAllStringFunc(content, func(match string) string {
+		m := reference.FindStringSubmatch(match)
+		if !strings.EqualFold(strings.TrimSpace(m[1]), from) {
+			return match
+		}
+		changed = true
+		return "[[" + to + m[2] + "]]"
+	})
+	return result, changed
+}
@@ -0,0 +1,118 @@
+package links
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{content: "no links", want: nil},
+		{content: "see [[Plans]] and [[Budget|the budget]]", want: []string{"Plans", "Budget"}},
+		{content: "[[ Plans ]] [[plans]] [[PLANS|again]]", want: []string{"Plans"}},
+		{content: "[[]] [[ ]] [[|label]]", want: nil},
+		{content: "[[a\nb]] [[x[y]] [[ok]]", want: []string{"ok"}},
+		{content: "[[[nested]]]", want: []string{"nested"}},
+		{content: "[[6ba7b810-9dad-11d1-80b4-00c04fd430c8]]", want: []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			if got := Parse(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestID(t *testing.T) {
+	if id, ok := ID("6ba7b810-9dad-11d1-80b4-00c04fd430c8"); !ok || id.String() != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Errorf("got %s, %v", id, ok)
+	}
+	if _, ok := ID("Plans"); ok {
+		t.Error("title read as an ID")
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := map[string]bool{
+		"Plans":                                true,
+		"":                                     false,
+		"   ":                                  false,
+		"a]]b":                                 false,
+		"a|b":                                  false,
+		"[draft":                               false,
+		"two\nlines":                           false,
+		"6ba7b810-9dad-11d1-80b4-00c04fd430c8": false,
+		" Plans 2024 ":                         true,
+	}
+	for title, want := range tests {
+		if got := Valid(title); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", title, got, want)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		from    string
+		to      string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "plain",
+			content: "see [[Plans]] now",
+			from:    "Plans", to: "Roadmap",
+			want: "see [[Roadmap]] now", changed: true,
+		},
+		{
+			name:    "label and case",
+			content: "[[plans|our plans]] and [[ PLANS ]]",
+			from:    "Plans", to: "Roadmap",
+			want: "[[Roadmap|our plans]] and [[Roadmap]]", changed: true,
+		},
+		{
+			name:    "other links",
+			content: "[[Plans 2]] [[Budget]]",
+			from:    "Plans", to: "Roadmap",
+			want: "[[Plans 2]] [[Budget]]",
+		},
+		{
+			name:    "trimmed title",
+			content: "[[Plans]]",
+			from:    "Plans", to: "  Roadmap ",
+			want: "[[Roadmap]]", changed: true,
+		},
+		{
+			name:    "title with brackets",
+			content: "[[Plans]]",
+			from:    "Plans", to: "a]] [[b",
+			want: "[[Plans]]",
+		},
+		{
+			name:    "title with a bar",
+			content: "[[Plans|label]]",
+			from:    "Plans", to: "a|b",
+			want: "[[Plans|label]]",
+		},
+		{
+			name:    "multiline title",
+			content: "[[Plans]]",
+			from:    "Plans", to: "a\nb",
+			want: "[[Plans]]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := Rename(tt.content, tt.from, tt.to)
+			if got != tt.want || changed != tt.changed {
+				t.Errorf("got %q, %v; want %q, %v", got, changed, tt.want, tt.changed)
+			}
+		})
+	}
+}
@@ -16,9 +16,21 @@ package main
 
 import (
 	"log"
+	"notes-api/accounts"
 	"notes-api/database"
+	"notes-api/events"
+	"notes-api/export"
+	"notes-api/handlers"
+	"notes-api/jobs"
+	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/ratelimit"
+	"notes-api/reminders"
 	"notes-api/routes"
+	"notes-api/tokens"
+	"notes-api/webhooks"
 	"os"
+	"strings"
 
 	_ "notes-api/docs"
 
@@ -38,8 +50,59 @@ func main() {
 	database.Connect()
 	database.Migrate()
 
+	// Load the keys tokens are signed with, and rotate them
+	if err := tokens.Start(accounts.TokenLifetime); err != nil {
+		log.Fatal("Failed to set up signing keys:", err)
+	}
+
+	// Receive note events published by other replicas and expire old ones
+	go events.Listen(database.DSN())
+	go events.Prune()
+
+	// Deliver note events to webhooks
+	webhooks.Start()
+
+	// Fire due reminders
+	reminders.Start()
+
+	// Run background jobs such as exports
+	jobs.Register(models.JobNotesExport, export.NotesExport)
+	jobs.Register(models.JobNotesImport, handlers.RunNotesImport)
+	jobs.Register(models.JobAccountExport, export.AccountExport)
+	jobs.Start()
+
+	// Anonymize deleted accounts after their grace period
+	accounts.Start()
+
+	// Make the verified accounts in ADMIN_EMAILS the first administrators
+	if emails := os.Getenv("ADMIN_EMAILS"); emails != "" {
+		promoted, err := accounts.BootstrapAdmins(strings.Split(emails, ","))
+		if err != nil {
+			log.Println("Failed to set up administrators:", err)
+		} else if promoted > 0 {
+			log.Printf("Made %d accounts from ADMIN_EMAILS administrators", promoted)
+		}
+	}
+
+	// Set up rate limits and where they are kept
+	if err := ratelimit.Load(database.DB); err != nil {
+		log.Fatal("Failed to set up rate limiting:", err)
+	}
+
+	// Behind a reverse proxy, take client IPs from X-Forwarded-For, but only
+	// when the request comes from one of the proxies
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		if err := middleware.SetTrustedProxies(strings.Split(proxies, ",")); err != nil {
+			log.Fatal("Failed to set trusted proxies:", err)
+		}
+	}
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
+		// Bodies over the default limit are streamed rather than refused, so
+		// imports can upload whole export archives; LimitBody refuses them
+		// everywhere else
+		StreamRequestBody: true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -54,9 +117,14 @@ func main() {
 	// Middleware
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, If-Match, If-None-Match",
+		ExposeHeaders: "ETag, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy",
+	}))
+
+	app.Use(middleware.LimitBody(fiber.DefaultBodyLimit, map[string]int{
+		"/api/notes/import": handlers.MaxImportSize,
 	}))
 
 	// Serve static files (uploaded images)
@@ -1,20 +1,137 @@
 package middleware
 
 import (
-	"os"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"notes-api/database"
+	"notes-api/models"
+	"notes-api/tokens"
 
 	"github.com/gofiber/fiber/v2"
 	jwtware "github.com/gofiber/jwt/v3"
 	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
 func Protected() func(*fiber.Ctx) error {
 	return jwtware.New(jwtware.Config{
-		SigningKey:   []byte(os.Getenv("JWT_SECRET")),
-		ErrorHandler: jwtError,
+		KeyFunc:        tokens.Keyfunc,
+		SuccessHandler: activeUser,
+		ErrorHandler:   jwtError,
 	})
 }
 
+// activeUser rejects valid tokens of accounts that have since been deleted
+// or disabled, and tokens revoked by bumping the account's token version.
+// The account's role is kept for RequireRole.
+func activeUser(c *fiber.Ctx) error {
+	var user models.User
+	err := database.DB.Select("id", "role", "disabled_at", "deleted_at", "token_version").
+		Where("id = ?", GetUserID(c)).Take(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check account",
+		})
+	}
+	if err != nil || user.DeletedAt != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Account has been deleted",
+		})
+	}
+	if user.DisabledAt != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Account has been disabled",
+		})
+	}
+	if tokenVersion(c) != user.TokenVersion {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token has been revoked",
+		})
+	}
+	c.Locals("role", user.Role)
+	return activeSession(c)
+}
+
+// RequireRole lets only accounts with role through. It must come after
+// Protected.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if current, _ := c.Locals("role").(string); current != role {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient permissions",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// lastSeenPrecision is how stale a session's last-seen time may get before
+// a request updates it, so that not every request writes to the database.
+const lastSeenPrecision = time.Minute
+
+// activeSession rejects tokens whose session has been revoked, and records
+// when and from where the session was last used. Tokens issued before
+// sessions existed carry no session and are let through until they expire.
+func activeSession(c *fiber.Ctx) error {
+	sessionID := GetSessionID(c)
+	if sessionID == "" {
+		return c.Next()
+	}
+
+	var session models.Session
+	err := database.DB.Select("id", "last_seen_at", "ip").
+		Where("id = ? AND user_id = ?", sessionID, GetUserID(c)).Take(&session).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check session",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session has been revoked",
+		})
+	}
+
+	if time.Since(session.LastSeenAt) > lastSeenPrecision || session.IP != ClientIP(c) {
+		err := database.DB.Model(&session).Updates(map[string]interface{}{
+			"last_seen_at": time.Now(),
+			"ip":           ClientIP(c),
+		}).Error
+		if err != nil {
+			log.Printf("Failed to update session %s: %v", session.ID, err)
+		}
+	}
+	return c.Next()
+}
+
+// tokenVersion returns the token version the request's token was issued at.
+// Tokens from before versions existed count as version 0.
+func tokenVersion(c *fiber.Ctx) int {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	version, _ := claims["ver"].(float64)
+	return int(version)
+}
+
+// ProtectedStream is Protected for WebSocket and EventSource clients, which
+// cannot set headers: the token may also be passed as ?access_token=.
+func ProtectedStream() func(*fiber.Ctx) error {
+	protected := Protected()
+	return func(c *fiber.Ctx) error {
+		if c.Get(fiber.HeaderAuthorization) == "" {
+			if token := c.Query("access_token"); token != "" {
+				if !strings.HasPrefix(token, "Bearer ") {
+					token = "Bearer " + token
+				}
+				c.Request().Header.Set(fiber.HeaderAuthorization, token)
+			}
+		}
+		return protected(c)
+	}
+}
+
 func jwtError(c *fiber.Ctx, err error) error {
 	if err.Error() == "Missing or malformed JWT" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -26,6 +143,14 @@ func jwtError(c *fiber.Ctx, err error) error {
 	})
 }
 
+// GetSessionID returns the ID of the session the request's token belongs
+// to, or "" for tokens issued before sessions existed.
+func GetSessionID(c *fiber.Ctx) string {
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	sessionID, _ := claims["sid"].(string)
+	return sessionID
+}
+
 func GetUserID(c *fiber.Ctx) string {
 	user := c.Locals("user").(*jwt.Token)
 	claims := user.Claims.(jwt.MapClaims)
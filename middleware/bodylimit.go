@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitBody refuses request bodies larger than limit with 413, except on
+// the paths in exceptions, which get the limit given there. The server must
+// stream request bodies, so bodies over its own limit are not read into
+// memory before they get here; bodies of unknown length are read up to the
+// limit.
+func LimitBody(limit int, exceptions map[string]int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		max := limit
+		if exception, ok := exceptions[strings.ToLower(strings.TrimRight(c.Path(), "/"))]; ok {
+			max = exception
+		}
+
+		req := c.Request()
+		length := req.Header.ContentLength()
+		if length > max {
+			return bodyTooLarge(c)
+		}
+		// Chunked bodies do not say how long they are
+		if length < 0 && req.IsBodyStream() {
+			body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(max)+1))
+			if err != nil {
+				return fiber.ErrBadRequest
+			}
+			if len(body) > max {
+				return bodyTooLarge(c)
+			}
+			req.SetBody(body)
+		}
+		return c.Next()
+	}
+}
+
+func bodyTooLarge(c *fiber.Ctx) error {
+	// The rest of the body is not read, so the connection cannot be reused
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"error": "Request body is too large",
+	})
+}
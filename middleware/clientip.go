@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For is believed.
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies sets the reverse proxies, as IPs or CIDR ranges, whose
+// X-Forwarded-For header ClientIP believes.
+func SetTrustedProxies(entries []string) error {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	trustedProxies = prefixes
+	return nil
+}
+
+// ClientIP returns the IP address of the client a request comes from. When
+// it reaches the API through trusted proxies, that is the rightmost address
+// in X-Forwarded-For that is not a trusted proxy: every proxy appends the
+// address it received the request from, so the entries to the left of it
+// were written by the client and could be anything.
+func ClientIP(c *fiber.Ctx) string {
+	remote := c.Context().RemoteIP().String()
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrustedProxy(addr) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range c.Request().Header.PeekAll(fiber.HeaderXForwardedFor) {
+		hops = append(hops, strings.Split(string(header), ",")...)
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap().String()
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return client
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"notes-api/ratelimit"
+	"notes-api/tokens"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// RateLimit limits requests under policy. Requests with a valid token are
+// counted per user, wherever they come from; others are counted per client
+// IP. Every response carries the RateLimit-* headers, and refused requests
+// get 429 with Retry-After. If the store fails, requests are let through.
+func RateLimit(policy ratelimit.Policy) fiber.Handler {
+	if !policy.Enabled() {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds()))
+
+	return func(c *fiber.Ctx) error {
+		result, err := ratelimit.Take(c.UserContext(), rateLimitKey(c), policy)
+		if err != nil {
+			log.Printf("Rate limit %s: %v", policy.Name, err)
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset.Seconds())))
+		c.Set("RateLimit-Policy", policyHeader)
+		if !result.Allowed {
+			seconds := ceilSeconds(result.RetryAfter.Seconds())
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many requests, please slow down",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// rateLimitKey returns who a request counts against. The token is only
+// checked for its signature and expiry, not against the database; a revoked
+// token still identifies the user it was issued to.
+func rateLimitKey(c *fiber.Ctx) string {
+	if userID := tokenUserID(c); userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + ClientIP(c)
+}
+
+// tokenUserID returns the user of the request's bearer token, or its
+// ?access_token=, or "" when it has no valid one.
+func tokenUserID(c *fiber.Ctx) string {
+	raw := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if raw == "" {
+		raw = strings.TrimPrefix(c.Query("access_token"), "Bearer ")
+	}
+	if raw == "" {
+		return ""
+	}
+	token, err := tokens.Parse(raw)
+	if err != nil || !token.Valid {
+		return ""
+	}
+	userID, _ := token.Claims.(jwt.MapClaims)["user_id"].(string)
+	return userID
+}
+
+func ceilSeconds(seconds float64) int {
+	return int(math.Ceil(seconds))
+}
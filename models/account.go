@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MinPasswordLength is the shortest password accepted.
+const MinPasswordLength = 6
+
+// Account is the authenticated user's own profile.
+type Account struct {
+	ID            uuid.UUID `json:"id"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	Name          string    `json:"name"`
+	Role          string    `json:"role" enums:"user,admin"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NewAccount returns the profile of user.
+func NewAccount(user *User) Account {
+	return Account{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Name:          user.Name,
+		Role:          user.Role,
+		PendingEmail:  user.PendingEmail,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	}
+}
+
+type UpdateAccountRequest struct {
+	Name *string `json:"name,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+// ChangeEmailRequest starts a change of the account's email address. The
+// current password confirms it.
+type ChangeEmailRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ConfirmEmailRequest completes an email change with the token sent to the
+// new address.
+type ConfirmEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResetPasswordRequest sets a new password with the token emailed when an
+// administrator forced a password reset.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+// DeleteAccountRequest confirms an account deletion with the password.
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type AccountData struct {
+	Account Account `json:"account"`
+}
+
+type AccountSuccessResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    AccountData `json:"data"`
+}
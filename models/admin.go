@@ -0,0 +1,166 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Account states, as administrators see them
+const (
+	UserActive   = "active"
+	UserDisabled = "disabled"
+	UserDeleted  = "deleted"
+)
+
+// AdminUser is an account as administrators see it.
+type AdminUser struct {
+	ID                   uuid.UUID  `json:"id"`
+	Email                string     `json:"email"`
+	EmailVerified        bool       `json:"email_verified"`
+	Name                 string     `json:"name"`
+	Role                 string     `json:"role" enums:"user,admin"`
+	Status               string     `json:"status" enums:"active,disabled,deleted"`
+	DisabledAt           *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason       string     `json:"disabled_reason,omitempty"`
+	DeletedAt            *time.Time `json:"deleted_at,omitempty"`
+	PasswordResetPending bool       `json:"password_reset_pending"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// NewAdminUser returns user as administrators see it.
+func NewAdminUser(user *User) AdminUser {
+	status := UserActive
+	switch {
+	case user.DeletedAt != nil:
+		status = UserDeleted
+	case user.DisabledAt != nil:
+		status = UserDisabled
+	}
+	return AdminUser{
+		ID:                   user.ID,
+		Email:                user.Email,
+		EmailVerified:        user.EmailVerifiedAt != nil,
+		Name:                 user.Name,
+		Role:                 user.Role,
+		Status:               status,
+		DisabledAt:           user.DisabledAt,
+		DisabledReason:       user.DisabledReason,
+		DeletedAt:            user.DeletedAt,
+		PasswordResetPending: user.PasswordResetTokenHash != "",
+		CreatedAt:            user.CreatedAt,
+		UpdatedAt:            user.UpdatedAt,
+	}
+}
+
+// StorageUsage is what one account, or all of them, stores. Byte counts of
+// notes and revisions cover their titles and content.
+type StorageUsage struct {
+	Notes         int64 `json:"notes"`
+	NoteBytes     int64 `json:"note_bytes"`
+	Revisions     int64 `json:"revisions"`
+	RevisionBytes int64 `json:"revision_bytes"`
+	Uploads       int64 `json:"uploads"`
+	UploadBytes   int64 `json:"upload_bytes"`
+	JobFiles      int64 `json:"job_files"`
+	JobFileBytes  int64 `json:"job_file_bytes"`
+	TotalBytes    int64 `json:"total_bytes"`
+}
+
+// UserStorage is what one account stores in the database.
+type UserStorage struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Email         string    `json:"email"`
+	Notes         int64     `json:"notes"`
+	NoteBytes     int64     `json:"note_bytes"`
+	Revisions     int64     `json:"revisions"`
+	RevisionBytes int64     `json:"revision_bytes"`
+}
+
+// Audit log actions
+const (
+	AuditUserDisable       = "user.disable"
+	AuditUserEnable        = "user.enable"
+	AuditUserRole          = "user.role"
+	AuditUserPasswordReset = "user.password_reset"
+	AuditUserNotesView     = "user.notes_view"
+	AuditUserDelete        = "user.delete"
+	AuditNoteDelete        = "note.delete"
+)
+
+// AuditLogEntry records an action an administrator took. It refers to
+// accounts by ID only, so it is kept when they are deleted; the IP address
+// of the administrator is cleared when their own account is anonymized.
+type AuditLogEntry struct {
+	ID           uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ActorID      uuid.UUID              `json:"actor_id" gorm:"type:uuid;not null;index"`
+	Action       string                 `json:"action" gorm:"not null;index" enums:"user.disable,user.enable,user.role,user.password_reset,user.notes_view,user.delete,note.delete"`
+	TargetUserID *uuid.UUID             `json:"target_user_id,omitempty" gorm:"type:uuid;index"`
+	TargetID     string                 `json:"target_id,omitempty"`
+	Details      map[string]interface{} `json:"details,omitempty" gorm:"type:jsonb;serializer:json;not null;default:'{}'"`
+	IP           string                 `json:"ip"`
+	CreatedAt    time.Time              `json:"created_at" gorm:"index"`
+}
+
+// DisableUserRequest disables an account. The reason is kept with the
+// account and shown to administrators.
+type DisableUserRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required" enums:"user,admin"`
+}
+
+// ModerationRequest gives the reason for removing content, for the audit log.
+type ModerationRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type AdminUsersData struct {
+	Users []AdminUser `json:"users"`
+	Count int         `json:"count"`
+	Total int64       `json:"total"`
+}
+
+type AdminUsersSuccessResponse struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message"`
+	Data    AdminUsersData `json:"data"`
+}
+
+type AdminUserData struct {
+	User    AdminUser     `json:"user"`
+	Storage *StorageUsage `json:"storage,omitempty"`
+}
+
+type AdminUserSuccessResponse struct {
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Data    AdminUserData `json:"data"`
+}
+
+type StorageData struct {
+	Users    int64         `json:"users"`
+	Total    StorageUsage  `json:"total"`
+	TopUsers []UserStorage `json:"top_users"`
+}
+
+type StorageSuccessResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    StorageData `json:"data"`
+}
+
+type AuditLogData struct {
+	Entries []AuditLogEntry `json:"entries"`
+	Count   int             `json:"count"`
+	Total   int64           `json:"total"`
+}
+
+type AuditLogSuccessResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    AuditLogData `json:"data"`
+}
@@ -0,0 +1,47 @@
+package models
+
+// Batch actions. Deleting is permanent, as notes have no trash; restore
+// brings archived notes back into the regular list.
+const (
+	BatchDelete  = "delete"
+	BatchArchive = "archive"
+	BatchRestore = "restore"
+	BatchTag     = "tag"
+	BatchUntag   = "untag"
+	BatchMove    = "move"
+)
+
+// MaxBatchNotes is the most notes a single batch can change.
+const MaxBatchNotes = 1000
+
+// BatchNotesRequest applies one action to the listed notes, or to the notes
+// matching Filter, a query string in the syntax of GET /api/notes.
+type BatchNotesRequest struct {
+	Action  string   `json:"action" validate:"required" example:"archive" enums:"delete,archive,restore,tag,untag,move"`
+	NoteIDs []string `json:"note_ids,omitempty"`
+	Filter  string   `json:"filter,omitempty" example:"color=red&prop.status=done"`
+	// Tags to add or remove, for the tag and untag actions
+	Tags []string `json:"tags,omitempty"`
+	// Note the move action puts the notes before in the manual order; they
+	// go to the end of the list without it
+	Before string `json:"before,omitempty"`
+}
+
+// Outcome of a batch action on a single note.
+type BatchNoteResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status" example:"applied" enums:"applied,unchanged,not_found"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchNotesData struct {
+	Action  string            `json:"action"`
+	Results []BatchNoteResult `json:"results"`
+	Applied int               `json:"applied"`
+}
+
+type BatchNotesSuccessResponse struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message"`
+	Data    BatchNotesData `json:"data"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Note types
+const (
+	NoteTypeNote      = "note"
+	NoteTypeChecklist = "checklist"
+)
+
+// ValidNoteType reports whether t is a supported note type.
+func ValidNoteType(t string) bool {
+	return t == NoteTypeNote || t == NoteTypeChecklist
+}
+
+// ChecklistItem is a single to-do entry of a checklist note.
+type ChecklistItem struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NoteID    uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	Text      string     `json:"text" gorm:"not null"`
+	Checked   bool       `json:"checked" gorm:"not null;default:false"`
+	Position  int        `json:"position" gorm:"not null"`
+	DueAt     *time.Time `json:"due_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Completion counts of a checklist note
+type ChecklistSummary struct {
+	Total   int `json:"total"`
+	Checked int `json:"checked"`
+}
+
+type ChecklistItemRequest struct {
+	Text     string     `json:"text" validate:"required"`
+	Checked  bool       `json:"checked"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	Position *int       `json:"position,omitempty"`
+}
+
+// Partial update of a checklist item; omitted fields are unchanged and a
+// null due_at clears the due date.
+type UpdateChecklistItemRequest struct {
+	Text    *string    `json:"text,omitempty"`
+	Checked *bool      `json:"checked,omitempty"`
+	DueAt   *time.Time `json:"due_at,omitempty"`
+}
+
+type ReorderChecklistRequest struct {
+	ItemIDs []uuid.UUID `json:"item_ids"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EventLogEntry is a published event kept so clients can catch up on what
+// they missed while disconnected. Payload holds the event as sent to clients.
+// Like note changes, entries are read in (ChangeXID, ID) order up to
+// SafeXID, since IDs are drawn before their transaction commits.
+type EventLogEntry struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement;index:idx_event_log_user_change,priority:3"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_event_log_user_change,priority:1"`
+	ChangeXID int64     `gorm:"not null;default:0;index:idx_event_log_user_change,priority:2"`
+	Type      string    `gorm:"not null"`
+	Payload   []byte    `gorm:"type:jsonb;not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (e *EventLogEntry) BeforeCreate(tx *gorm.DB) error {
+	return tx.Session(&gorm.Session{NewDB: true}).Raw("SELECT " + CurrentXID).Scan(&e.ChangeXID).Error
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Job types
+const (
+	JobNotesExport = "notes_export"
+	JobNotesImport = "notes_import"
+	// JobAccountExport archives everything stored for a user
+	JobAccountExport = "account_export"
+)
+
+// Job states
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a long-running task run in the background for a user, such as an
+// export. A job that produces a file keeps it until ExpiresAt; Result holds
+// a summary, such as the report of an import.
+type Job struct {
+	ID          uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID       `json:"-" gorm:"type:uuid;not null;index"`
+	Type        string          `json:"type" gorm:"not null" enums:"notes_export,notes_import,account_export"`
+	Status      string          `json:"status" gorm:"not null;index:idx_jobs_due,priority:1" enums:"pending,running,succeeded,failed"`
+	Params      json.RawMessage `json:"-" gorm:"type:jsonb"`
+	Result      json.RawMessage `json:"result,omitempty" gorm:"type:jsonb" swaggertype:"object"`
+	Error       string          `json:"error,omitempty"`
+	FileName    string          `json:"file_name,omitempty"`
+	FileSize    int64           `json:"file_size,omitempty"`
+	DownloadURL string          `json:"download_url,omitempty" gorm:"-"`
+	Attempts    int             `json:"-" gorm:"not null;default:0"`
+	LeaseUntil  time.Time       `json:"-" gorm:"index:idx_jobs_due,priority:2"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty" gorm:"index"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+type JobData struct {
+	Job Job `json:"job"`
+}
+
+type JobsData struct {
+	Jobs  []Job `json:"jobs"`
+	Count int   `json:"count"`
+}
+
+type JobSuccessResponse struct {
+	Status  string  `json:"status"`
+	Message string  `json:"message"`
+	Data    JobData `json:"data"`
+}
+
+type JobsSuccessResponse struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Data    JobsData `json:"data"`
+}
+
+// ImportReport is the result of a notes import job. In a dry run nothing is
+// created and notes that would be imported are "ready".
+type ImportReport struct {
+	Source   string             `json:"source" enums:"markdown,enex,keep"`
+	DryRun   bool               `json:"dry_run"`
+	Total    int                `json:"total"`
+	Imported int                `json:"imported"`
+	Failed   int                `json:"failed"`
+	Items    []ImportItemResult `json:"items"`
+}
+
+// ImportedNote records a note an import job created, in the same
+// transaction as the note, so a job that is run again after its worker died
+// does not create it twice.
+type ImportedNote struct {
+	JobID  uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Source string    `gorm:"primaryKey"`
+	NoteID uuid.UUID `gorm:"type:uuid;not null"`
+}
+
+// Outcome of importing a single note.
+type ImportItemResult struct {
+	Source   string     `json:"source"`
+	Title    string     `json:"title,omitempty"`
+	Status   string     `json:"status" enums:"imported,ready,failed"`
+	NoteID   *uuid.UUID `json:"note_id,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Warnings []string   `json:"warnings,omitempty"`
+}
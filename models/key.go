@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// SigningKey is a key tokens are signed with, named in their kid header. It
+// signs from ActiveFrom until the next key takes over, and verifies until
+// ExpiresAt, once every token it signed has expired. ExpiresAt is unset
+// while no newer key exists. PrivateKey is PEM-encoded PKCS #8, encrypted
+// with AES-256-GCM when JWT_KEY_ENCRYPTION_KEY is set. LegacyUntil is when
+// tokens signed with JWT_SECRET stop being accepted: set on the first key,
+// one token lifetime after it took over, and copied to each successor.
+type SigningKey struct {
+	ID          string    `gorm:"primaryKey"`
+	Algorithm   string    `gorm:"not null"`
+	PrivateKey  string    `gorm:"not null"`
+	ActiveFrom  time.Time `gorm:"not null"`
+	ExpiresAt   *time.Time
+	LegacyUntil *time.Time
+	CreatedAt   time.Time
+}
+
+// JSONWebKey is the public half of a signing key, as in RFC 7517. RSA keys
+// have N and E; Ed25519 keys have Crv and X.
+type JSONWebKey struct {
+	Kty string `json:"kty" example:"RSA"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"RS256"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty" example:"AQAB"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet lists the keys that tokens may be signed with.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NoteLink is a [[...]] reference from one note to another. Target is the
+// reference as written; TargetID is the note it resolves to, or nil while no
+// note with that title exists.
+type NoteLink struct {
+	SourceID  uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	Target    string     `gorm:"primaryKey"`
+	TargetID  *uuid.UUID `gorm:"type:uuid;index"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CreatedAt time.Time
+}
+
+// LinkedNote identifies a note at the other end of a link.
+type LinkedNote struct {
+	ID        uuid.UUID `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OutgoingLink is a reference in a note's content. Note is omitted when no
+// note matches the target yet.
+type OutgoingLink struct {
+	Target string      `json:"target"`
+	Note   *LinkedNote `json:"note,omitempty"`
+}
+
+type LinksData struct {
+	Links []OutgoingLink `json:"links"`
+	Count int            `json:"count"`
+}
+
+type BacklinksData struct {
+	Backlinks []LinkedNote `json:"backlinks"`
+	Count     int          `json:"count"`
+}
+
+type LinksSuccessResponse struct {
+	Status  string    `json:"status"`
+	Message string    `json:"message"`
+	Data    LinksData `json:"data"`
+}
+
+type BacklinksSuccessResponse struct {
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Data    BacklinksData `json:"data"`
+}
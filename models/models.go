@@ -1,21 +1,55 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// User is an account. A deleted account loses its content at once but its
+// record is kept, disabled, until it is anonymized after a grace period.
+//
+// Tokens carry the TokenVersion they were issued at; bumping it revokes every
+// token issued before. A new email address waits in PendingEmail until the
+// link sent to it, identified by the hash of its token, is followed; the
+// same link confirms the current address when PendingEmail equals Email.
+// EmailVerifiedAt is set once the owner has shown they receive mail there.
+//
+// Administrators can disable an account, which blocks it until enabled
+// again, and force a password reset, which clears the password until the
+// user sets a new one with the token emailed to them.
 type User struct {
-	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Email     string    `json:"email" gorm:"unique;not null"`
-	Password  string    `json:"-" gorm:"not null"`
-	Name      string    `json:"name" gorm:"not null"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Notes     []Note    `json:"notes,omitempty" gorm:"foreignKey:UserID"`
+	ID                     uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Email                  string     `json:"email" gorm:"unique;not null"`
+	Password               string     `json:"-" gorm:"not null"`
+	Name                   string     `json:"name" gorm:"not null"`
+	Role                   string     `json:"-" gorm:"not null;default:user"`
+	TokenVersion           int        `json:"-" gorm:"not null;default:0"`
+	PendingEmail           string     `json:"-"`
+	EmailTokenHash         string     `json:"-" gorm:"index"`
+	EmailTokenExpiresAt    *time.Time `json:"-"`
+	EmailVerifiedAt        *time.Time `json:"-"`
+	PasswordResetTokenHash string     `json:"-" gorm:"index"`
+	PasswordResetExpiresAt *time.Time `json:"-"`
+	DisabledAt             *time.Time `json:"-"`
+	DisabledReason         string     `json:"-"`
+	DeletedAt              *time.Time `json:"-" gorm:"index"`
+	AnonymizedAt           *time.Time `json:"-"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+	Notes                  []Note     `json:"notes,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// Roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type AuthUser struct {
 	ID        uuid.UUID `json:"id"`
 	Email     string    `json:"email"`
@@ -25,19 +59,105 @@ type AuthUser struct {
 }
 
 type Note struct {
-	ID          uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	Title       string    `json:"title" gorm:"not null"`
-	Content     string    `json:"content"`
-	ImagePath   string    `json:"-" gorm:"column:image_path"`
-	ImageURL    string    `json:"image_url,omitempty" gorm:"-"`
-	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uuid.UUID              `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Title       string                 `json:"title" gorm:"not null"`
+	Content     string                 `json:"content"`
+	Format      string                 `json:"format" gorm:"not null;default:plain" enums:"plain,markdown"`
+	ContentHTML string                 `json:"content_html,omitempty" gorm:"-"`
+	Type        string                 `json:"type" gorm:"not null;default:note" enums:"note,checklist"`
+	Pinned      bool                   `json:"pinned" gorm:"not null;default:false"`
+	Starred     bool                   `json:"starred" gorm:"not null;default:false"`
+	Archived    bool                   `json:"archived" gorm:"not null;default:false;index"`
+	Position    int                    `json:"position" gorm:"not null;default:0"`
+	Color       string                 `json:"color,omitempty" enums:"red,orange,yellow,green,teal,blue,purple,pink,brown,gray"`
+	Properties  map[string]interface{} `json:"properties,omitempty" gorm:"type:jsonb;serializer:json;not null;default:'{}'"`
+	Tags        []string               `json:"tags,omitempty" gorm:"type:jsonb;serializer:json;not null;default:'[]'"`
+	ImagePath   string                 `json:"-" gorm:"column:image_path"`
+	ImageURL    string                 `json:"image_url,omitempty" gorm:"-"`
+	UserID      uuid.UUID              `json:"user_id" gorm:"type:uuid;not null"`
+	Version     int                    `json:"version" gorm:"not null;default:1"`
+	ChangeXID   int64                  `json:"-" gorm:"not null;default:0;index"`
+	ChangeSeq   int64                  `json:"-" gorm:"not null;default:0;index"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+
+	Items     []ChecklistItem   `json:"items,omitempty" gorm:"foreignKey:NoteID"`
+	Checklist *ChecklistSummary `json:"checklist,omitempty" gorm:"-"`
+}
+
+// BeforeCreate starts every note at version 1 as a plain text note unless
+// another format or type was chosen. The version is bumped on each update.
+func (n *Note) BeforeCreate(tx *gorm.DB) error {
+	if n.Version == 0 {
+		n.Version = 1
+	}
+	if n.Format == "" {
+		n.Format = "plain"
+	}
+	if n.Type == "" {
+		n.Type = NoteTypeNote
+	}
+	return nil
 }
 
+// Change returns when the note last changed.
+func (n *Note) Change() Change {
+	return Change{XID: n.ChangeXID, Seq: n.ChangeSeq}
+}
+
+// BeforeSave stamps the note as changed so delta sync can find it, and
+// stores missing properties and tags as empty values.
+func (n *Note) BeforeSave(tx *gorm.DB) error {
+	change, err := NextChange(tx)
+	if err != nil {
+		return err
+	}
+	n.ChangeXID, n.ChangeSeq = change.XID, change.Seq
+	tx.Statement.SetColumn("change_xid", change.XID)
+	tx.Statement.SetColumn("change_seq", change.Seq)
+	if n.Properties == nil {
+		n.Properties = map[string]interface{}{}
+	}
+	if n.Tags == nil {
+		n.Tags = []string{}
+	}
+	return nil
+}
+
+// MaxTagLength is the longest tag a note can carry, in characters.
+const MaxTagLength = 50
+
+// Longest title and content of a note, in characters
+const (
+	MaxTitleLength   = 500
+	MaxContentLength = 1 << 20
+)
+
+// NormalizeTags trims tags and drops empty and duplicate ones, keeping the
+// first spelling of tags that only differ in case.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLength {
+			return nil, fmt.Errorf("Tags can be at most %d characters", MaxTagLength)
+		}
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// LoginRequest logs in. DeviceName labels the session in the list of
+// sessions; without it one is made up from the User-Agent.
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required,min=6"`
+	DeviceName string `json:"device_name,omitempty" example:"Work laptop"`
 }
 
 type RegisterRequest struct {
@@ -47,13 +167,57 @@ type RegisterRequest struct {
 }
 
 type CreateNoteRequest struct {
-	Title   string `json:"title" validate:"required"`
-	Content string `json:"content"`
+	Title      string                 `json:"title" validate:"required"`
+	Content    string                 `json:"content"`
+	Format     string                 `json:"format" enums:"plain,markdown"`
+	Type       string                 `json:"type" enums:"note,checklist"`
+	Pinned     bool                   `json:"pinned"`
+	Starred    bool                   `json:"starred"`
+	Color      string                 `json:"color,omitempty" enums:"red,orange,yellow,green,teal,blue,purple,pink,brown,gray"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	Items      []ChecklistItemRequest `json:"items,omitempty"`
 }
 
 type UpdateNoteRequest struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	Format  string `json:"format" enums:"plain,markdown"`
+}
+
+// Merge patch body for PATCH /api/notes/{id} (application/merge-patch+json).
+// Omitted members are left unchanged, null clears content or removes the image.
+type NoteMergePatch struct {
+	Title    *string `json:"title,omitempty"`
+	Content  *string `json:"content,omitempty"`
+	Format   *string `json:"format,omitempty" enums:"plain,markdown"`
+	Type     *string `json:"type,omitempty" enums:"note,checklist"`
+	Pinned   *bool   `json:"pinned,omitempty"`
+	Starred  *bool   `json:"starred,omitempty"`
+	Archived *bool   `json:"archived,omitempty"`
+	Position *int    `json:"position,omitempty"`
+	Color    *string `json:"color,omitempty"`
+	// Properties are merged key by key; null removes a property
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	ImageURL   *string                `json:"image_url,omitempty"`
+}
+
+// NoteFilter selects notes for GET /api/notes. Archived notes are left out
+// unless Archived is "include" or "only".
+type NoteFilter struct {
+	Archived   string
+	Pinned     *bool
+	Starred    *bool
+	Type       string
+	Color      string
+	Tag        string
+	Properties []PropertyFilter
+}
+
+// ReorderNotesRequest lists notes in their new manual order.
+type ReorderNotesRequest struct {
+	NoteIDs []uuid.UUID `json:"note_ids"`
 }
 
 // Standard API Response wrapper following REST best practices
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Property types
+const (
+	PropertyText   = "text"
+	PropertyNumber = "number"
+	PropertyDate   = "date"
+	PropertySelect = "select"
+)
+
+// PropertyDateLayout is the format of date property values.
+const PropertyDateLayout = "2006-01-02"
+
+// Colors lists the color labels a note can have.
+var Colors = []string{"red", "orange", "yellow", "green", "teal", "blue", "purple", "pink", "brown", "gray"}
+
+// ValidColor reports whether color is a known color label.
+func ValidColor(color string) bool {
+	for _, c := range Colors {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
+
+// PropertySchema defines a custom property users can set on their notes.
+// Values are stored in Note.Properties under Key and checked against Type.
+type PropertySchema struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_property_schemas_key,priority:1"`
+	Key       string    `json:"key" gorm:"not null;uniqueIndex:idx_property_schemas_key,priority:2"`
+	Name      string    `json:"name" gorm:"not null"`
+	Type      string    `json:"type" gorm:"not null" enums:"text,number,date,select"`
+	Options   []string  `json:"options,omitempty" gorm:"type:jsonb;serializer:json"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreatePropertySchemaRequest struct {
+	Key     string   `json:"key" validate:"required" example:"priority"`
+	Name    string   `json:"name" example:"Priority"`
+	Type    string   `json:"type" validate:"required" enums:"text,number,date,select"`
+	Options []string `json:"options,omitempty" example:"low,medium,high"`
+}
+
+// The type and key of a property cannot be changed.
+type UpdatePropertySchemaRequest struct {
+	Name    *string   `json:"name,omitempty"`
+	Options *[]string `json:"options,omitempty"`
+}
+
+// PropertyFilter is a condition on a property value: Op is one of eq, ne,
+// gt, gte, lt and lte, and Type is the property's type.
+type PropertyFilter struct {
+	Key   string
+	Type  string
+	Op    string
+	Value interface{}
+}
+
+type PropertySchemaData struct {
+	Property PropertySchema `json:"property"`
+}
+
+type PropertySchemasData struct {
+	Properties []PropertySchema `json:"properties"`
+	Count      int              `json:"count"`
+}
+
+type PropertySchemaSuccessResponse struct {
+	Status  string             `json:"status"`
+	Message string             `json:"message"`
+	Data    PropertySchemaData `json:"data"`
+}
+
+type PropertySchemasSuccessResponse struct {
+	Status  string              `json:"status"`
+	Message string              `json:"message"`
+	Data    PropertySchemasData `json:"data"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reminder states
+const (
+	ReminderScheduled = "scheduled"
+	ReminderFired     = "fired"
+	ReminderDismissed = "dismissed"
+)
+
+// Reminder delivery channels
+const (
+	ChannelRealtime = "realtime"
+	ChannelWebhook  = "webhook"
+	ChannelEmail    = "email"
+)
+
+// Reminder fires at DueAt, and again at every later occurrence of RRule,
+// which starts at StartAt and is expanded in Timezone so recurring reminders
+// keep their wall-clock time across DST changes. A snoozed reminder also fires at SnoozedUntil.
+// NextAt is the earlier of the two and is what the scheduler polls on.
+type Reminder struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	NoteID       uuid.UUID  `json:"note_id" gorm:"type:uuid;not null;index"`
+	UserID       uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	StartAt      time.Time  `json:"start_at" gorm:"not null"`
+	DueAt        time.Time  `json:"due_at" gorm:"not null"`
+	Timezone     string     `json:"timezone" gorm:"not null;default:UTC"`
+	RRule        string     `json:"rrule,omitempty"`
+	Channels     []string   `json:"channels" gorm:"type:jsonb;serializer:json;not null"`
+	Status       string     `json:"status" gorm:"not null;default:scheduled;index:idx_reminders_due,priority:1" enums:"scheduled,fired,dismissed"`
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	NextAt       time.Time  `json:"next_at" gorm:"not null;index:idx_reminders_due,priority:2"`
+	LastFiredAt  *time.Time `json:"last_fired_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Notifies reports whether the reminder is delivered through channel.
+func (r *Reminder) Notifies(channel string) bool {
+	for _, c := range r.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateReminderRequest schedules a reminder. RemindAt is either an RFC 3339
+// timestamp or a local date-time ("2006-01-02T15:04") in Timezone.
+type CreateReminderRequest struct {
+	RemindAt string   `json:"remind_at" validate:"required" example:"2025-03-01T09:00"`
+	Timezone string   `json:"timezone" example:"Europe/Berlin"`
+	RRule    string   `json:"rrule" example:"FREQ=WEEKLY;BYDAY=MO"`
+	Channels []string `json:"channels" example:"realtime,email"`
+}
+
+// SnoozeReminderRequest postpones a reminder by Minutes or until Until.
+type SnoozeReminderRequest struct {
+	Minutes int        `json:"minutes" example:"10"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+type ReminderData struct {
+	Reminder Reminder `json:"reminder"`
+}
+
+type RemindersData struct {
+	Reminders []Reminder `json:"reminders"`
+	Count     int        `json:"count"`
+}
+
+type ReminderSuccessResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    ReminderData `json:"data"`
+}
+
+type RemindersSuccessResponse struct {
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Data    RemindersData `json:"data"`
+}
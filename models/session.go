@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a login on one device. One is recorded for every token issued,
+// and the token carries its ID; revoking the session deletes it, which
+// revokes the token. LastSeenAt and IP are updated as the token is used.
+type Session struct {
+	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID     uuid.UUID `json:"-" gorm:"type:uuid;not null;index"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current" gorm:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" gorm:"not null"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"not null;index"`
+}
+
+type SessionsData struct {
+	Sessions []Session `json:"sessions"`
+	Count    int       `json:"count"`
+}
+
+type SessionsSuccessResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    SessionsData `json:"data"`
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ChangeSeqName is the Postgres sequence ordering note changes made in the
+// same transaction.
+const ChangeSeqName = "note_change_seq"
+
+// CurrentXID is the SQL expression for the ID of the current transaction.
+//
+// Sequence values are drawn when a row is written, not when its transaction
+// commits, so a change can become visible after changes with higher values.
+// Changes are therefore stamped with the ID of their transaction as well and
+// read in (transaction ID, sequence) order, up to SafeXID: every transaction
+// with a lower ID has ended, and every one still running or yet to start has
+// an ID at or above it, so a cursor below SafeXID never skips a change.
+const CurrentXID = "pg_current_xact_id()::text::bigint"
+
+// Change orders a change: the transaction that made it, then the sequence
+// value it drew.
+type Change struct {
+	XID int64
+	Seq int64
+}
+
+// After reports whether c comes after other.
+func (c Change) After(other Change) bool {
+	return c.XID > other.XID || (c.XID == other.XID && c.Seq > other.Seq)
+}
+
+// NextChange stamps a change made in tx.
+func NextChange(tx *gorm.DB) (Change, error) {
+	var change Change
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Raw("SELECT " + CurrentXID + " AS xid, nextval('" + ChangeSeqName + "') AS seq").Scan(&change).Error
+	return change, err
+}
+
+// ChangeColumns returns the columns that stamp rows updated with
+// UpdateColumns as changed in the updating transaction.
+func ChangeColumns() map[string]interface{} {
+	return map[string]interface{}{
+		"change_xid": gorm.Expr(CurrentXID),
+		"change_seq": gorm.Expr("nextval('" + ChangeSeqName + "')"),
+	}
+}
+
+// SafeXID returns the ID of the oldest transaction still running, or the
+// next one to start: changes from transactions below it are final.
+func SafeXID(tx *gorm.DB) (int64, error) {
+	var xid int64
+	err := tx.Raw("SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint").Scan(&xid).Error
+	return xid, err
+}
+
+// NoteTombstone records a deleted note so sync clients can remove it locally.
+type NoteTombstone struct {
+	NoteID    uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID `json:"-" gorm:"type:uuid;not null;index"`
+	ChangeXID int64     `json:"-" gorm:"not null;default:0;index"`
+	ChangeSeq int64     `json:"-" gorm:"not null;index"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (t *NoteTombstone) BeforeSave(tx *gorm.DB) error {
+	change, err := NextChange(tx)
+	if err != nil {
+		return err
+	}
+	t.ChangeXID, t.ChangeSeq = change.XID, change.Seq
+	tx.Statement.SetColumn("change_xid", change.XID)
+	tx.Statement.SetColumn("change_seq", change.Seq)
+	return nil
+}
+
+// Change returns when the note was deleted.
+func (t *NoteTombstone) Change() Change {
+	return Change{XID: t.ChangeXID, Seq: t.ChangeSeq}
+}
+
+// Single change pushed by a sync client
+type SyncChange struct {
+	ID          *uuid.UUID `json:"id,omitempty"`
+	Action      string     `json:"action" example:"update" enums:"create,update,delete"`
+	BaseVersion int        `json:"base_version,omitempty" example:"3"`
+	Title       *string    `json:"title,omitempty"`
+	Content     *string    `json:"content,omitempty"`
+	Format      *string    `json:"format,omitempty" enums:"plain,markdown"`
+	Pinned      *bool      `json:"pinned,omitempty"`
+	Starred     *bool      `json:"starred,omitempty"`
+	Archived    *bool      `json:"archived,omitempty"`
+	Color       *string    `json:"color,omitempty"`
+	// Properties replace all of the note's properties
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	// Tags replace all of the note's tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+type SyncPushRequest struct {
+	Changes []SyncChange `json:"changes"`
+}
+
+// Outcome of a single pushed change. On conflict Note holds the server copy.
+type SyncChangeResult struct {
+	ID     *uuid.UUID `json:"id,omitempty"`
+	Action string     `json:"action"`
+	Status string     `json:"status" example:"applied" enums:"applied,conflict,not_found,invalid,error"`
+	Error  string     `json:"error,omitempty"`
+	Note   *Note      `json:"note,omitempty"`
+}
+
+// Delta sync response payload
+type SyncData struct {
+	Notes     []Note          `json:"notes"`
+	Deleted   []NoteTombstone `json:"deleted"`
+	SyncToken string          `json:"sync_token"`
+	HasMore   bool            `json:"has_more"`
+}
+
+type SyncPushData struct {
+	Results []SyncChangeResult `json:"results"`
+}
+
+type SyncSuccessResponse struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message"`
+	Data    SyncData `json:"data"`
+}
+
+type SyncPushSuccessResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    SyncPushData `json:"data"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Template is a blueprint for new notes. Title and Content may contain
+// placeholders such as {{date}} or {{user.name}} that are expanded when a
+// note is created from it. System templates have no owner and are shared by
+// every user.
+type Template struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      *uuid.UUID `json:"-" gorm:"type:uuid;index"`
+	System      bool       `json:"system" gorm:"-"`
+	Name        string     `json:"name" gorm:"not null"`
+	Description string     `json:"description"`
+	Title       string     `json:"title"`
+	Content     string     `json:"content"`
+	Format      string     `json:"format" gorm:"not null;default:plain" enums:"plain,markdown"`
+	Type        string     `json:"type" gorm:"not null;default:note" enums:"note,checklist"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// AfterFind marks templates without an owner as system templates.
+func (t *Template) AfterFind(tx *gorm.DB) error {
+	t.System = t.UserID == nil
+	return nil
+}
+
+type CreateTemplateRequest struct {
+	Name        string `json:"name" validate:"required" example:"Weekly sync"`
+	Description string `json:"description"`
+	Title       string `json:"title" example:"Weekly sync {{date}}"`
+	Content     string `json:"content" example:"## Attendees\n\n## Notes\n"`
+	Format      string `json:"format" enums:"plain,markdown"`
+	Type        string `json:"type" enums:"note,checklist"`
+}
+
+type UpdateTemplateRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Title       *string `json:"title,omitempty"`
+	Content     *string `json:"content,omitempty"`
+	Format      *string `json:"format,omitempty" enums:"plain,markdown"`
+	Type        *string `json:"type,omitempty" enums:"note,checklist"`
+}
+
+// NoteFromTemplateRequest sets the values of custom placeholders and the
+// timezone date placeholders are expanded in. Title overrides the template's
+// title.
+type NoteFromTemplateRequest struct {
+	Title     string            `json:"title,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Timezone  string            `json:"timezone,omitempty" example:"Europe/Berlin"`
+}
+
+type TemplateData struct {
+	Template Template `json:"template"`
+}
+
+type TemplatesData struct {
+	Templates []Template `json:"templates"`
+	Count     int        `json:"count"`
+}
+
+type TemplateSuccessResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    TemplateData `json:"data"`
+}
+
+type TemplatesSuccessResponse struct {
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Data    TemplatesData `json:"data"`
+}
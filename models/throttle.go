@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one key: an email address or
+// a client IP. After a few failures further attempts must wait, for longer
+// after each failure, until the key is locked out. A locked email address
+// can be unlocked early with the token emailed to its owner. Pending counts
+// the attempts that are being checked, which count as failures until they
+// are known not to be.
+type LoginThrottle struct {
+	Key             string    `gorm:"primaryKey"`
+	Failures        int       `gorm:"not null;default:0"`
+	LastFailureAt   time.Time `gorm:"index"`
+	BlockedUntil    time.Time
+	Locked          bool   `gorm:"not null;default:false"`
+	UnlockTokenHash string `gorm:"index"`
+	Pending         int    `gorm:"not null;default:0"`
+	PendingAt       time.Time
+}
+
+type UnlockAccountRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// RateLimitBucket is a rate limit bucket kept in Postgres, so that replicas
+// share it. FullAt is when the bucket will be full again.
+type RateLimitBucket struct {
+	Key    string    `gorm:"primaryKey"`
+	FullAt time.Time `gorm:"not null;index"`
+}
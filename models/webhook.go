@@ -0,0 +1,101 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook is a user's subscription to note events, delivered by HTTP POST.
+type Webhook struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	URL       string    `json:"url" gorm:"not null"`
+	Events    []string  `json:"events" gorm:"type:jsonb;serializer:json;not null"`
+	Secret    string    `json:"-" gorm:"not null"`
+	Active    bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event queued for a webhook, and the log of its
+// delivery attempts.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	WebhookID      uuid.UUID       `json:"webhook_id" gorm:"type:uuid;not null;index"`
+	EventType      string          `json:"event_type" gorm:"not null"`
+	Payload        json.RawMessage `json:"payload" gorm:"type:jsonb;not null" swaggertype:"object"`
+	Status         string          `json:"status" gorm:"not null;index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due,priority:2"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url" example:"https://example.com/hooks/notes"`
+	Events []string `json:"events" example:"note.created,note.updated"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+type UpdateWebhookRequest struct {
+	URL    *string   `json:"url,omitempty"`
+	Events *[]string `json:"events,omitempty"`
+	Active *bool     `json:"active,omitempty"`
+	Secret *string   `json:"secret,omitempty"`
+}
+
+// Single webhook response payload. Secret is only returned when it is set.
+type WebhookData struct {
+	Webhook Webhook `json:"webhook"`
+	Secret  string  `json:"secret,omitempty"`
+}
+
+type WebhooksData struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Count    int       `json:"count"`
+}
+
+type WebhookDeliveryData struct {
+	Delivery WebhookDelivery `json:"delivery"`
+}
+
+type WebhookDeliveriesData struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Count      int               `json:"count"`
+}
+
+type WebhookSuccessResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    WebhookData `json:"data"`
+}
+
+type WebhooksSuccessResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    WebhooksData `json:"data"`
+}
+
+type WebhookDeliverySuccessResponse struct {
+	Status  string              `json:"status"`
+	Message string              `json:"message"`
+	Data    WebhookDeliveryData `json:"data"`
+}
+
+type WebhookDeliveriesSuccessResponse struct {
+	Status  string                `json:"status"`
+	Message string                `json:"message"`
+	Data    WebhookDeliveriesData `json:"data"`
+}
@@ -0,0 +1,357 @@
+// Package ot implements operational transformation for plain text, using the
+// operation format of ot.js so browser clients can use that library as is.
+//
+// An operation is a list of components that walk over the whole document:
+// a positive number retains that many characters, a negative number deletes
+// that many and a string inserts it. In JSON, [5, "abc", -2] keeps five
+// characters, inserts "abc" and deletes the next two. Lengths count UTF-16
+// code units, like JavaScript strings.
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Operation is a sequence of retain, insert and delete components.
+type Operation struct {
+	ops          []component
+	baseLength   int
+	targetLength int
+}
+
+// component is a retain (n > 0), a delete (n < 0) or an insert (s != "").
+type component struct {
+	n int
+	s []uint16
+}
+
+func (c component) isRetain() bool { return c.s == nil && c.n > 0 }
+func (c component) isDelete() bool { return c.s == nil && c.n < 0 }
+func (c component) isInsert() bool { return c.s != nil }
+
+// BaseLength is the length of documents the operation applies to.
+func (o *Operation) BaseLength() int { return o.baseLength }
+
+// TargetLength is the length of the document after applying the operation.
+func (o *Operation) TargetLength() int { return o.targetLength }
+
+// Retain skips over n characters.
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLength += n
+	o.targetLength += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].isRetain() {
+		o.ops[last].n += n
+	} else {
+		o.ops = append(o.ops, component{n: n})
+	}
+	return o
+}
+
+// insert inserts UTF-16 code units at the current position.
+func (o *Operation) insert(s []uint16) *Operation {
+	if len(s) == 0 {
+		return o
+	}
+	o.targetLength += len(s)
+	last := len(o.ops) - 1
+	switch {
+	case last >= 0 && o.ops[last].isInsert():
+		o.ops[last].s = append(append([]uint16{}, o.ops[last].s...), s...)
+	case last >= 0 && o.ops[last].isDelete():
+		// Keep inserts before deletes so equivalent operations compare equal
+		if last > 0 && o.ops[last-1].isInsert() {
+			o.ops[last-1].s = append(append([]uint16{}, o.ops[last-1].s...), s...)
+		} else {
+			o.ops = append(o.ops, o.ops[last])
+			o.ops[last] = component{s: s}
+		}
+	default:
+		o.ops = append(o.ops, component{s: s})
+	}
+	return o
+}
+
+// Insert inserts text at the current position.
+func (o *Operation) Insert(text string) *Operation {
+	return o.insert(utf16.Encode([]rune(text)))
+}
+
+// Delete removes n characters at the current position.
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLength += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].isDelete() {
+		o.ops[last].n -= n
+	} else {
+		o.ops = append(o.ops, component{n: -n})
+	}
+	return o
+}
+
+// IsNoop reports whether the operation leaves every document unchanged.
+func (o *Operation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].isRetain())
+}
+
+// Apply applies the operation to doc.
+func (o *Operation) Apply(doc string) (string, error) {
+	src := utf16.Encode([]rune(doc))
+	if len(src) != o.baseLength {
+		return "", fmt.Errorf("operation expects a document of length %d, got %d", o.baseLength, len(src))
+	}
+
+	out := make([]uint16, 0, o.targetLength)
+	pos := 0
+	for _, c := range o.ops {
+		switch {
+		case c.isRetain():
+			out = append(out, src[pos:pos+c.n]...)
+			pos += c.n
+		case c.isInsert():
+			out = append(out, c.s...)
+		default:
+			pos -= c.n
+		}
+	}
+	return string(utf16.Decode(out)), nil
+}
+
+// Transform takes two operations a and b that apply to the same document and
+// returns a' and b' such that applying a then b' equals applying b then a'.
+// When both insert at the same position, a's insert comes first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.baseLength != b.baseLength {
+		return nil, nil, errors.New("both operations must apply to the same document length")
+	}
+
+	aPrime, bPrime := &Operation{}, &Operation{}
+	opsA, opsB := a.ops, b.ops
+	i, j := 0, 0
+	next := func(ops []component, k *int) *component {
+		if *k >= len(ops) {
+			return nil
+		}
+		c := ops[*k]
+		*k++
+		return &c
+	}
+	opA, opB := next(opsA, &i), next(opsB, &j)
+
+	for opA != nil || opB != nil {
+		if opA != nil && opA.isInsert() {
+			aPrime.insert(opA.s)
+			bPrime.Retain(len(opA.s))
+			opA = next(opsA, &i)
+			continue
+		}
+		if opB != nil && opB.isInsert() {
+			aPrime.Retain(len(opB.s))
+			bPrime.insert(opB.s)
+			opB = next(opsB, &j)
+			continue
+		}
+		if opA == nil || opB == nil {
+			return nil, nil, errors.New("operations do not cover the same document")
+		}
+
+		switch {
+		case opA.isRetain() && opB.isRetain():
+			n := min(opA.n, opB.n)
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+			opA, opB = advance(opA, n, opsA, &i, next), advance(opB, n, opsB, &j, next)
+		case opA.isDelete() && opB.isDelete():
+			// Both deleted the same characters
+			n := min(-opA.n, -opB.n)
+			opA, opB = advance(opA, n, opsA, &i, next), advance(opB, n, opsB, &j, next)
+		case opA.isDelete() && opB.isRetain():
+			n := min(-opA.n, opB.n)
+			aPrime.Delete(n)
+			opA, opB = advance(opA, n, opsA, &i, next), advance(opB, n, opsB, &j, next)
+		default: // retain in a, delete in b
+			n := min(opA.n, -opB.n)
+			bPrime.Delete(n)
+			opA, opB = advance(opA, n, opsA, &i, next), advance(opB, n, opsB, &j, next)
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// advance consumes n characters of a retain or delete component and returns
+// what is left of it, or the next component once it is used up.
+func advance(c *component, n int, ops []component, k *int, next func([]component, *int) *component) *component {
+	if c.n > 0 {
+		c.n -= n
+	} else {
+		c.n += n
+	}
+	if c.n == 0 {
+		return next(ops, k)
+	}
+	return c
+}
+
+// Compose returns a single operation with the effect of applying a and
+// then b.
+func Compose(a, b *Operation) (*Operation, error) {
+	if a.targetLength != b.baseLength {
+		return nil, errors.New("the second operation must apply to the result of the first")
+	}
+
+	composed := &Operation{}
+	opsA, opsB := a.ops, b.ops
+	i, j := 0, 0
+	next := func(ops []component, k *int) *component {
+		if *k >= len(ops) {
+			return nil
+		}
+		c := ops[*k]
+		*k++
+		return &c
+	}
+	opA, opB := next(opsA, &i), next(opsB, &j)
+
+	for opA != nil || opB != nil {
+		if opA != nil && opA.isDelete() {
+			composed.Delete(-opA.n)
+			opA = next(opsA, &i)
+			continue
+		}
+		if opB != nil && opB.isInsert() {
+			composed.insert(opB.s)
+			opB = next(opsB, &j)
+			continue
+		}
+		if opA == nil || opB == nil {
+			return nil, errors.New("operations do not cover the same document")
+		}
+
+		if opA.isInsert() {
+			n := min(len(opA.s), abs(opB.n))
+			if opB.isRetain() {
+				composed.insert(opA.s[:n])
+			}
+			// An insert followed by a delete of it leaves nothing
+			opA.s = opA.s[n:]
+			if len(opA.s) == 0 {
+				opA = next(opsA, &i)
+			}
+			opB = advance(opB, n, opsB, &j, next)
+			continue
+		}
+
+		// Retain in a
+		n := min(opA.n, abs(opB.n))
+		if opB.isRetain() {
+			composed.Retain(n)
+		} else {
+			composed.Delete(n)
+		}
+		opA, opB = advance(opA, n, opsA, &i, next), advance(opB, n, opsB, &j, next)
+	}
+	return composed, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Diff returns an operation that turns a into b by replacing the part
+// between their common prefix and suffix.
+func Diff(a, b string) *Operation {
+	src, dst := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	prefix := 0
+	for prefix < len(src) && prefix < len(dst) && src[prefix] == dst[prefix] {
+		prefix++
+	}
+	// Do not split a surrogate pair
+	if prefix > 0 && utf16.IsSurrogate(rune(src[prefix-1])) && src[prefix-1] < 0xdc00 {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(src)-prefix && suffix < len(dst)-prefix &&
+		src[len(src)-1-suffix] == dst[len(dst)-1-suffix] {
+		suffix++
+	}
+	if suffix > 0 && src[len(src)-suffix] >= 0xdc00 && src[len(src)-suffix] <= 0xdfff {
+		suffix--
+	}
+
+	op := &Operation{}
+	op.Retain(prefix)
+	op.insert(dst[prefix : len(dst)-suffix])
+	op.Delete(len(src) - prefix - suffix)
+	op.Retain(suffix)
+	return op
+}
+
+// TransformIndex moves a cursor position through the operation.
+func (o *Operation) TransformIndex(index int) int {
+	newIndex := index
+	for _, c := range o.ops {
+		switch {
+		case c.isRetain():
+			index -= c.n
+		case c.isInsert():
+			newIndex += len(c.s)
+		default:
+			newIndex -= min(index, -c.n)
+			index += c.n
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return newIndex
+}
+
+// MarshalJSON encodes the operation in ot.js format.
+func (o Operation) MarshalJSON() ([]byte, error) {
+	out := make([]interface{}, len(o.ops))
+	for i, c := range o.ops {
+		if c.isInsert() {
+			out[i] = string(utf16.Decode(c.s))
+		} else {
+			out[i] = c.n
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an operation in ot.js format.
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.New("operation must be an array")
+	}
+
+	*o = Operation{}
+	for _, item := range raw {
+		var text string
+		if err := json.Unmarshal(item, &text); err == nil {
+			o.Insert(text)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(item, &n); err != nil || n == 0 {
+			return fmt.Errorf("invalid operation component %s", item)
+		}
+		if n > 0 {
+			o.Retain(n)
+		} else {
+			o.Delete(-n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package ot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func parse(t *testing.T, raw string) *Operation {
+	t.Helper()
+	op := &Operation{}
+	if err := json.Unmarshal([]byte(raw), op); err != nil {
+		t.Fatalf("parsing %s: %v", raw, err)
+	}
+	return op
+}
+
+func apply(t *testing.T, op *Operation, doc string) string {
+	t.Helper()
+	out, err := op.Apply(doc)
+	if err != nil {
+		t.Fatalf("applying %s to %q: %v", encode(t, op), doc, err)
+	}
+	return out
+}
+
+func encode(t *testing.T, op *Operation) string {
+	t.Helper()
+	data, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		op   string
+		want string
+	}{
+		{"insert", "hello", `[5, " world"]`, "hello world"},
+		{"delete", "hello world", `[5, -6]`, "hello"},
+		{"replace", "hello", `["j", -1, 4]`, "jello"},
+		{"utf16", "a😀b", `[3, "!", -1]`, "a😀!"},
+		{"empty", "", `["x"]`, "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apply(t, parse(t, tt.op), tt.doc); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyWrongLength(t *testing.T) {
+	if _, err := parse(t, `[3]`).Apply("ab"); err == nil {
+		t.Error("expected an error for a document of the wrong length")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: `[1, 2, "a", "b", -1, -1]`, want: `[3,"ab",-2]`},
+		{raw: `[-1, "a"]`, want: `["a",-1]`},
+		{raw: `[]`, want: `[]`},
+		{raw: `[0]`, wantErr: true},
+		{raw: `[true]`, wantErr: true},
+		{raw: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			op := &Operation{}
+			err := json.Unmarshal([]byte(tt.raw), op)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", encode(t, op))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := encode(t, op); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b string
+		want string
+	}{
+		{"inserts at different positions", "abc", `["x", 3]`, `[3, "y"]`, "xabcy"},
+		{"inserts at the same position", "abc", `[1, "x", 2]`, `[1, "y", 2]`, "axybc"},
+		{"insert inside a deletion", "abcdef", `[3, "x", 3]`, `[1, -4, 1]`, "axf"},
+		{"overlapping deletions", "abcdef", `[1, -3, 2]`, `[2, -3, 1]`, "af"},
+		{"same deletion", "abc", `[-3]`, `[-3]`, ""},
+		{"delete and retain", "abc", `[1, -1, 1]`, `[3, "!"]`, "ac!"},
+		{"unicode", "😀😀", `[2, "a", 2]`, `[-2, 2]`, "a😀"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := parse(t, tt.a), parse(t, tt.b)
+			aPrime, bPrime, err := Transform(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			viaA := apply(t, bPrime, apply(t, a, tt.doc))
+			viaB := apply(t, aPrime, apply(t, b, tt.doc))
+			if viaA != viaB {
+				t.Fatalf("a then b' gives %q, b then a' gives %q", viaA, viaB)
+			}
+			if viaA != tt.want {
+				t.Errorf("got %q, want %q", viaA, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformMismatch(t *testing.T) {
+	if _, _, err := Transform(parse(t, `[3]`), parse(t, `[4]`)); err == nil {
+		t.Error("expected an error for operations on different lengths")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b string
+		want string
+	}{
+		{"inserts", "abc", `[3, "d"]`, `["z", 4]`, "zabcd"},
+		{"delete what was inserted", "abc", `[1, "xyz", 2]`, `[2, -2, 2]`, "axbc"},
+		{"delete across an insert", "abc", `[1, "x", 2]`, `[-3, 1]`, "c"},
+		{"retain after delete", "abcdef", `[-2, 4]`, `[2, "!", 2]`, "cd!ef"},
+		{"replace everything", "abc", `[-3, "xyz"]`, `["1", -3]`, "1"},
+		{"noops", "abc", `[3]`, `[3]`, "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := parse(t, tt.a), parse(t, tt.b)
+			composed, err := Compose(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := apply(t, b, apply(t, a, tt.doc))
+			if want != tt.want {
+				t.Fatalf("applying a then b gives %q, want %q", want, tt.want)
+			}
+			if got := apply(t, composed, tt.doc); got != want {
+				t.Errorf("composed %s gives %q, want %q", encode(t, composed), got, want)
+			}
+		})
+	}
+}
+
+func TestComposeMismatch(t *testing.T) {
+	if _, err := Compose(parse(t, `[3, "x"]`), parse(t, `[3]`)); err == nil {
+		t.Error("expected an error when b does not apply to the result of a")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want string
+	}{
+		{"hello world", "hello there world", `[6,"there ",5]`},
+		{"abc", "abc", `[3]`},
+		{"", "abc", `["abc"]`},
+		{"abc", "", `[-3]`},
+		{"abcdef", "abXYef", `[2,"XY",-2,2]`},
+		{"aaa", "aa", `[2,-1]`},
+		// The emoji differ only in their low surrogate
+		{"😀", "😁", `["😁",-2]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"->"+tt.b, func(t *testing.T) {
+			op := Diff(tt.a, tt.b)
+			if got := apply(t, op, tt.a); got != tt.b {
+				t.Errorf("diff gives %q, want %q", got, tt.b)
+			}
+			if got := encode(t, op); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		op    string
+		index int
+		want  int
+	}{
+		{`["ab", 3]`, 0, 2},
+		{`[1, "ab", 2]`, 2, 4},
+		{`[2, "ab", 1]`, 1, 1},
+		{`[-2, 3]`, 4, 2},
+		{`[1, -3, 1]`, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			if got := parse(t, tt.op).TransformIndex(tt.index); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
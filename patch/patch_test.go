@@ -0,0 +1,201 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, raw string) map[string]interface{} {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		t.Fatalf("parsing %s: %v", raw, err)
+	}
+	return doc
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{name: "replace", target: `{"a": "b"}`, patch: `{"a": "c"}`, want: `{"a": "c"}`},
+		{name: "add", target: `{"a": "b"}`, patch: `{"b": "c"}`, want: `{"a": "b", "b": "c"}`},
+		{name: "remove", target: `{"a": "b", "b": "c"}`, patch: `{"a": null}`, want: `{"b": "c"}`},
+		{name: "remove missing", target: `{"a": "b"}`, patch: `{"x": null}`, want: `{"a": "b"}`},
+		{name: "replace array", target: `{"a": [1, 2]}`, patch: `{"a": [3]}`, want: `{"a": [3]}`},
+		{name: "nested", target: `{"a": {"b": 1, "c": 2}}`, patch: `{"a": {"b": null, "d": 3}}`, want: `{"a": {"c": 2, "d": 3}}`},
+		{name: "object over scalar", target: `{"a": 1}`, patch: `{"a": {"b": null, "c": 2}}`, want: `{"a": {"c": 2}}`},
+		{name: "empty", target: `{"a": 1}`, patch: `{}`, want: `{"a": 1}`},
+		{name: "not an object", target: `{}`, patch: `[1]`, wantErr: true},
+		{name: "invalid", target: `{}`, patch: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge(decode(t, tt.target), []byte(tt.patch))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{
+			name:   "add member",
+			target: `{"a": 1}`,
+			patch:  `[{"op": "add", "path": "/b", "value": [1]}]`,
+			want:   `{"a": 1, "b": [1]}`,
+		},
+		{
+			name:   "add to array",
+			target: `{"a": [1, 3]}`,
+			patch:  `[{"op": "add", "path": "/a/1", "value": 2}, {"op": "add", "path": "/a/-", "value": 4}]`,
+			want:   `{"a": [1, 2, 3, 4]}`,
+		},
+		{
+			name:   "remove",
+			target: `{"a": [1, 2, 3], "b": 1}`,
+			patch:  `[{"op": "remove", "path": "/a/1"}, {"op": "remove", "path": "/b"}]`,
+			want:   `{"a": [1, 3]}`,
+		},
+		{
+			name:   "replace",
+			target: `{"a": {"b": 1}}`,
+			patch:  `[{"op": "replace", "path": "/a/b", "value": "x"}]`,
+			want:   `{"a": {"b": "x"}}`,
+		},
+		{
+			name:   "move",
+			target: `{"a": {"b": 1}, "c": []}`,
+			patch:  `[{"op": "move", "from": "/a/b", "path": "/c/0"}]`,
+			want:   `{"a": {}, "c": [1]}`,
+		},
+		{
+			name:   "move within an array",
+			target: `{"a": [1, 2, 3]}`,
+			patch:  `[{"op": "move", "from": "/a/0", "path": "/a/2"}]`,
+			want:   `{"a": [2, 3, 1]}`,
+		},
+		{
+			name:   "move to itself",
+			target: `{"a": 1}`,
+			patch:  `[{"op": "move", "from": "/a", "path": "/a"}]`,
+			want:   `{"a": 1}`,
+		},
+		{
+			name:   "copy",
+			target: `{"a": {"b": [1]}}`,
+			patch:  `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "add", "path": "/c/b/-", "value": 2}]`,
+			want:   `{"a": {"b": [1]}, "c": {"b": [1, 2]}}`,
+		},
+		{
+			name:   "test",
+			target: `{"a": {"b": [1, "x"]}}`,
+			patch:  `[{"op": "test", "path": "/a/b", "value": [1, "x"]}]`,
+			want:   `{"a": {"b": [1, "x"]}}`,
+		},
+		{
+			name:   "escaped pointer",
+			target: `{"a/b": 1, "c~d": 2}`,
+			patch:  `[{"op": "replace", "path": "/a~1b", "value": 3}, {"op": "remove", "path": "/c~0d"}]`,
+			want:   `{"a/b": 3}`,
+		},
+		{
+			name:   "replace with null",
+			target: `{"content": "text"}`,
+			patch:  `[{"op": "replace", "path": "/content", "value": null}]`,
+			want:   `{"content": null}`,
+		},
+		{
+			name:   "add null",
+			target: `{"list": [1]}`,
+			patch:  `[{"op": "add", "path": "/a", "value": null}, {"op": "add", "path": "/list/0", "value": null}]`,
+			want:   `{"a": null, "list": [null, 1]}`,
+		},
+		{
+			name:   "test null",
+			target: `{"a": null}`,
+			patch:  `[{"op": "test", "path": "/a", "value": null}]`,
+			want:   `{"a": null}`,
+		},
+		{
+			name:   "replace document",
+			target: `{"a": 1}`,
+			patch:  `[{"op": "add", "path": "", "value": {"b": 2}}]`,
+			want:   `{"b": 2}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(decode(t, tt.target), []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{name: "invalid", patch: `{"op": "add"}`},
+		{name: "unknown operation", patch: `[{"op": "merge", "path": "/a"}]`},
+		{name: "missing value", patch: `[{"op": "add", "path": "/b"}]`},
+		{name: "test against null", patch: `[{"op": "test", "path": "/a/b", "value": null}]`},
+		{name: "missing parent", patch: `[{"op": "add", "path": "/x/y", "value": 1}]`},
+		{name: "replace missing", patch: `[{"op": "replace", "path": "/x", "value": 1}]`},
+		{name: "remove missing", patch: `[{"op": "remove", "path": "/x"}]`},
+		{name: "remove document", patch: `[{"op": "remove", "path": ""}]`},
+		{name: "index out of range", patch: `[{"op": "add", "path": "/list/3", "value": 1}]`},
+		{name: "leading zero", patch: `[{"op": "remove", "path": "/list/01"}]`},
+		{name: "signed index", patch: `[{"op": "remove", "path": "/list/+1"}]`},
+		{name: "negative zero", patch: `[{"op": "remove", "path": "/list/-0"}]`},
+		{name: "end of array", patch: `[{"op": "remove", "path": "/list/-"}]`},
+		{name: "relative pointer", patch: `[{"op": "add", "path": "a", "value": 1}]`},
+		{name: "move into child", patch: `[{"op": "move", "from": "/a", "path": "/a/b"}]`},
+		{name: "scalar document", patch: `[{"op": "add", "path": "", "value": 1}]`},
+		{name: "traverse scalar", patch: `[{"op": "add", "path": "/a/b/c", "value": 1}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := decode(t, `{"a": {"b": 1}, "list": [1, 2]}`)
+			if got, err := Apply(target, []byte(tt.patch)); err == nil {
+				t.Errorf("expected an error, got %v", got)
+			}
+		})
+	}
+}
+
+func TestApplyTestFailed(t *testing.T) {
+	patch := `[{"op": "add", "path": "/b", "value": 2}, {"op": "test", "path": "/a", "value": "1"}]`
+	_, err := Apply(decode(t, `{"a": 1}`), []byte(patch))
+	if !errors.Is(err, ErrTestFailed) {
+		t.Errorf("got %v, want ErrTestFailed", err)
+	}
+}
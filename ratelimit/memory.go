@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in memory. Each replica has its own buckets, so
+// with several replicas clients get that many times the limit.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore that drops full buckets every
+// minute.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{buckets: make(map[string]time.Time)}
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			s.prune(time.Now())
+		}
+	}()
+	return s
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, key string, interval, window time.Duration) (time.Time, time.Time, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	full := s.buckets[key]
+	if full.Before(now) {
+		full = now
+	}
+	full = full.Add(interval)
+	if full.Sub(now) > window {
+		return s.buckets[key], now, false, nil
+	}
+	s.buckets[key] = full
+	return full, now, true, nil
+}
+
+// prune drops buckets that are full, which behave like missing ones.
+func (s *MemoryStore) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, full := range s.buckets {
+		if full.Before(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"notes-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, shared by all
+// replicas. Times are taken from the database clock.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// takeBucketSQL adds interval to a bucket in one statement, unless that would
+// overfill it, in which case no row is returned.
+const takeBucketSQL = `
+INSERT INTO rate_limit_buckets AS b (key, full_at) VALUES (@key, now() + @interval * interval '1 microsecond')
+ON CONFLICT (key) DO UPDATE SET full_at = GREATEST(b.full_at, now()) + @interval * interval '1 microsecond'
+WHERE GREATEST(b.full_at, now()) + @interval * interval '1 microsecond' <= now() + @window * interval '1 microsecond'
+RETURNING full_at, now() AS now`
+
+// NewPostgresStore returns a PostgresStore using db that deletes full
+// buckets every minute. Its queries are not logged, as there is one for
+// every request.
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	if db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	s := &PostgresStore{db: db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})}
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			if err := s.db.Where("full_at < now()").Delete(&models.RateLimitBucket{}).Error; err != nil {
+				log.Println("Failed to prune rate limit buckets:", err)
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Take implements Store.
+func (s *PostgresStore) Take(ctx context.Context, key string, interval, window time.Duration) (time.Time, time.Time, bool, error) {
+	var row struct {
+		FullAt time.Time
+		Now    time.Time
+	}
+	db := s.db.WithContext(ctx)
+	res := db.Raw(takeBucketSQL, map[string]interface{}{
+		"key":      key,
+		"interval": interval.Microseconds(),
+		"window":   window.Microseconds(),
+	}).Scan(&row)
+	if res.Error != nil {
+		return time.Time{}, time.Time{}, false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return row.FullAt, row.Now, true, nil
+	}
+
+	// Refused; read the bucket to tell the client when to retry
+	err := db.Raw("SELECT full_at, now() AS now FROM rate_limit_buckets WHERE key = ?", key).Scan(&row).Error
+	return row.FullAt, row.Now, false, err
+}
@@ -0,0 +1,165 @@
+// Package ratelimit limits how often clients may call the API. Each key gets
+// a token bucket that holds Policy.Limit requests and refills over
+// Policy.Period. Buckets are kept as the generic cell rate algorithm (GCRA)
+// does: as the time the bucket will next be full, which is a single value
+// that every Store can update atomically.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Policy allows Limit requests per Period, in bursts of up to Limit.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// Enabled reports whether the policy limits anything. A policy allowing
+// more than one request per nanosecond cannot be kept, so limits nothing.
+func (p Policy) Enabled() bool {
+	return p.Limit > 0 && p.Period > 0 && p.interval() > 0
+}
+
+// interval is the time it takes the bucket to regain one request.
+func (p Policy) interval() time.Duration {
+	return p.Period / time.Duration(p.Limit)
+}
+
+// Default policies, which the environment can override; see Load
+var (
+	// Auth covers logins and other unauthenticated account endpoints
+	Auth = Policy{Name: "auth", Limit: 10, Period: time.Minute}
+	// API covers every API request
+	API = Policy{Name: "api", Limit: 300, Period: time.Minute}
+	// Heavy covers endpoints that start background exports and imports
+	Heavy = Policy{Name: "heavy", Limit: 20, Period: time.Hour}
+)
+
+// Result is the outcome of taking a request from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a refused request would be allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps buckets. Take admits a request for key if the time its bucket
+// will be full, after adding interval for this request, is at most window
+// from now. It returns that time as stored after the call, and the store's
+// clock, which replicas share.
+type Store interface {
+	Take(ctx context.Context, key string, interval, window time.Duration) (full, now time.Time, allowed bool, err error)
+}
+
+var store Store = NewMemoryStore()
+
+// SetStore sets the store buckets are kept in.
+func SetStore(s Store) {
+	store = s
+}
+
+// Take takes a request for key from its bucket under policy.
+// Requests under a policy that is not enabled are always allowed.
+func Take(ctx context.Context, key string, p Policy) (Result, error) {
+	if !p.Enabled() {
+		return Result{Allowed: true, Limit: p.Limit, Remaining: p.Limit}, nil
+	}
+	interval := p.interval()
+	window := time.Duration(p.Limit) * interval
+	full, now, allowed, err := store.Take(ctx, p.Name+":"+key, interval, window)
+	if err != nil {
+		return Result{}, err
+	}
+	if full.Before(now) {
+		full = now
+	}
+
+	result := Result{Allowed: allowed, Limit: p.Limit, Reset: full.Sub(now)}
+	result.Remaining = int((window - result.Reset) / interval)
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if !allowed {
+		result.RetryAfter = full.Add(interval).Add(-window).Sub(now)
+	}
+	return result, nil
+}
+
+// Load configures rate limiting from the environment:
+//
+//   - RATE_LIMIT_STORE selects where buckets are kept: memory (the default,
+//     per replica), postgres (db) or redis (shared by replicas). redis
+//     connects to REDIS_URL.
+//   - RATE_LIMIT_AUTH, RATE_LIMIT_API and RATE_LIMIT_HEAVY override the
+//     policies, as "<requests>/<period>", e.g. "100/1m", or "off".
+func Load(db *gorm.DB) error {
+	for _, policy := range []*Policy{&Auth, &API, &Heavy} {
+		name := "RATE_LIMIT_" + strings.ToUpper(policy.Name)
+		if value := os.Getenv(name); value != "" {
+			limit, period, err := parsePolicy(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			policy.Limit, policy.Period = limit, period
+		}
+	}
+
+	switch kind := os.Getenv("RATE_LIMIT_STORE"); kind {
+	case "", "memory":
+	case "postgres":
+		s, err := NewPostgresStore(db)
+		if err != nil {
+			return err
+		}
+		SetStore(s)
+	case "redis":
+		s, err := NewRedisStore(os.Getenv("REDIS_URL"))
+		if err != nil {
+			return err
+		}
+		SetStore(s)
+	default:
+		return fmt.Errorf("RATE_LIMIT_STORE: unknown store %q", kind)
+	}
+	log.Printf("Rate limits: auth %s, api %s, heavy %s", describe(Auth), describe(API), describe(Heavy))
+	return nil
+}
+
+func parsePolicy(value string) (int, time.Duration, error) {
+	if value == "off" {
+		return 0, 0, nil
+	}
+	requests, per, ok := strings.Cut(value, "/")
+	limit, err := strconv.Atoi(strings.TrimSpace(requests))
+	if !ok || err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("expected <requests>/<period> such as 100/1m, got %q", value)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(per))
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("expected <requests>/<period> such as 100/1m, got %q", value)
+	}
+	if period/time.Duration(limit) == 0 {
+		return 0, 0, fmt.Errorf("%q allows more than one request per nanosecond", value)
+	}
+	return limit, period, nil
+}
+
+func describe(p Policy) string {
+	if !p.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", p.Limit, p.Period)
+}
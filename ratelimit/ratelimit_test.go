@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fixedStore answers every Take with the same outcome, relative to now.
+type fixedStore struct {
+	now     time.Time
+	full    time.Duration
+	allowed bool
+
+	key              string
+	interval, window time.Duration
+}
+
+func (s *fixedStore) Take(_ context.Context, key string, interval, window time.Duration) (time.Time, time.Time, bool, error) {
+	s.key, s.interval, s.window = key, interval, window
+	return s.now.Add(s.full), s.now, s.allowed, nil
+}
+
+func TestTake(t *testing.T) {
+	policy := Policy{Name: "test", Limit: 10, Period: 10 * time.Second}
+	tests := []struct {
+		name       string
+		full       time.Duration
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{name: "first request", full: time.Second, allowed: true, remaining: 9, reset: time.Second},
+		{name: "partly refilled", full: 2500 * time.Millisecond, allowed: true, remaining: 7, reset: 2500 * time.Millisecond},
+		{name: "last request", full: 10 * time.Second, allowed: true, remaining: 0, reset: 10 * time.Second},
+		{name: "empty", full: 10 * time.Second, remaining: 0, reset: 10 * time.Second, retryAfter: time.Second},
+		{name: "almost refilled", full: 9500 * time.Millisecond, remaining: 0, reset: 9500 * time.Millisecond, retryAfter: 500 * time.Millisecond},
+		{name: "full in the past", full: -time.Minute, allowed: true, remaining: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fixedStore{now: time.Unix(1700000000, 0), full: tt.full, allowed: tt.allowed}
+			SetStore(s)
+			defer SetStore(NewMemoryStore())
+
+			result, err := Take(context.Background(), "client", policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.key != "test:client" || s.interval != time.Second || s.window != 10*time.Second {
+				t.Fatalf("store called with %q, %s, %s", s.key, s.interval, s.window)
+			}
+			want := Result{
+				Allowed:    tt.allowed,
+				Limit:      10,
+				Remaining:  tt.remaining,
+				Reset:      tt.reset,
+				RetryAfter: tt.retryAfter,
+			}
+			if result != want {
+				t.Errorf("got %+v, want %+v", result, want)
+			}
+		})
+	}
+}
+
+func TestTakeDisabled(t *testing.T) {
+	s := &fixedStore{}
+	SetStore(s)
+	defer SetStore(NewMemoryStore())
+
+	// A nanosecond period over 10 requests has no interval to wait
+	for _, policy := range []Policy{{Name: "off"}, {Name: "too fine", Limit: 10, Period: time.Nanosecond}} {
+		result, err := Take(context.Background(), "client", policy)
+		if err != nil || !result.Allowed {
+			t.Errorf("%s: got %+v, %v", policy.Name, result, err)
+		}
+	}
+	if s.key != "" {
+		t.Errorf("store called for %q", s.key)
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	s := &MemoryStore{buckets: make(map[string]time.Time)}
+	ctx := context.Background()
+	// With an hour per request the clock barely moves between calls
+	interval, window := time.Hour, 3*time.Hour
+
+	var last time.Time
+	for i := 0; i < 3; i++ {
+		full, now, allowed, err := s.Take(ctx, "a", interval, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !allowed {
+			t.Fatalf("request %d refused", i+1)
+		}
+		if ahead := full.Sub(now); ahead <= time.Duration(i)*interval || ahead > time.Duration(i+1)*interval {
+			t.Errorf("request %d: bucket full in %s", i+1, ahead)
+		}
+		last = full
+	}
+
+	full, _, allowed, err := s.Take(ctx, "a", interval, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed {
+		t.Error("request over the limit allowed")
+	}
+	if !full.Equal(last) {
+		t.Errorf("refused request moved the bucket from %s to %s", last, full)
+	}
+
+	if _, _, allowed, _ := s.Take(ctx, "b", interval, window); !allowed {
+		t.Error("request for another key refused")
+	}
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	s := &MemoryStore{buckets: make(map[string]time.Time)}
+	ctx := context.Background()
+	// A bucket that was emptied long ago behaves like a full one
+	s.buckets["a"] = time.Now().Add(-time.Hour)
+
+	full, now, allowed, err := s.Take(ctx, "a", time.Minute, 2*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowed || full.Sub(now) != time.Minute {
+		t.Errorf("got allowed %v with the bucket full in %s", allowed, full.Sub(now))
+	}
+
+	s.buckets["b"] = time.Now().Add(-time.Second)
+	s.prune(time.Now())
+	if _, ok := s.buckets["b"]; ok {
+		t.Error("full bucket not pruned")
+	}
+	if _, ok := s.buckets["a"]; !ok {
+		t.Error("bucket in use pruned")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		limit   int
+		period  time.Duration
+		wantErr bool
+	}{
+		{value: "100/1m", limit: 100, period: time.Minute},
+		{value: " 5 / 1h ", limit: 5, period: time.Hour},
+		{value: "off"},
+		{value: "100", wantErr: true},
+		{value: "0/1m", wantErr: true},
+		{value: "10/0s", wantErr: true},
+		{value: "2000000000/1s", wantErr: true},
+		{value: "1000000000/1s", limit: 1000000000, period: time.Second},
+		{value: "ten/1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			limit, period, err := parsePolicy(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %d/%s", limit, period)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if limit != tt.limit || period != tt.period {
+				t.Errorf("got %d/%s, want %d/%s", limit, period, tt.limit, tt.period)
+			}
+		})
+	}
+}
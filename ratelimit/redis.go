@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps buckets in Redis, or anything that speaks its protocol
+// and runs Lua scripts, shared by all replicas. Times are taken from the
+// server clock.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// takeBucketScript adds ARGV[1] microseconds to the bucket KEYS[1], unless the
+// bucket would then be full more than ARGV[2] microseconds from now. Buckets
+// expire once full. It returns the bucket, the time and whether it was taken.
+var takeBucketScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local full = tonumber(redis.call('GET', KEYS[1]) or 0)
+if full < now then full = now end
+local taken = full + tonumber(ARGV[1])
+if taken - now > tonumber(ARGV[2]) then
+	return {full, now, 0}
+end
+redis.call('SET', KEYS[1], taken, 'PX', math.ceil((taken - now) / 1000))
+return {taken, now, 1}
+`)
+
+// NewRedisStore returns a RedisStore connected to url, such as
+// redis://localhost:6379/0.
+func NewRedisStore(url string) (*RedisStore, error) {
+	if url == "" {
+		return nil, errors.New("REDIS_URL is not set")
+	}
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: redis.NewClient(options)}, nil
+}
+
+// Take implements Store.
+func (s *RedisStore) Take(ctx context.Context, key string, interval, window time.Duration) (time.Time, time.Time, bool, error) {
+	values, err := takeBucketScript.Run(ctx, s.client, []string{"ratelimit:" + key},
+		interval.Microseconds(), window.Microseconds()).Int64Slice()
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+	if len(values) != 3 {
+		return time.Time{}, time.Time{}, false, errors.New("unexpected rate limit script result")
+	}
+	return time.UnixMicro(values[0]), time.UnixMicro(values[1]), values[2] == 1, nil
+}
@@ -0,0 +1,271 @@
+// Package reminders schedules and fires note reminders. Every replica runs
+// the scheduler; due reminders are claimed with SELECT ... FOR UPDATE SKIP
+// LOCKED, so each occurrence fires on exactly one replica.
+package reminders
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	// The runtime image has no zoneinfo database
+	_ "time/tzdata"
+
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/mailer"
+	"notes-api/models"
+
+	"github.com/teambition/rrule-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollInterval = 15 * time.Second
+	batchSize    = 50
+)
+
+// localLayouts are accepted for remind_at values without a UTC offset.
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"}
+
+// Start runs the scheduler in the background.
+func Start() {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			for {
+				n, err := fireDue(time.Now())
+				if err != nil {
+					log.Println("Failed to fire reminders:", err)
+				}
+				if err != nil || n < batchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// Schedule validates a reminder request and fills in the reminder's schedule.
+func Schedule(reminder *models.Reminder, req models.CreateReminderRequest) error {
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(req.Timezone)
+	if err != nil {
+		return fmt.Errorf("Unknown timezone %q", req.Timezone)
+	}
+
+	start, err := parseTime(req.RemindAt, loc)
+	if err != nil {
+		return errors.New("remind_at must be an RFC 3339 timestamp or a local date-time such as 2006-01-02T15:04")
+	}
+
+	channels := req.Channels
+	if len(channels) == 0 {
+		channels = []string{models.ChannelRealtime}
+	}
+	for _, channel := range channels {
+		switch channel {
+		case models.ChannelRealtime, models.ChannelWebhook, models.ChannelEmail:
+		default:
+			return fmt.Errorf("Unknown channel %q; use realtime, webhook or email", channel)
+		}
+	}
+
+	reminder.Timezone = loc.String()
+	reminder.RRule = strings.TrimPrefix(strings.TrimSpace(req.RRule), "RRULE:")
+	reminder.Channels = channels
+	reminder.Status = models.ReminderScheduled
+	reminder.SnoozedUntil = nil
+	reminder.StartAt = start.UTC()
+	reminder.DueAt = start
+
+	if reminder.RRule != "" {
+		rule, err := parseRule(reminder.RRule, start.In(loc))
+		if err != nil {
+			return err
+		}
+		// DTSTART need not match the rule; the first occurrence may be later
+		first := rule.After(start, true)
+		if first.IsZero() {
+			return errors.New("rrule has no occurrences after remind_at")
+		}
+		reminder.DueAt = first
+	}
+
+	reminder.DueAt = reminder.DueAt.UTC()
+	reminder.NextAt = reminder.DueAt
+	return nil
+}
+
+// Snooze makes a reminder fire again at until. For one-off reminders this
+// moves the reminder; recurring reminders keep their schedule and fire once
+// more in between.
+func Snooze(reminder *models.Reminder, until time.Time) {
+	until = until.UTC()
+	if reminder.RRule == "" || reminder.Status != models.ReminderScheduled {
+		reminder.DueAt = until
+		reminder.SnoozedUntil = nil
+	} else {
+		reminder.SnoozedUntil = &until
+	}
+	reminder.Status = models.ReminderScheduled
+	setNextAt(reminder)
+}
+
+// Dismiss acknowledges a reminder. One-off reminders are done; recurring
+// reminders drop a pending snooze and carry on with their next occurrence.
+func Dismiss(reminder *models.Reminder) {
+	reminder.SnoozedUntil = nil
+	if reminder.RRule == "" || reminder.Status != models.ReminderScheduled {
+		reminder.Status = models.ReminderDismissed
+		return
+	}
+	setNextAt(reminder)
+}
+
+// advance moves a reminder past what fires at now: a due snooze, the due
+// occurrence, or both.
+func advance(reminder *models.Reminder, now time.Time) {
+	if reminder.SnoozedUntil != nil && !reminder.SnoozedUntil.After(now) {
+		reminder.SnoozedUntil = nil
+		if reminder.DueAt.After(now) {
+			setNextAt(reminder)
+			return
+		}
+	}
+
+	next := time.Time{}
+	if reminder.RRule != "" {
+		loc, err := time.LoadLocation(reminder.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		if rule, err := parseRule(reminder.RRule, reminder.StartAt.In(loc)); err == nil {
+			// Skips occurrences missed while no scheduler was running
+			next = rule.After(now, false)
+		}
+	}
+
+	switch {
+	case !next.IsZero():
+		reminder.DueAt = next.UTC()
+	case reminder.SnoozedUntil != nil:
+		// The rule has run out, but a snooze is still pending
+		reminder.DueAt = *reminder.SnoozedUntil
+		reminder.SnoozedUntil = nil
+	default:
+		reminder.Status = models.ReminderFired
+	}
+	setNextAt(reminder)
+}
+
+func setNextAt(reminder *models.Reminder) {
+	reminder.NextAt = reminder.DueAt
+	if reminder.SnoozedUntil != nil && reminder.SnoozedUntil.Before(reminder.NextAt) {
+		reminder.NextAt = *reminder.SnoozedUntil
+	}
+}
+
+// fireDue claims due reminders, moves them to their next occurrence and then
+// delivers them. It returns how many reminders fired.
+func fireDue(now time.Time) (int, error) {
+	var fired []models.Reminder
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var due []models.Reminder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_at <= ?", models.ReminderScheduled, now).
+			Order("next_at").Limit(batchSize).Find(&due).Error; err != nil {
+			return err
+		}
+
+		for i := range due {
+			reminder := due[i]
+			reminder.LastFiredAt = &now
+			fired = append(fired, reminder)
+
+			advance(&due[i], now)
+			due[i].LastFiredAt = &now
+			if err := tx.Save(&due[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Delivery happens after the claim is committed: a crash in between
+	// loses this occurrence rather than sending it twice
+	for i := range fired {
+		deliver(&fired[i])
+	}
+	return len(fired), nil
+}
+
+func deliver(reminder *models.Reminder) {
+	var note models.Note
+	if err := database.DB.Where("id = ?", reminder.NoteID).First(&note).Error; err != nil {
+		log.Printf("Reminder %s: note %s not found", reminder.ID, reminder.NoteID)
+		return
+	}
+
+	if reminder.Notifies(models.ChannelRealtime) || reminder.Notifies(models.ChannelWebhook) {
+		events.Publish(events.Event{
+			Type:     events.ReminderDue,
+			UserID:   reminder.UserID,
+			NoteID:   note.ID,
+			Note:     events.Snapshot(&note),
+			Reminder: reminder,
+		})
+	}
+
+	if reminder.Notifies(models.ChannelEmail) {
+		var user models.User
+		if err := database.DB.Where("id = ?", reminder.UserID).First(&user).Error; err != nil {
+			log.Printf("Reminder %s: user not found", reminder.ID)
+			return
+		}
+		loc, err := time.LoadLocation(reminder.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		body := fmt.Sprintf("Reminder for your note \"%s\", due %s.\n\n%s\n",
+			note.Title, reminder.DueAt.In(loc).Format("Mon, 02 Jan 2006 15:04 MST"), note.Content)
+		if err := mailer.Send(user.Email, "Reminder: "+note.Title, body); err != nil {
+			log.Printf("Reminder %s: failed to send email: %v", reminder.ID, err)
+		}
+	}
+}
+
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid time")
+}
+
+func parseRule(value string, dtstart time.Time) (*rrule.RRule, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return nil, errors.New("rrule must be a single RRULE line without DTSTART")
+	}
+	option, err := rrule.StrToROptionInLocation(value, dtstart.Location())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid rrule: %v", err)
+	}
+	if option.Freq == rrule.SECONDLY || option.Freq == rrule.MINUTELY {
+		return nil, errors.New("rrule must not repeat more often than hourly")
+	}
+	option.Dtstart = dtstart
+	return rrule.NewRRule(*option)
+}
@@ -0,0 +1,84 @@
+// Package render turns note content into sanitized HTML, so every client
+// displays a note the same way.
+package render
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// Content formats
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// ValidFormat reports whether format is a known content format.
+func ValidFormat(format string) bool {
+	return format == FormatPlain || format == FormatMarkdown
+}
+
+// markdown renders CommonMark with the GitHub extensions: tables, task lists,
+// strikethrough and autolinks. Raw HTML in the source is dropped.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+var policy = newPolicy()
+
+var paragraphBreak = regexp.MustCompile(`\n{2,}`)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// Task list checkboxes
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	// Language hints on fenced code blocks, for client-side highlighting
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+	return p
+}
+
+// HTML renders content in the given format as sanitized HTML. Plain text is
+// escaped, with blank lines separating paragraphs.
+func HTML(format, content string) (string, error) {
+	if format != FormatMarkdown {
+		return plainHTML(content), nil
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(content), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+func plainHTML(content string) string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var b strings.Builder
+	for _, paragraph := range paragraphBreak.Split(content, -1) {
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		lines := strings.Split(paragraph, "\n")
+		for i := range lines {
+			lines[i] = html.EscapeString(lines[i])
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.Join(lines, "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+// Parse parses Markdown content into a syntax tree, with the same extensions
+// HTML renders. It returns the source the tree's segments refer to.
+func Parse(content string) (ast.Node, []byte) {
+	source := []byte(content)
+	return markdown.Parser().Parse(text.NewReader(source)), source
+}
@@ -3,6 +3,8 @@ package routes
 import (
 	"notes-api/handlers"
 	"notes-api/middleware"
+	"notes-api/models"
+	"notes-api/ratelimit"
 
 	"github.com/gofiber/fiber/v2"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
@@ -20,19 +22,118 @@ func SetupRoutes(app *fiber.App) {
 			"endpoints": fiber.Map{
 				"auth": fiber.Map{
 					"register": "POST /api/auth/register",
-					"login":    "POST /api/auth/login",
+					"login":          "POST /api/auth/login",
+					"confirm_email":  "POST /api/auth/confirm-email",
+					"unlock":         "POST /api/auth/unlock",
+					"reset_password": "POST /api/auth/reset-password",
+					"jwks":           "GET /.well-known/jwks.json",
+				},
+				"account": fiber.Map{
+					"get":             "GET /api/account/me",
+					"update":          "PATCH /api/account/me",
+					"change_password": "POST /api/account/password",
+					"change_email":    "POST /api/account/email",
+					"verify_email":    "POST /api/account/email/verify",
+					"export":          "POST /api/account/export",
+					"sessions":        "GET /api/account/sessions",
+					"revoke_session":  "DELETE /api/account/sessions/:id",
+					"revoke_others":   "DELETE /api/account/sessions",
+					"delete":          "DELETE /api/account",
+				},
+				"admin": fiber.Map{
+					"users":          "GET /api/admin/users",
+					"user":           "GET /api/admin/users/:id",
+					"delete_user":    "DELETE /api/admin/users/:id",
+					"disable":        "POST /api/admin/users/:id/disable",
+					"enable":         "POST /api/admin/users/:id/enable",
+					"role":           "PATCH /api/admin/users/:id/role",
+					"password_reset": "POST /api/admin/users/:id/password-reset",
+					"user_notes":     "GET /api/admin/users/:id/notes",
+					"delete_note":    "DELETE /api/admin/notes/:id",
+					"storage":        "GET /api/admin/storage",
+					"audit":          "GET /api/admin/audit",
 				},
 				"notes": fiber.Map{
-					"list":   "GET /api/notes",
-					"get":    "GET /api/notes/:id",
-					"create": "POST /api/notes",
-					"update": "PUT /api/notes/:id",
-					"delete": "DELETE /api/notes/:id",
+					"list":      "GET /api/notes",
+					"get":       "GET /api/notes/:id",
+					"create":    "POST /api/notes",
+					"update":    "PUT /api/notes/:id",
+					"patch":     "PATCH /api/notes/:id",
+					"delete":    "DELETE /api/notes/:id",
+					"reorder":   "PUT /api/notes/order",
+					"batch":     "POST /api/notes/batch",
+					"export":    "POST /api/notes/export",
+					"import":    "POST /api/notes/import",
+					"pin":       "POST /api/notes/:id/pin",
+					"unpin":     "POST /api/notes/:id/unpin",
+					"star":      "POST /api/notes/:id/star",
+					"unstar":    "POST /api/notes/:id/unstar",
+					"archive":   "POST /api/notes/:id/archive",
+					"unarchive": "POST /api/notes/:id/unarchive",
+					"links":     "GET /api/notes/:id/links",
+					"backlinks": "GET /api/notes/:id/backlinks",
+					"document":  "GET /api/notes/:id/export",
+				},
+				"checklists": fiber.Map{
+					"add":     "POST /api/notes/:id/items",
+					"update":  "PATCH /api/notes/:id/items/:itemId",
+					"toggle":  "POST /api/notes/:id/items/:itemId/toggle",
+					"reorder": "PUT /api/notes/:id/items/order",
+					"delete":  "DELETE /api/notes/:id/items/:itemId",
+				},
+				"properties": fiber.Map{
+					"list":   "GET /api/properties",
+					"create": "POST /api/properties",
+					"update": "PATCH /api/properties/:id",
+					"delete": "DELETE /api/properties/:id",
+				},
+				"templates": fiber.Map{
+					"list":        "GET /api/templates",
+					"get":         "GET /api/templates/:id",
+					"create":      "POST /api/templates",
+					"update":      "PATCH /api/templates/:id",
+					"delete":      "DELETE /api/templates/:id",
+					"create_note": "POST /api/templates/:id/notes",
+				},
+				"reminders": fiber.Map{
+					"list":     "GET /api/reminders",
+					"for_note": "GET /api/notes/:id/reminders",
+					"create":   "POST /api/notes/:id/reminders",
+					"snooze":   "POST /api/reminders/:id/snooze",
+					"dismiss":  "POST /api/reminders/:id/dismiss",
+					"delete":   "DELETE /api/reminders/:id",
+				},
+				"realtime": fiber.Map{
+					"websocket": "GET /api/ws",
+					"sse":       "GET /api/events",
+					"collab":    "GET /api/collab/:id",
+				},
+				"webhooks": fiber.Map{
+					"list":       "GET /api/webhooks",
+					"create":     "POST /api/webhooks",
+					"get":        "GET /api/webhooks/:id",
+					"update":     "PATCH /api/webhooks/:id",
+					"delete":     "DELETE /api/webhooks/:id",
+					"deliveries": "GET /api/webhooks/:id/deliveries",
+					"redeliver":  "POST /api/webhooks/:id/deliveries/:deliveryId/redeliver",
+					"test":       "POST /api/webhooks/:id/test",
+				},
+				"sync": fiber.Map{
+					"changes": "GET /api/sync?since=:token",
+					"push":    "POST /api/sync/push",
+				},
+				"jobs": fiber.Map{
+					"list":     "GET /api/jobs",
+					"get":      "GET /api/jobs/:id",
+					"download": "GET /api/jobs/:id/download",
 				},
 			},
 		})
 	})
 
+	// Public keys for verifying tokens
+	app.Get("/.well-known/jwks.json", handlers.JWKS)
+
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
 	
 	app.Get("/swagger", func(c *fiber.Ctx) error {
@@ -41,11 +142,46 @@ func SetupRoutes(app *fiber.App) {
 
 	// API group
 	api := app.Group("/api")
+	api.Use(middleware.RateLimit(ratelimit.API))
+	heavy := middleware.RateLimit(ratelimit.Heavy)
 
-	// Auth routes
+	// Auth routes, limited more strictly against password guessing
 	auth := api.Group("/auth")
+	auth.Use(middleware.RateLimit(ratelimit.Auth))
 	auth.Post("/register", handlers.Register)
 	auth.Post("/login", handlers.Login)
+	auth.Post("/confirm-email", handlers.ConfirmEmail)
+	auth.Post("/unlock", handlers.UnlockAccount)
+	auth.Post("/reset-password", handlers.ResetPassword)
+
+	// Account routes (protected)
+	account := api.Group("/account")
+	account.Use(middleware.Protected())
+	account.Get("/me", handlers.GetAccount)
+	account.Patch("/me", handlers.UpdateAccount)
+	account.Post("/password", handlers.ChangePassword)
+	account.Post("/email", handlers.ChangeEmail)
+	account.Post("/email/verify", handlers.VerifyEmail)
+	account.Post("/export", heavy, handlers.ExportAccount)
+	account.Get("/sessions", handlers.ListSessions)
+	account.Delete("/sessions", handlers.RevokeOtherSessions)
+	account.Delete("/sessions/:id", handlers.RevokeSession)
+	account.Delete("/", handlers.DeleteAccount)
+
+	// Admin routes (protected, administrators only)
+	admin := api.Group("/admin")
+	admin.Use(middleware.Protected(), middleware.RequireRole(models.RoleAdmin))
+	admin.Get("/users", handlers.ListUsers)
+	admin.Get("/users/:id", handlers.GetUser)
+	admin.Delete("/users/:id", handlers.AdminDeleteUser)
+	admin.Post("/users/:id/disable", handlers.DisableUser)
+	admin.Post("/users/:id/enable", handlers.EnableUser)
+	admin.Patch("/users/:id/role", handlers.SetUserRole)
+	admin.Post("/users/:id/password-reset", handlers.ForcePasswordReset)
+	admin.Get("/users/:id/notes", handlers.ListUserNotes)
+	admin.Delete("/notes/:id", handlers.AdminDeleteNote)
+	admin.Get("/storage", handlers.GetStorage)
+	admin.Get("/audit", handlers.ListAuditLog)
 
 	// Protected routes
 	notes := api.Group("/notes")
@@ -53,6 +189,77 @@ func SetupRoutes(app *fiber.App) {
 	notes.Get("/", handlers.GetNotes)
 	notes.Get("/:id", handlers.GetNote)
 	notes.Post("/", handlers.CreateNote)
+	notes.Put("/order", handlers.ReorderNotes)
+	notes.Post("/batch", handlers.BatchNotes)
+	notes.Post("/export", heavy, handlers.ExportNotes)
+	notes.Post("/import", heavy, handlers.ImportNotes)
 	notes.Put("/:id", handlers.UpdateNote)
+	notes.Patch("/:id", handlers.PatchNote)
 	notes.Delete("/:id", handlers.DeleteNote)
+	notes.Post("/:id/pin", handlers.PinNote)
+	notes.Post("/:id/unpin", handlers.UnpinNote)
+	notes.Post("/:id/star", handlers.StarNote)
+	notes.Post("/:id/unstar", handlers.UnstarNote)
+	notes.Post("/:id/archive", handlers.ArchiveNote)
+	notes.Post("/:id/unarchive", handlers.UnarchiveNote)
+	notes.Get("/:id/links", handlers.GetNoteLinks)
+	notes.Get("/:id/backlinks", handlers.GetNoteBacklinks)
+	notes.Get("/:id/export", handlers.ExportNote)
+	notes.Post("/:id/items", handlers.AddChecklistItem)
+	notes.Put("/:id/items/order", handlers.ReorderChecklistItems)
+	notes.Patch("/:id/items/:itemId", handlers.UpdateChecklistItem)
+	notes.Post("/:id/items/:itemId/toggle", handlers.ToggleChecklistItem)
+	notes.Delete("/:id/items/:itemId", handlers.DeleteChecklistItem)
+	notes.Get("/:id/reminders", handlers.ListNoteReminders)
+	notes.Post("/:id/reminders", handlers.CreateReminder)
+
+	properties := api.Group("/properties")
+	properties.Use(middleware.Protected())
+	properties.Get("/", handlers.ListPropertySchemas)
+	properties.Post("/", handlers.CreatePropertySchema)
+	properties.Patch("/:id", handlers.UpdatePropertySchema)
+	properties.Delete("/:id", handlers.DeletePropertySchema)
+
+	tmpls := api.Group("/templates")
+	tmpls.Use(middleware.Protected())
+	tmpls.Get("/", handlers.ListTemplates)
+	tmpls.Post("/", handlers.CreateTemplate)
+	tmpls.Get("/:id", handlers.GetTemplate)
+	tmpls.Patch("/:id", handlers.UpdateTemplate)
+	tmpls.Delete("/:id", handlers.DeleteTemplate)
+	tmpls.Post("/:id/notes", handlers.CreateNoteFromTemplate)
+
+	reminders := api.Group("/reminders")
+	reminders.Use(middleware.Protected())
+	reminders.Get("/", handlers.ListReminders)
+	reminders.Post("/:id/snooze", handlers.SnoozeReminder)
+	reminders.Post("/:id/dismiss", handlers.DismissReminder)
+	reminders.Delete("/:id", handlers.DeleteReminder)
+
+	sync := api.Group("/sync")
+	sync.Use(middleware.Protected())
+	sync.Get("/", handlers.GetSyncChanges)
+	sync.Post("/push", handlers.PushSyncChanges)
+
+	hooks := api.Group("/webhooks")
+	hooks.Use(middleware.Protected())
+	hooks.Get("/", handlers.ListWebhooks)
+	hooks.Post("/", handlers.CreateWebhook)
+	hooks.Get("/:id", handlers.GetWebhook)
+	hooks.Patch("/:id", handlers.UpdateWebhook)
+	hooks.Delete("/:id", handlers.DeleteWebhook)
+	hooks.Get("/:id/deliveries", handlers.ListWebhookDeliveries)
+	hooks.Post("/:id/deliveries/:deliveryId/redeliver", handlers.RedeliverWebhook)
+	hooks.Post("/:id/test", handlers.TestWebhook)
+
+	// The download link also works in browsers, with ?access_token=
+	jobs := api.Group("/jobs")
+	jobs.Get("/", middleware.Protected(), handlers.ListJobs)
+	jobs.Get("/:id", middleware.Protected(), handlers.GetJob)
+	jobs.Get("/:id/download", middleware.ProtectedStream(), handlers.DownloadJob)
+
+	// Realtime routes
+	api.Get("/ws", middleware.ProtectedStream(), handlers.WebSocketUpgrade, handlers.NoteEventsSocket)
+	api.Get("/events", middleware.ProtectedStream(), handlers.StreamEvents)
+	api.Get("/collab/:id", middleware.ProtectedStream(), handlers.WebSocketUpgrade, handlers.CollabSession)
 }
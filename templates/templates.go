@@ -0,0 +1,119 @@
+// Package templates expands note templates and defines the system templates
+// every user can start from.
+package templates
+
+import (
+	"regexp"
+	"time"
+
+	"notes-api/models"
+
+	"github.com/google/uuid"
+)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// Variables returns the built-in placeholder values for user at now.
+func Variables(user *models.User, now time.Time) map[string]string {
+	return map[string]string{
+		"date":       now.Format("2006-01-02"),
+		"time":       now.Format("15:04"),
+		"datetime":   now.Format("2006-01-02 15:04"),
+		"weekday":    now.Format("Monday"),
+		"year":       now.Format("2006"),
+		"user.name":  user.Name,
+		"user.email": user.Email,
+	}
+}
+
+// Expand replaces {{name}} placeholders with their values. Placeholders
+// without a value are left as they are.
+func Expand(text string, vars map[string]string) string {
+	return placeholder.ReplaceAllStringFunc(text, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// System lists the templates shared by all users. Their IDs are fixed so
+// migrations can update them in place.
+var System = []models.Template{
+	{
+		ID:          uuid.MustParse("6d0f5c1e-3b52-4c41-9a57-1f2f0f6f0001"),
+		Name:        "Meeting notes",
+		Description: "Agenda, attendees, discussion and action items",
+		Title:       "Meeting notes {{date}}",
+		Content: `**Date:** {{date}} {{time}}
+**Facilitator:** {{user.name}}
+
+## Attendees
+
+-
+
+## Agenda
+
+1.
+
+## Discussion
+
+## Action items
+
+- [ ] `,
+		Format: "markdown",
+		Type:   models.NoteTypeNote,
+	},
+	{
+		ID:          uuid.MustParse("6d0f5c1e-3b52-4c41-9a57-1f2f0f6f0002"),
+		Name:        "Incident report",
+		Description: "Summary, impact, timeline, root cause and follow-ups",
+		Title:       "Incident {{date}}: {{summary}}",
+		Content: `**Reported by:** {{user.name}}
+**Started:** {{datetime}}
+**Severity:** {{severity}}
+
+## Summary
+
+{{summary}}
+
+## Impact
+
+## Timeline
+
+- {{time}} Incident detected
+
+## Root cause
+
+## Resolution
+
+## Follow-ups
+
+- [ ] `,
+		Format: "markdown",
+		Type:   models.NoteTypeNote,
+	},
+	{
+		ID:          uuid.MustParse("6d0f5c1e-3b52-4c41-9a57-1f2f0f6f0003"),
+		Name:        "Daily journal",
+		Description: "A page for the day",
+		Title:       "{{weekday}}, {{date}}",
+		Content: `## Today
+
+## Notes
+
+## Tomorrow
+`,
+		Format: "markdown",
+		Type:   models.NoteTypeNote,
+	},
+	{
+		ID:          uuid.MustParse("6d0f5c1e-3b52-4c41-9a57-1f2f0f6f0004"),
+		Name:        "To-do list",
+		Description: "An empty checklist",
+		Title:       "To do {{date}}",
+		Format:      "plain",
+		Type:        models.NoteTypeChecklist,
+	},
+}
@@ -0,0 +1,77 @@
+package tokens
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix marks private keys stored encrypted with AES-256-GCM.
+const encryptedPrefix = "aes256gcm:"
+
+// keyCipher encrypts private keys at rest. It is nil when
+// JWT_KEY_ENCRYPTION_KEY is not set, and keys are stored as plain PEM.
+var keyCipher cipher.AEAD
+
+// setupEncryption reads JWT_KEY_ENCRYPTION_KEY, 32 base64-encoded bytes.
+func setupEncryption() error {
+	value := os.Getenv("JWT_KEY_ENCRYPTION_KEY")
+	if value == "" {
+		return nil
+	}
+	secret, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(secret) != 32 {
+		return errors.New("JWT_KEY_ENCRYPTION_KEY: expected 32 base64-encoded bytes")
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return err
+	}
+	keyCipher, err = cipher.NewGCM(block)
+	return err
+}
+
+// sealKey encrypts a PEM-encoded private key for storage, if encryption is
+// set up. id is authenticated with it, so a key cannot be moved to another
+// row.
+func sealKey(id, pemKey string) (string, error) {
+	if keyCipher == nil {
+		return pemKey, nil
+	}
+	nonce := make([]byte, keyCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := keyCipher.Seal(nonce, nonce, []byte(pemKey), []byte(id))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openKey returns the PEM-encoded private key of a stored one.
+func openKey(id, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	if keyCipher == nil {
+		return "", errors.New("key is encrypted, but JWT_KEY_ENCRYPTION_KEY is not set")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil || len(sealed) < keyCipher.NonceSize() {
+		return "", errors.New("invalid encrypted key")
+	}
+	nonce, ciphertext := sealed[:keyCipher.NonceSize()], sealed[keyCipher.NonceSize():]
+	plain, err := keyCipher.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("decrypting key: %w", err)
+	}
+	return string(plain), nil
+}
+
+// encrypted reports whether a stored private key is encrypted.
+func encrypted(stored string) bool {
+	return strings.HasPrefix(stored, encryptedPrefix)
+}
@@ -0,0 +1,436 @@
+// Package tokens signs and verifies the JWTs the API issues. Tokens are
+// signed with RS256 or EdDSA keys kept in the database, so that every
+// replica uses the same ones, and each token names its key in the kid
+// header. Keys are rotated on a schedule: a new key is published a day
+// before it starts signing, so services caching the key set from
+// /.well-known/jwks.json learn it in time, and old keys keep verifying until
+// the tokens they signed have expired.
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"notes-api/database"
+	"notes-api/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// Signing algorithms
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+const (
+	// DefaultRotation is how often a new key takes over signing.
+	DefaultRotation = 30 * 24 * time.Hour
+	// prepublish is how long a new key is published before it signs.
+	prepublish = 24 * time.Hour
+	// checkInterval is how often keys are checked for rotation, and reloaded
+	// to pick up keys created by other replicas.
+	checkInterval = time.Hour
+	// reloadInterval limits reloads for tokens naming an unknown key.
+	reloadInterval = time.Minute
+	rsaBits        = 2048
+	// rotationLock serializes rotation across replicas.
+	rotationLock = 4829170355
+)
+
+// ErrUnknownKey is returned for tokens signed with a key that is not known,
+// or has expired.
+var ErrUnknownKey = errors.New("token signed with an unknown key")
+
+// key is a loaded signing key.
+type key struct {
+	id         string
+	method     jwt.SigningMethod
+	private    crypto.Signer
+	activeFrom time.Time
+}
+
+var (
+	mu         sync.RWMutex
+	keys       []*key // by ActiveFrom
+	reloadedAt time.Time
+	// legacyUntil is when tokens signed with JWT_SECRET stop being accepted
+	legacyUntil time.Time
+
+	algorithm = RS256
+	rotation  = DefaultRotation
+	lifetime  time.Duration
+
+	warnedSecret bool
+)
+
+// Start sets up signing keys for tokens that last tokenLifetime, creating
+// the first key if there is none, and rotates them in the background.
+//
+// JWT_ALGORITHM selects RS256 (the default) or EdDSA for new keys, and
+// JWT_KEY_ROTATION how often they are rotated (default 720h). Changing the
+// algorithm rotates to a key of the new kind. With JWT_KEY_ENCRYPTION_KEY
+// set, private keys are stored encrypted with it.
+func Start(tokenLifetime time.Duration) error {
+	lifetime = tokenLifetime
+	if err := setupEncryption(); err != nil {
+		return err
+	}
+	if value := os.Getenv("JWT_ALGORITHM"); value != "" {
+		if value != RS256 && value != EdDSA {
+			return fmt.Errorf("JWT_ALGORITHM: expected %s or %s, got %q", RS256, EdDSA, value)
+		}
+		algorithm = value
+	}
+	if value := os.Getenv("JWT_KEY_ROTATION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 2*time.Hour {
+			return fmt.Errorf("JWT_KEY_ROTATION: expected a duration of at least 2h, got %q", value)
+		}
+		rotation = d
+	}
+
+	if err := rotate(time.Now()); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			time.Sleep(checkInterval)
+			if err := rotate(time.Now()); err != nil {
+				log.Println("Failed to rotate signing keys:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// rotate creates the next key once the signing key is due to be replaced,
+// forgets expired keys and loads the rest.
+func rotate(now time.Time) error {
+	// A key is published for prepublish before it signs, but for at most
+	// half the rotation period
+	lead := prepublish
+	if lead > rotation/2 {
+		lead = rotation / 2
+	}
+
+	var stored []models.SigningKey
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", rotationLock).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at IS NULL OR expires_at > ?", now).Order("active_from").Find(&stored).Error; err != nil {
+			return err
+		}
+		// Keys stored before encryption was set up are encrypted now
+		if keyCipher != nil {
+			for i := range stored {
+				if encrypted(stored[i].PrivateKey) {
+					continue
+				}
+				sealed, err := sealKey(stored[i].ID, stored[i].PrivateKey)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&stored[i]).Update("private_key", sealed).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		var next *models.SigningKey
+		var err error
+		if len(stored) == 0 {
+			if next, err = newKey(now); err == nil {
+				until := now.Add(lifetime)
+				next.LegacyUntil = &until
+			}
+		} else if newest := &stored[len(stored)-1]; !newest.ActiveFrom.After(now) {
+			// The newest key is signing; schedule its successor when it is
+			// due, or right away for a change of algorithm
+			activeFrom := newest.ActiveFrom.Add(rotation)
+			if newest.Algorithm != algorithm {
+				activeFrom = now
+			}
+			if !now.Before(activeFrom.Add(-lead)) {
+				if earliest := now.Add(lead); activeFrom.Before(earliest) {
+					activeFrom = earliest
+				}
+				if next, err = newKey(activeFrom); err == nil {
+					next.LegacyUntil = newest.LegacyUntil
+					expires := activeFrom.Add(lifetime)
+					err = tx.Model(newest).Update("expires_at", expires).Error
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if next != nil {
+			if err := tx.Create(next).Error; err != nil {
+				return err
+			}
+			stored = append(stored, *next)
+			log.Printf("Created %s signing key %s, signing from %s", next.Algorithm, next.ID, next.ActiveFrom.Format(time.RFC3339))
+		}
+		return tx.Where("expires_at <= ?", now).Delete(&models.SigningKey{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := load(stored, now); err != nil {
+		return err
+	}
+	if os.Getenv("JWT_SECRET") != "" && !now.Before(legacyCutoff()) && !warnedSecret {
+		warnedSecret = true
+		log.Println("Warning: JWT_SECRET is still set, but every token signed with it has expired; unset it")
+	}
+	return nil
+}
+
+// reload loads the keys from the database, for a token naming a key another
+// replica has just created. It does so at most once per reloadInterval.
+func reload() {
+	now := time.Now()
+	mu.Lock()
+	due := now.Sub(reloadedAt) >= reloadInterval
+	if due {
+		reloadedAt = now
+	}
+	mu.Unlock()
+	if !due {
+		return
+	}
+
+	var stored []models.SigningKey
+	if err := database.DB.Where("expires_at IS NULL OR expires_at > ?", now).Order("active_from").Find(&stored).Error; err != nil {
+		log.Println("Failed to reload signing keys:", err)
+		return
+	}
+	if err := load(stored, now); err != nil {
+		log.Println("Failed to reload signing keys:", err)
+	}
+}
+
+func load(stored []models.SigningKey, now time.Time) error {
+	loaded := make([]*key, 0, len(stored))
+	var until time.Time
+	for _, s := range stored {
+		k, err := parseKey(s)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", s.ID, err)
+		}
+		loaded = append(loaded, k)
+		if s.LegacyUntil != nil && s.LegacyUntil.After(until) {
+			until = *s.LegacyUntil
+		}
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].activeFrom.Before(loaded[j].activeFrom) })
+
+	mu.Lock()
+	keys = loaded
+	legacyUntil = until
+	reloadedAt = now
+	mu.Unlock()
+	return nil
+}
+
+// newKey generates a key of the configured algorithm that signs from
+// activeFrom.
+func newKey(activeFrom time.Time) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		private, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	kid := hex.EncodeToString(id)
+	sealed, err := sealKey(kid, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+	if err != nil {
+		return nil, err
+	}
+	return &models.SigningKey{
+		ID:         kid,
+		Algorithm:  algorithm,
+		PrivateKey: sealed,
+		ActiveFrom: activeFrom,
+	}, nil
+}
+
+func parseKey(s models.SigningKey) (*key, error) {
+	pemKey, err := openKey(s.ID, s.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &key{id: s.ID, activeFrom: s.ActiveFrom}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.private = jwt.SigningMethodRS256, private
+	case ed25519.PrivateKey:
+		k.method, k.private = jwt.SigningMethodEdDSA, private
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	if k.method.Alg() != s.Algorithm {
+		return nil, fmt.Errorf("%s key stored as %s", k.method.Alg(), s.Algorithm)
+	}
+	return k, nil
+}
+
+// Sign returns a token carrying claims, signed with the current key.
+func Sign(claims jwt.Claims) (string, error) {
+	now := time.Now()
+	mu.RLock()
+	var signing *key
+	for _, k := range keys {
+		if !k.activeFrom.After(now) {
+			signing = k
+		}
+	}
+	mu.RUnlock()
+	if signing == nil {
+		return "", errors.New("no signing key")
+	}
+
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = signing.id
+	return token.SignedString(signing.private)
+}
+
+// Keyfunc returns the key that verifies token, for jwt.Parse.
+//
+// Tokens without a kid were signed with HS256 and JWT_SECRET before keys
+// were rotated. They are accepted while JWT_SECRET is set, until one token
+// lifetime after the first key took over, and only if they were issued
+// before then; once that has passed, none are.
+func Keyfunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+	if id == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" || token.Method != jwt.SigningMethodHS256 || !legacyClaims(token.Claims, time.Now()) {
+			return nil, ErrUnknownKey
+		}
+		return []byte(secret), nil
+	}
+
+	k := find(id)
+	if k == nil {
+		reload()
+		k = find(id)
+	}
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("token signed with %s, but key %s is %s", token.Method.Alg(), id, k.method.Alg())
+	}
+	return k.private.Public(), nil
+}
+
+// legacyCutoff returns when tokens signed with JWT_SECRET stop being
+// accepted, as stored with the keys. It is zero when the keys predate it.
+func legacyCutoff() time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	return legacyUntil
+}
+
+// legacyClaims reports whether a token without a kid is still accepted at
+// now, having the claims of a token issued before the first key took over.
+func legacyClaims(claims jwt.Claims, now time.Time) bool {
+	until := legacyCutoff()
+	if !now.Before(until) {
+		return false
+	}
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	exp, ok := mapClaims["exp"].(float64)
+	if !ok {
+		return false
+	}
+	if time.Unix(int64(exp), 0).After(until) {
+		return false
+	}
+	if iat, ok := mapClaims["iat"].(float64); ok && !time.Unix(int64(iat), 0).Before(until.Add(-lifetime)) {
+		return false
+	}
+	return true
+}
+
+func find(id string) *key {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, k := range keys {
+		if k.id == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// Parse verifies a token and returns it.
+func Parse(raw string) (*jwt.Token, error) {
+	return jwt.Parse(raw, Keyfunc)
+}
+
+// KeySet returns the public keys tokens are or will soon be signed with.
+func KeySet() models.JSONWebKeySet {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	set := models.JSONWebKeySet{Keys: make([]models.JSONWebKey, 0, len(keys))}
+	for _, k := range keys {
+		jwk := models.JSONWebKey{Use: "sig", Alg: k.method.Alg(), Kid: k.id}
+		switch public := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,70 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestLegacyClaims(t *testing.T) {
+	lifetime = 7 * 24 * time.Hour
+	cutoff := time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)
+	firstKey := cutoff.Add(-lifetime)
+	unix := func(t time.Time) float64 { return float64(t.Unix()) }
+
+	tests := []struct {
+		name   string
+		until  time.Time
+		now    time.Time
+		claims jwt.Claims
+		want   bool
+	}{
+		{
+			name:   "issued before the first key",
+			until:  cutoff,
+			now:    cutoff.Add(-time.Hour),
+			claims: jwt.MapClaims{"iat": unix(firstKey.Add(-time.Hour)), "exp": unix(cutoff.Add(-time.Hour))},
+			want:   true,
+		},
+		{
+			name:   "after the cutoff",
+			until:  cutoff,
+			now:    cutoff.Add(time.Second),
+			claims: jwt.MapClaims{"iat": unix(firstKey.Add(-time.Hour)), "exp": unix(cutoff)},
+		},
+		{
+			name:   "minted with a late expiry",
+			until:  cutoff,
+			now:    cutoff.Add(-time.Hour),
+			claims: jwt.MapClaims{"exp": unix(cutoff.Add(time.Hour))},
+		},
+		{
+			name:   "issued after the first key",
+			until:  cutoff,
+			now:    cutoff.Add(-time.Hour),
+			claims: jwt.MapClaims{"iat": unix(firstKey.Add(time.Minute)), "exp": unix(cutoff.Add(-time.Hour))},
+		},
+		{
+			name:   "without expiry",
+			until:  cutoff,
+			now:    cutoff.Add(-time.Hour),
+			claims: jwt.MapClaims{"iat": unix(firstKey.Add(-time.Hour))},
+		},
+		{
+			name:   "keys without a cutoff",
+			now:    cutoff.Add(-time.Hour),
+			claims: jwt.MapClaims{"exp": unix(cutoff.Add(-2 * time.Hour))},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			legacyUntil = tt.until
+			mu.Unlock()
+			if got := legacyClaims(tt.claims, tt.now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// errForbiddenAddress is returned for webhook URLs that resolve to an
+// address inside the network the API runs in.
+var errForbiddenAddress = errors.New("URL must not point to a private, loopback or link-local address")
+
+// blockedPrefixes are ranges that are not on the public internet but that
+// netip.Addr's Is* methods do not cover.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// allowPrivate reports whether webhooks may be delivered to local and
+// private addresses, which is only meant for development.
+func allowPrivate() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE"))
+	return allow
+}
+
+// publicAddr reports whether webhooks may be delivered to addr.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHost resolves host and fails if any of its addresses is not public.
+func checkHost(ctx context.Context, host string) error {
+	if allowPrivate() {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(addr) {
+			return errForbiddenAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("URL host %q could not be resolved", host)
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return errForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// controlDial refuses connections to addresses that are not public. It runs
+// after DNS resolution for the address actually dialed, so a name that
+// resolved to a public address when the webhook was saved cannot be pointed
+// at an internal one later.
+func controlDial(_, address string, _ syscall.RawConn) error {
+	if allowPrivate() {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(addrPort.Addr()) {
+		return errForbiddenAddress
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. It connects
+// directly rather than through any proxy from the environment, so every
+// address it dials is checked, and it does not follow redirects.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: controlDial,
+	}
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        20,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// ValidateURL checks that a webhook URL is an absolute http(s) URL whose
+// host resolves to public addresses only. Deliveries check the address again
+// when they connect.
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("URL must be an absolute http or https URL")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return checkHost(ctx, u.Hostname())
+}
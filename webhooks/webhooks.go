@@ -0,0 +1,292 @@
+// Package webhooks delivers note events to user-configured URLs. Deliveries
+// are queued in the database and sent by a worker that retries failures with
+// exponential backoff, so events survive restarts and any replica can send
+// them.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"notes-api/database"
+	"notes-api/events"
+	"notes-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Ping is the event type of test deliveries.
+	Ping = "ping"
+	// AllEvents subscribes a webhook to every event type.
+	AllEvents = "*"
+
+	maxAttempts     = 8
+	baseBackoff     = 30 * time.Second
+	maxBackoff      = 6 * time.Hour
+	pollInterval    = 5 * time.Second
+	claimLease      = 2 * time.Minute // well above requestTimeout, as a batch is sent at once
+	batchSize       = 20
+	requestTimeout  = 10 * time.Second
+	maxResponseBody = 64 << 10
+)
+
+// Header names sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+var client = newClient()
+
+// Start subscribes to published events and starts the delivery worker.
+func Start() {
+	events.OnPublish(enqueueEvent)
+	go work()
+}
+
+// ValidateEvents checks that every entry is a known event type or "*".
+func ValidateEvents(types []string) error {
+	if len(types) == 0 {
+		return errors.New("At least one event type is required")
+	}
+	for _, t := range types {
+		if t == AllEvents {
+			continue
+		}
+		known := false
+		for _, candidate := range events.Types {
+			if t == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("Unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// GenerateSecret returns a random signing secret.
+func GenerateSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// Sign computes the signature header value for a delivery: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the webhook secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(webhook *models.Webhook, eventType string) bool {
+	for _, t := range webhook.Events {
+		if t == AllEvents || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func enqueueEvent(event events.Event) {
+	if event.Reminder != nil && !event.Reminder.Notifies(models.ChannelWebhook) {
+		return
+	}
+	var hooks []models.Webhook
+	if err := database.DB.Where("user_id = ? AND active = ?", event.UserID, true).Find(&hooks).Error; err != nil {
+		log.Println("Failed to load webhooks:", err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Failed to encode webhook payload:", err)
+		return
+	}
+	for i := range hooks {
+		if !subscribed(&hooks[i], event.Type) {
+			continue
+		}
+		if _, err := Enqueue(database.DB, hooks[i].ID, event.Type, payload); err != nil {
+			log.Printf("Failed to queue webhook %s: %v", hooks[i].ID, err)
+		}
+	}
+}
+
+// Enqueue queues a delivery of payload to a webhook for immediate sending.
+func Enqueue(tx *gorm.DB, webhookID uuid.UUID, eventType string, payload []byte) (*models.WebhookDelivery, error) {
+	delivery := models.WebhookDelivery{
+		WebhookID:     webhookID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(&delivery).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func work() {
+	for {
+		for {
+			n, err := processBatch()
+			if err != nil {
+				log.Println("Webhook worker:", err)
+			}
+			if n < batchSize {
+				break
+			}
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// processBatch claims due deliveries and sends them. A claim is a lease: the
+// next attempt is pushed into the future so other replicas skip the delivery,
+// and if this process dies it is retried once the lease runs out.
+func processBatch() (int, error) {
+	var deliveries []models.WebhookDelivery
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+			Order("next_attempt_at").Limit(batchSize).Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		ids := make([]uuid.UUID, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(claimLease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Sent one after another, a batch of slow receivers would outlast the
+	// lease and be claimed again by another replica
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer wg.Done()
+			attempt(delivery)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+func attempt(delivery *models.WebhookDelivery) {
+	var webhook models.Webhook
+	if err := database.DB.Where("id = ?", delivery.WebhookID).First(&webhook).Error; err != nil {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "webhook no longer exists"
+		database.DB.Save(delivery)
+		return
+	}
+	// The webhook may have been switched off since the delivery was queued
+	if !webhook.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "webhook is inactive"
+		database.DB.Save(delivery)
+		return
+	}
+
+	status, err := send(&webhook, delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		delivery.Status = models.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	default:
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = fmt.Sprintf("receiver responded with status %d", status)
+		}
+		if delivery.Attempts >= maxAttempts {
+			delivery.Status = models.DeliveryFailed
+		} else {
+			delivery.NextAttemptAt = now.Add(backoff(delivery.Attempts))
+		}
+	}
+
+	if err := database.DB.Save(delivery).Error; err != nil {
+		log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send posts delivery to webhook and returns the response status. The
+// response body is discarded: the receiver may be anything the URL reaches,
+// so none of what it answers is shown to the user.
+func send(webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Notes-API-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before retry number attempts: 30s, 1m, 2m, ...
+// capped at 6h.
+func backoff(attempts int) time.Duration {
+	d := baseBackoff << (attempts - 1)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}